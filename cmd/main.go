@@ -1,12 +1,20 @@
 package main
 
 import (
+	"deliverymanagement/internal/geo"
 	"deliverymanagement/internal/handler"
+	"deliverymanagement/internal/jwtkeys"
 	"deliverymanagement/internal/middleware"
 	"deliverymanagement/internal/repo"
+	"deliverymanagement/internal/scan"
+	"deliverymanagement/internal/serviceability"
+	"deliverymanagement/internal/storage"
 	"deliverymanagement/pkg/rabbitmq"
 	"deliverymanagement/pkg/ws"
+	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 
@@ -27,49 +35,397 @@ func main() {
 	permRepo := repo.NewInMemoryPermissionRepo()
 	rolePermRepo := repo.NewInMemoryRolePermissionRepo()
 	auditRepo := repo.NewInMemoryAuditLogRepo()
+	zoneRepo := repo.NewInMemoryZoneRepo()
+	hubRepo := repo.NewInMemoryHubRepo()
+	codRepo := repo.NewInMemoryCODRepo()
+	timelineRepo := repo.NewInMemoryTimelineRepo()
+	returnRepo := repo.NewInMemoryReturnRepo()
+	notificationRepo := repo.NewInMemoryNotificationRepo()
+	pickupPointRepo := repo.NewInMemoryPickupPointRepo()
+	handoverCodeRepo := repo.NewInMemoryHandoverCodeRepo()
+	vehicleRepo := repo.NewInMemoryVehicleRepo()
+	templateRepo := repo.NewInMemoryDeliveryTemplateRepo()
+	bulkJobRepo := repo.NewInMemoryBulkJobRepo()
+	customFieldRepo := repo.NewInMemoryCustomFieldRepo()
+	commentRepo := repo.NewInMemoryCommentRepo()
+	claimRepo := repo.NewInMemoryDamageClaimRepo()
+	storageQuotaRepo := repo.NewInMemoryStorageQuotaRepo()
+	fileScanRepo := repo.NewInMemoryFileScanRepo()
+	tokenRepo := repo.NewInMemoryTokenRepo()
 	publisher, _ := rabbitmq.New(os.Getenv("RABBITMQ_URL"))
 	redisClient := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
 	hub := ws.NewHub(redisClient)
 
-	authHandler := &handler.AuthHandler{Users: userRepo}
-	deliveryHandler := &handler.DeliveryHandler{Deliveries: deliveryRepo, Publisher: publisher, WSHub: hub}
-	scanEventHandler := &handler.ScanEventHandler{ScanEvents: scanEventRepo, WSHub: hub}
-	damageReportHandler := &handler.DamageReportHandler{DamageReports: damageReportRepo}
+	// Uploads go to UPLOAD_DIR (default ./uploads), or to an S3-compatible
+	// bucket with BLOB_STORE=s3, which multiple instances can share.
+	var blobs storage.BlobStore
+	if os.Getenv("BLOB_STORE") == "s3" {
+		blobs = storage.NewS3Store(storage.S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		})
+	} else {
+		uploadDir := os.Getenv("UPLOAD_DIR")
+		if uploadDir == "" {
+			uploadDir = "uploads"
+		}
+		local, err := storage.NewLocalStore(uploadDir)
+		if err != nil {
+			log.Fatalf("upload dir: %v", err)
+		}
+		blobs = local
+	}
+
+	// Idempotency keys live in memory unless IDEMPOTENCY_STORE=redis, which
+	// is needed when several API instances run behind a load balancer.
+	var idempotencyStore repo.IdempotencyStore = repo.NewInMemoryIdempotencyStore()
+	if os.Getenv("IDEMPOTENCY_STORE") == "redis" {
+		idempotencyStore = repo.NewRedisIdempotencyStore(redisClient)
+	}
+	idempotencyTTL, _ := time.ParseDuration(os.Getenv("IDEMPOTENCY_TTL"))
+	idempotent := handler.Idempotency(idempotencyStore, idempotencyTTL)
+
+	var geocoder geo.Geocoder
+	gazetteerPath := os.Getenv("GAZETTEER_PATH")
+	if gazetteerPath == "" {
+		gazetteerPath = "data/gazetteer.csv"
+	}
+	if gz, err := geo.LoadGazetteerFile(gazetteerPath); err == nil {
+		geocoder = gz
+	} else {
+		log.Printf("geocoding disabled: %v", err)
+	}
+
+	serviceabilityChecker := &serviceability.Checker{Zones: zoneRepo, Hubs: hubRepo}
+	// Bookings outside the zones are refused only when enabled; otherwise
+	// they are flagged for dispatchers like unresolved addresses.
+	var bookingServiceability *serviceability.Checker
+	if os.Getenv("ENFORCE_SERVICEABILITY") == "true" {
+		bookingServiceability = serviceabilityChecker
+	}
+	recipientSecret := []byte(os.Getenv("RECIPIENT_LINK_SECRET"))
+	if len(recipientSecret) == 0 {
+		recipientSecret = []byte(handler.GenerateSecret())
+		log.Printf("RECIPIENT_LINK_SECRET not set, recipient links will not survive a restart")
+	}
+	recipientLinks := &handler.RecipientLinks{Secret: recipientSecret}
+	fileLinkSecret := []byte(os.Getenv("FILE_LINK_SECRET"))
+	if len(fileLinkSecret) == 0 {
+		fileLinkSecret = []byte(handler.GenerateSecret())
+		log.Printf("FILE_LINK_SECRET not set, signed file links will not survive a restart")
+	}
+	fileLinks := &handler.FileLinks{Secret: fileLinkSecret}
+	notificationHandler := &handler.NotificationHandler{Notifications: notificationRepo, WSHub: hub}
+	// Tokens are signed with the keys described in JWT_KEYS_FILE (see
+	// jwtkeys.Config), which allows RS256 and EdDSA keys and rotation, or
+	// else with the HS256 secret JWT_SECRET. Without either a random secret
+	// is generated and tokens do not survive a restart.
+	var jwtKeys *jwtkeys.Manager
+	if path := os.Getenv("JWT_KEYS_FILE"); path != "" {
+		var err error
+		if jwtKeys, err = jwtkeys.LoadFile(path); err != nil {
+			log.Fatalf("jwt keys: %v", err)
+		}
+	} else {
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" {
+			log.Println("warning: JWT_SECRET not set, using a random secret")
+			secret = handler.GenerateSecret()
+		}
+		issuer, audience := os.Getenv("JWT_ISSUER"), os.Getenv("JWT_AUDIENCE")
+		if issuer == "" {
+			issuer = "deliverymanagement"
+		}
+		if audience == "" {
+			audience = "deliverymanagement-api"
+		}
+		var err error
+		jwtKeys, err = jwtkeys.New(jwtkeys.Config{
+			Issuer:   issuer,
+			Audience: audience,
+			Keys:     []jwtkeys.KeyConfig{{ID: "default", Alg: jwtkeys.HS256, Secret: secret}},
+		})
+		if err != nil {
+			log.Fatalf("jwt keys: %v", err)
+		}
+	}
+	// Access tokens are checked against the denylist, so logout and
+	// disabling a user take effect immediately.
+	jwtAuth := handler.JWTAuth(jwtKeys, tokenRepo)
+	authHandler := &handler.AuthHandler{Users: userRepo, Keys: jwtKeys, Tokens: tokenRepo}
+	returnHandler := &handler.ReturnHandler{Deliveries: deliveryRepo, Returns: returnRepo, Zones: zoneRepo, Timeline: timelineRepo, Publisher: publisher}
+	deliveryHandler := &handler.DeliveryHandler{
+		Deliveries:                deliveryRepo,
+		Publisher:                 publisher,
+		WSHub:                     hub,
+		Geocoder:                  geocoder,
+		Zones:                     zoneRepo,
+		Serviceability:            bookingServiceability,
+		COD:                       codRepo,
+		Timeline:                  timelineRepo,
+		Returns:                   returnHandler,
+		Users:                     userRepo,
+		Notifications:             notificationHandler,
+		RejectUnresolvedAddresses: os.Getenv("REJECT_UNRESOLVED_ADDRESSES") == "true",
+		PickupPoints:              pickupPointRepo,
+		HandoverCodes:             handoverCodeRepo,
+		Audit:                     auditRepo,
+		Vehicles:                  vehicleRepo,
+		RecipientLinks:            recipientLinks,
+		BulkJobs:                  bulkJobRepo,
+		CustomFields:              customFieldRepo,
+	}
+	pickupHoldDays, _ := strconv.Atoi(os.Getenv("PICKUP_HOLD_DAYS"))
+	pickupPointHandler := &handler.PickupPointHandler{
+		Points:        pickupPointRepo,
+		Deliveries:    deliveryRepo,
+		Geocoder:      geocoder,
+		Timeline:      timelineRepo,
+		Returns:       returnHandler,
+		Publisher:     publisher,
+		Notifications: notificationHandler,
+		HoldDays:      pickupHoldDays,
+	}
+	pickupPointHandler.StartExpiry(time.Hour)
+	vehicleHandler := &handler.VehicleHandler{Vehicles: vehicleRepo, Deliveries: deliveryRepo, Users: userRepo, Notifications: notificationHandler, Timeline: timelineRepo}
+	vehicleHandler.StartExpiryChecks(24 * time.Hour)
+	customFieldHandler := &handler.CustomFieldHandler{Fields: customFieldRepo}
+	templateHandler := &handler.TemplateHandler{
+		Templates:      templateRepo,
+		Deliveries:     deliveryRepo,
+		Geocoder:       geocoder,
+		Zones:          zoneRepo,
+		Serviceability: bookingServiceability,
+		Timeline:       timelineRepo,
+	}
+	templateHandler.StartScheduler(time.Hour)
+	recipientHandler := &handler.RecipientHandler{
+		Links:          recipientLinks,
+		Deliveries:     deliveryRepo,
+		Timeline:       timelineRepo,
+		Zones:          zoneRepo,
+		PickupPoints:   pickupPointRepo,
+		Serviceability: serviceabilityChecker,
+		Geocoder:       geocoder,
+	}
+	scanEventHandler := &handler.ScanEventHandler{ScanEvents: scanEventRepo, WSHub: hub, Timeline: timelineRepo}
+	claimHandler := &handler.ClaimHandler{
+		Claims:        claimRepo,
+		Deliveries:    deliveryRepo,
+		Users:         userRepo,
+		Notifications: notificationHandler,
+		Publisher:     publisher,
+		Timeline:      timelineRepo,
+	}
+	// Damage files are kept for DAMAGE_FILE_RETENTION_DAYS (default two
+	// years) after their claim closes, comment attachments for
+	// COMMENT_FILE_RETENTION_DAYS (default forever). STORAGE_QUOTA_MB caps
+	// each client's uploads unless an admin sets a quota of their own.
+	damageRetentionDays := 730
+	if v, err := strconv.Atoi(os.Getenv("DAMAGE_FILE_RETENTION_DAYS")); err == nil {
+		damageRetentionDays = v
+	}
+	commentRetentionDays, _ := strconv.Atoi(os.Getenv("COMMENT_FILE_RETENTION_DAYS"))
+	storageQuotaMB, _ := strconv.ParseInt(os.Getenv("STORAGE_QUOTA_MB"), 10, 64)
+	storageHandler := &handler.StorageHandler{
+		Blobs:         blobs,
+		Deliveries:    deliveryRepo,
+		DamageReports: damageReportRepo,
+		Comments:      commentRepo,
+		Claims:        claimRepo,
+		Quotas:        storageQuotaRepo,
+		DefaultQuota:  storageQuotaMB << 20,
+		Retention: map[string]time.Duration{
+			handler.FileTypeDamage:  time.Duration(damageRetentionDays) * 24 * time.Hour,
+			handler.FileTypeComment: time.Duration(commentRetentionDays) * 24 * time.Hour,
+		},
+	}
+	storageHandler.StartJanitor(24 * time.Hour)
+	// Uploads are scanned by clamd at CLAMD_ADDR (host:port), or by the
+	// built-in fake with MALWARE_SCANNER=fake for local development, and
+	// stay quarantined until found clean. Without either they are served
+	// unscanned.
+	var fileScanner *handler.FileScanner
+	var scanner scan.Scanner
+	if addr := os.Getenv("CLAMD_ADDR"); addr != "" {
+		scanner = &scan.Clamd{Addr: addr}
+	} else if os.Getenv("MALWARE_SCANNER") == "fake" {
+		scanner = &scan.Fake{}
+	} else {
+		log.Println("warning: CLAMD_ADDR not set, uploads are not scanned for malware")
+	}
+	if scanner != nil {
+		fileScanner = &handler.FileScanner{
+			Scanner:       scanner,
+			Blobs:         blobs,
+			Scans:         fileScanRepo,
+			DamageReports: damageReportRepo,
+			Users:         userRepo,
+			Notifications: notificationHandler,
+		}
+	}
+	damageReportHandler := &handler.DamageReportHandler{
+		DamageReports: damageReportRepo,
+		Blobs:         blobs,
+		Deliveries:    deliveryRepo,
+		Claims:        claimHandler,
+		KeepGPS:       os.Getenv("KEEP_PHOTO_GPS") == "true",
+		Storage:       storageHandler,
+		Scanner:       fileScanner,
+	}
 	rbacHandler := &handler.RBACHandler{Roles: roleRepo, Perms: permRepo, RolePerms: rolePermRepo, Audit: auditRepo}
-	userAdminHandler := &handler.UserAdminHandler{Users: userRepo}
+	userAdminHandler := &handler.UserAdminHandler{Users: userRepo, Tokens: tokenRepo}
 	authFlowHandler := &handler.AuthFlowHandler{Users: userRepo, Publisher: publisher}
-	fileHandler := &handler.FileHandler{DamageReports: damageReportRepo}
-	notificationRepo := repo.NewInMemoryNotificationRepo()
+	fileHandler := &handler.FileHandler{DamageReports: damageReportRepo, Blobs: blobs, Comments: commentRepo, Deliveries: deliveryRepo, Links: fileLinks, Audit: auditRepo, Scanner: fileScanner}
+	commentHandler := &handler.CommentHandler{
+		Comments:      commentRepo,
+		Deliveries:    deliveryRepo,
+		Blobs:         blobs,
+		Users:         userRepo,
+		Notifications: notificationHandler,
+		WSHub:         hub,
+		Timeline:      timelineRepo,
+		Storage:       storageHandler,
+		Scanner:       fileScanner,
+	}
 	analyticsHandler := &handler.AnalyticsHandler{Deliveries: deliveryRepo, Users: userRepo}
-	notificationHandler := &handler.NotificationHandler{Notifications: notificationRepo, WSHub: hub}
+	zoneHandler := &handler.ZoneHandler{Zones: zoneRepo}
+	hubHandler := &handler.HubHandler{Hubs: hubRepo}
+	codHandler := &handler.CODHandler{Deliveries: deliveryRepo, COD: codRepo}
+	serviceabilityHandler := &handler.ServiceabilityHandler{Checker: serviceabilityChecker, Geocoder: geocoder}
+
+	r.GET("/.well-known/jwks.json", handler.JWKS(jwtKeys))
 
 	auth := r.Group("/api/auth")
 	{
 		auth.POST("/register", authHandler.Register)
 		auth.POST("/login", authHandler.Login)
+		auth.POST("/refresh", authHandler.Refresh)
+		auth.POST("/logout", authHandler.Logout)
 		// Password reset & verification
 		auth.POST("/reset-request", authFlowHandler.ResetRequest)
 		auth.POST("/reset/:token", authFlowHandler.ResetPassword)
 		auth.POST("/verify/:token", authFlowHandler.VerifyEmail)
 	}
 
+	// Changes to a single delivery must name the version they were made on.
+	ifMatch := handler.RequireIfMatch()
 	deliveries := r.Group("/api/deliveries")
-	deliveries.Use(handler.JWTAuthMiddleware([]byte("supersecret")))
+	deliveries.Use(jwtAuth)
 	{
-		deliveries.POST("", deliveryHandler.CreateDelivery)
+		deliveries.POST("", idempotent, deliveryHandler.CreateDelivery)
+		deliveries.GET("", deliveryHandler.ListDeliveries)
 		deliveries.GET(":id", deliveryHandler.GetDelivery)
-		deliveries.POST(":id/assign", handler.DispatcherOnly(), deliveryHandler.AssignDelivery)
+		deliveries.POST(":id/assign", handler.DispatcherOnly(), ifMatch, deliveryHandler.AssignDelivery)
+		deliveries.POST(":id/out-for-delivery", handler.CourierOnly(), ifMatch, deliveryHandler.OutForDelivery)
+		deliveries.POST(":id/deliver", handler.CourierOnly(), ifMatch, deliveryHandler.CompleteDelivery)
+		deliveries.POST(":id/handover-override", handler.DispatcherOnly(), deliveryHandler.OverrideHandover)
+		deliveries.POST(":id/attempt-failed", handler.CourierOnly(), ifMatch, deliveryHandler.FailAttempt)
+		deliveries.POST(":id/return", ifMatch, returnHandler.RequestReturn)
+		deliveries.GET(":id/timeline", deliveryHandler.GetTimeline)
+		deliveries.GET(":id/damage-reports", damageReportHandler.ListDeliveryReports)
+		deliveries.GET(":id/comments", commentHandler.ListComments)
+		deliveries.POST(":id/comments", commentHandler.CreateComment)
+		deliveries.GET(":id/label", deliveryHandler.GetLabel)
+		deliveries.PATCH(":id/fields", ifMatch, deliveryHandler.UpdateFields)
+		deliveries.POST(":id/drop-off", handler.CourierOnly(), ifMatch, pickupPointHandler.DropOff)
 		deliveries.GET("/export", deliveryHandler.ExportDeliveries)
+		deliveries.POST("/bulk", handler.DispatcherOnly(), deliveryHandler.BulkUpdate)
+		deliveries.GET("/bulk/jobs/:job_id", handler.DispatcherOnly(), deliveryHandler.GetBulkJob)
+	}
+
+	r.GET("/api/custom-fields", jwtAuth, customFieldHandler.ListOwnFields)
+
+	templates := r.Group("/api/templates")
+	templates.Use(jwtAuth)
+	{
+		templates.POST("", templateHandler.CreateTemplate)
+		templates.GET("", templateHandler.ListTemplates)
+		templates.GET("/:id", templateHandler.GetTemplate)
+		templates.PUT("/:id", templateHandler.UpdateTemplate)
+		templates.POST("/:id/pause", templateHandler.PauseTemplate)
+		templates.POST("/:id/resume", templateHandler.ResumeTemplate)
+		templates.POST("/:id/skip", templateHandler.SkipOccurrence)
+		templates.GET("/:id/occurrences", templateHandler.ListOccurrences)
+	}
+
+	returns := r.Group("/api/returns")
+	returns.Use(jwtAuth)
+	{
+		returns.GET("", returnHandler.ListReturns)
+		returns.GET("/export", returnHandler.ExportReturns)
 	}
 
-	r.POST("/api/scan", scanEventHandler.CreateScanEvent)
-	r.POST("/api/damage-report", handler.JWTAuthMiddleware([]byte("supersecret")), handler.CourierOrWarehouseOnly(), damageReportHandler.CreateDamageReport)
+	claims := r.Group("/api/claims")
+	claims.Use(jwtAuth)
+	{
+		claims.GET("", claimHandler.ListClaims)
+		claims.GET("/export", handler.DispatcherOrAdminOnly(), claimHandler.ExportClaims)
+		claims.GET("/:id", claimHandler.GetClaim)
+		claims.POST("/:id/assign", handler.DispatcherOrAdminOnly(), claimHandler.AssignReviewer)
+		claims.POST("/:id/evidence-requests", handler.DispatcherOrAdminOnly(), claimHandler.RequestEvidence)
+		claims.POST("/:id/evidence", claimHandler.SubmitEvidence)
+		claims.POST("/:id/decision", handler.DispatcherOrAdminOnly(), claimHandler.Decide)
+		claims.POST("/:id/pay", handler.DispatcherOrAdminOnly(), claimHandler.MarkPaid)
+	}
+
+	vehicles := r.Group("/api/vehicles")
+	vehicles.Use(jwtAuth, handler.DispatcherOnly())
+	{
+		vehicles.POST("", vehicleHandler.CreateVehicle)
+		vehicles.GET("", vehicleHandler.ListVehicles)
+		vehicles.GET("/:id", vehicleHandler.GetVehicle)
+		vehicles.PUT("/:id", vehicleHandler.UpdateVehicle)
+		vehicles.POST("/:id/assignments", vehicleHandler.AssignCourier)
+		vehicles.GET("/:id/assignments", vehicleHandler.ListAssignments)
+		vehicles.POST("/:id/manifests", vehicleHandler.SealManifest)
+		vehicles.GET("/:id/manifests", vehicleHandler.ListManifests)
+	}
+
+	cod := r.Group("/api/cod")
+	cod.Use(jwtAuth)
+	{
+		cod.POST("/remittances", handler.DispatcherOnly(), codHandler.CreateRemittance)
+		cod.GET("/reconciliation", handler.DispatcherOnly(), codHandler.Reconciliation)
+		cod.GET("/settlements", codHandler.Settlements)
+	}
+
+	r.POST("/api/serviceability", serviceabilityHandler.Check)
+	// Recipient self-service, authorized by the signed link instead of a JWT
+	recipient := r.Group("/api/recipient/:token")
+	{
+		recipient.GET("", recipientHandler.GetDelivery)
+		recipient.POST("/window", recipientHandler.Reschedule)
+		recipient.POST("/pickup-point", recipientHandler.RedirectToPickupPoint)
+		recipient.POST("/instructions", recipientHandler.SetInstructions)
+	}
+	r.GET("/api/pickup-points", pickupPointHandler.ListPickupPoints)
+	r.GET("/api/pickup-points/:id", pickupPointHandler.GetPickupPoint)
+	r.POST("/api/pickup-points/:id/collect", pickupPointHandler.Collect)
+	r.POST("/api/scan", jwtAuth, handler.CourierOrWarehouseOnly(), idempotent, scanEventHandler.CreateScanEvent)
+	r.POST("/api/damage-report", jwtAuth, handler.CourierOrWarehouseOnly(), idempotent, damageReportHandler.CreateDamageReport)
+	r.GET("/api/damage-report/:id", jwtAuth, damageReportHandler.GetDamageReport)
+	r.POST("/api/damage-report/:id/attachments", jwtAuth, idempotent, damageReportHandler.AddAttachments)
+	r.GET("/api/admin/damage-reports/:id/locations", jwtAuth, handler.AdminOnly(), damageReportHandler.ListLocations)
+	r.GET("/api/admin/storage/usage", jwtAuth, handler.AdminOnly(), storageHandler.GetUsage)
+	r.PUT("/api/admin/storage/quotas/:client_id", jwtAuth, handler.AdminOnly(), storageHandler.SetQuota)
+	r.POST("/api/admin/storage/sweep", jwtAuth, handler.AdminOnly(), storageHandler.RunSweep)
+	if fileScanner != nil {
+		r.GET("/api/admin/files/:filename/scan", jwtAuth, handler.AdminOnly(), fileScanner.GetScan)
+		r.POST("/api/admin/files/:filename/scan", jwtAuth, handler.AdminOnly(), fileScanner.Rescan)
+	}
 
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "OK"})
 	})
 
+	// Zones, hubs, lockers and custom fields shape every client's
+	// deliveries; the whole admin API requires an admin token.
 	admin := r.Group("/api/admin")
+	admin.Use(jwtAuth, handler.AdminOnly())
 	{
 		admin.POST("/roles", rbacHandler.CreateRole)
 		admin.GET("/roles", rbacHandler.ListRoles)
@@ -85,12 +441,27 @@ func main() {
 		admin.GET("/users/:id", userAdminHandler.GetUser)
 		admin.PUT("/users/:id", userAdminHandler.UpdateUser)
 		admin.DELETE("/users/:id", userAdminHandler.DeleteUser)
+
+		// Delivery zones
+		admin.POST("/zones", zoneHandler.CreateZone)
+		admin.GET("/zones", zoneHandler.ListZones)
+		admin.GET("/zones/:id", zoneHandler.GetZone)
+		admin.PUT("/zones/:id", zoneHandler.UpdateZone)
+		admin.DELETE("/zones/:id", zoneHandler.DeleteZone)
+		admin.PUT("/hubs/:code", hubHandler.SaveHub)
+		admin.GET("/hubs", hubHandler.ListHubs)
+		admin.GET("/hubs/:code", hubHandler.GetHub)
+		admin.POST("/pickup-points", pickupPointHandler.CreatePickupPoint)
+		admin.POST("/clients/:client_id/custom-fields", customFieldHandler.CreateField)
+		admin.GET("/clients/:client_id/custom-fields", customFieldHandler.ListFields)
+		admin.DELETE("/clients/:client_id/custom-fields/:key", customFieldHandler.DeleteField)
+		admin.GET("/analytics/summary", analyticsHandler.Summary)
+		admin.GET("/analytics/by-courier", analyticsHandler.ByCourier)
 	}
 
-	r.GET("/files/:filename", handler.JWTAuthMiddleware([]byte("supersecret")), fileHandler.ServeFile)
+	r.GET("/files/:filename", fileHandler.Authenticate(jwtAuth), fileHandler.ServeFile)
+	r.POST("/api/files/:filename/links", jwtAuth, fileHandler.CreateLink)
 
-	r.GET("/api/admin/analytics/summary", analyticsHandler.Summary)
-	r.GET("/api/admin/analytics/by-courier", analyticsHandler.ByCourier)
 	r.GET("/api/notifications", notificationHandler.List)
 	r.POST("/api/notifications/:id/read", notificationHandler.MarkRead)
 
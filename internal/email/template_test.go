@@ -13,6 +13,11 @@ func TestRenderTemplate(t *testing.T) {
 		{"delivery_created", "delivery_created.html", map[string]interface{}{"RecipientName": "Alice", "DeliveryID": 42}},
 		{"delivery_delivered", "delivery_delivered.html", map[string]interface{}{"RecipientName": "Bob", "DeliveryID": 99}},
 		{"damage_reported", "damage_reported.html", map[string]interface{}{"RecipientName": "Carol", "DeliveryID": 123}},
+		{"damage_claim_under_review", "damage_claim_under_review.html", map[string]interface{}{"RecipientName": "Carol", "DeliveryID": 123, "ClaimID": 1}},
+		{"damage_claim_evidence_requested", "damage_claim_evidence_requested.html", map[string]interface{}{"RecipientName": "Carol", "DeliveryID": 123, "ClaimID": 1, "Message": "More photos"}},
+		{"damage_claim_approved", "damage_claim_approved.html", map[string]interface{}{"RecipientName": "Carol", "DeliveryID": 123, "ClaimID": 1, "ApprovedAmount": "300.00 KZT"}},
+		{"damage_claim_rejected", "damage_claim_rejected.html", map[string]interface{}{"RecipientName": "Carol", "DeliveryID": 123, "ClaimID": 1, "DecisionNotes": "Not covered"}},
+		{"damage_claim_paid", "damage_claim_paid.html", map[string]interface{}{"RecipientName": "Carol", "DeliveryID": 123, "ClaimID": 1, "ApprovedAmount": "300.00 KZT"}},
 		{"export_ready", "export_ready.html", map[string]interface{}{"RecipientName": "Dave", "ExportURL": "https://example.com/export.csv"}},
 	}
 	for _, c := range cases {
@@ -0,0 +1,188 @@
+package geo
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"deliverymanagement/internal/model"
+)
+
+var ErrInvalidAddress = errors.New("invalid address")
+
+// countryAliases maps common spellings to ISO 3166-1 alpha-2 codes.
+var countryAliases = map[string]string{
+	"kazakhstan":     "KZ",
+	"kz":             "KZ",
+	"kaz":            "KZ",
+	"russia":         "RU",
+	"ru":             "RU",
+	"kyrgyzstan":     "KG",
+	"kg":             "KG",
+	"uzbekistan":     "UZ",
+	"uz":             "UZ",
+	"united states":  "US",
+	"usa":            "US",
+	"us":             "US",
+	"united kingdom": "GB",
+	"uk":             "GB",
+	"gb":             "GB",
+	"germany":        "DE",
+	"de":             "DE",
+}
+
+// postalPatterns holds the postal code format for countries we validate.
+var postalPatterns = map[string]*regexp.Regexp{
+	"KZ": regexp.MustCompile(`^\d{6}$`),
+	"RU": regexp.MustCompile(`^\d{6}$`),
+	"KG": regexp.MustCompile(`^\d{6}$`),
+	"UZ": regexp.MustCompile(`^\d{6}$`),
+	"US": regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+	"DE": regexp.MustCompile(`^\d{5}$`),
+	"GB": regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`),
+}
+
+var streetAbbreviations = map[string]string{
+	"st":   "Street",
+	"str":  "Street",
+	"ave":  "Avenue",
+	"av":   "Avenue",
+	"pr":   "Avenue",
+	"blvd": "Boulevard",
+	"rd":   "Road",
+	"ln":   "Lane",
+	"mkr":  "Microdistrict",
+}
+
+var (
+	spaceRe    = regexp.MustCompile(`\s+`)
+	buildingRe = regexp.MustCompile(`^(.*?)[\s,]+(\d+[A-Za-z]?(?:/\d+)?)$`)
+)
+
+// CountryCode resolves a country name or code to its ISO alpha-2 code.
+// Unknown values are returned upper-cased.
+func CountryCode(s string) string {
+	s = collapse(s)
+	if code, ok := countryAliases[strings.ToLower(s)]; ok {
+		return code
+	}
+	return strings.ToUpper(s)
+}
+
+// Normalize cleans up whitespace and casing, expands street abbreviations
+// and canonicalizes the country code and postal code.
+func Normalize(a model.Address) model.Address {
+	a.Street = normalizeStreet(a.Street)
+	a.Building = strings.ToUpper(collapse(a.Building))
+	a.City = titleCase(collapse(a.City))
+	a.Country = CountryCode(a.Country)
+	a.PostalCode = strings.ToUpper(collapse(a.PostalCode))
+	if a.Country != "GB" {
+		a.PostalCode = strings.ReplaceAll(a.PostalCode, " ", "")
+	}
+	if a.Building == "" {
+		if m := buildingRe.FindStringSubmatch(a.Street); m != nil {
+			a.Street, a.Building = m[1], strings.ToUpper(m[2])
+		}
+	}
+	return a
+}
+
+// Validate checks that the address has a street and, when a country with a
+// known format is given, that the postal code matches it.
+func Validate(a model.Address) error {
+	if a.Street == "" {
+		return fmt.Errorf("%w: street is required", ErrInvalidAddress)
+	}
+	if a.Country != "" && len(a.Country) != 2 {
+		return fmt.Errorf("%w: unknown country %q", ErrInvalidAddress, a.Country)
+	}
+	if a.PostalCode != "" {
+		if re, ok := postalPatterns[a.Country]; ok && !re.MatchString(a.PostalCode) {
+			return fmt.Errorf("%w: invalid postal code %q for %s", ErrInvalidAddress, a.PostalCode, a.Country)
+		}
+	}
+	return nil
+}
+
+// ParseAddress splits a free-form "street building, city, postal code, country"
+// string into its components. Parts it cannot classify stay in Street, so a
+// bare string such as "Warehouse 3" still produces a usable address.
+func ParseAddress(raw string) model.Address {
+	var a model.Address
+	var rest []string
+	for _, p := range strings.Split(raw, ",") {
+		p = collapse(p)
+		if p == "" {
+			continue
+		}
+		rest = append(rest, p)
+	}
+	if len(rest) > 1 {
+		if _, ok := countryAliases[strings.ToLower(rest[len(rest)-1])]; ok {
+			a.Country = CountryCode(rest[len(rest)-1])
+			rest = rest[:len(rest)-1]
+		}
+	}
+	var street []string
+	for i, p := range rest {
+		switch {
+		case i > 0 && a.PostalCode == "" && looksLikePostalCode(p, a.Country):
+			a.PostalCode = p
+		case i > 0 && a.City == "":
+			a.City = p
+		default:
+			street = append(street, p)
+		}
+	}
+	a.Street = strings.Join(street, ", ")
+	return Normalize(a)
+}
+
+func looksLikePostalCode(s, country string) bool {
+	s = strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+	if re, ok := postalPatterns[country]; ok {
+		return re.MatchString(s)
+	}
+	for _, re := range postalPatterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeStreet(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		key := strings.ToLower(strings.TrimSuffix(w, "."))
+		if full, ok := streetAbbreviations[key]; ok {
+			words[i] = full
+			continue
+		}
+		words[i] = titleWord(w)
+	}
+	return strings.Join(words, " ")
+}
+
+func titleCase(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		words[i] = titleWord(w)
+	}
+	return strings.Join(words, " ")
+}
+
+func titleWord(w string) string {
+	if w == "" || strings.ContainsAny(w[:1], "0123456789") {
+		return w
+	}
+	r := []rune(strings.ToLower(w))
+	r[0] = []rune(strings.ToUpper(string(r[0])))[0]
+	return string(r)
+}
+
+func collapse(s string) string {
+	return strings.TrimSpace(spaceRe.ReplaceAllString(s, " "))
+}
@@ -0,0 +1,144 @@
+package geo
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"deliverymanagement/internal/model"
+)
+
+var ErrNotFound = errors.New("address could not be geocoded")
+
+// Geocoder resolves an address to coordinates. Implementations return
+// ErrNotFound when the address is unknown to them.
+type Geocoder interface {
+	Geocode(addr model.Address) (Point, error)
+}
+
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// Gazetteer is an offline geocoder backed by a postcode/city table.
+// Lookups try the postal code first and fall back to the city centroid.
+type Gazetteer struct {
+	byPostal map[string]Point // "KZ|050000"
+	byCity   map[string]Point // "KZ|almaty"
+}
+
+// LoadGazetteerFile reads a gazetteer CSV from disk.
+func LoadGazetteerFile(path string) (*Gazetteer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadGazetteer(f)
+}
+
+// LoadGazetteer reads CSV rows of country,postal_code,city,lat,lng.
+// A header row and blank postal codes are allowed.
+func LoadGazetteer(r io.Reader) (*Gazetteer, error) {
+	g := &Gazetteer{byPostal: map[string]Point{}, byCity: map[string]Point{}}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 5
+	cr.Comment = '#'
+	line := 0
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line++
+		if line == 1 && strings.EqualFold(rec[0], "country") {
+			continue
+		}
+		lat, err1 := strconv.ParseFloat(strings.TrimSpace(rec[3]), 64)
+		lng, err2 := strconv.ParseFloat(strings.TrimSpace(rec[4]), 64)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("gazetteer line %d: invalid coordinates", line)
+		}
+		g.Add(rec[0], rec[1], rec[2], Point{Lat: lat, Lng: lng})
+	}
+	return g, nil
+}
+
+// Add registers a gazetteer entry. The first entry for a city becomes its centroid.
+func (g *Gazetteer) Add(country, postalCode, city string, p Point) {
+	country = CountryCode(country)
+	if pc := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(postalCode), " ", "")); pc != "" {
+		g.byPostal[country+"|"+pc] = p
+	}
+	if city = strings.ToLower(collapse(city)); city != "" {
+		if _, ok := g.byCity[country+"|"+city]; !ok {
+			g.byCity[country+"|"+city] = p
+		}
+	}
+}
+
+func (g *Gazetteer) Geocode(addr model.Address) (Point, error) {
+	pc := strings.ReplaceAll(addr.PostalCode, " ", "")
+	if p, ok := g.byPostal[addr.Country+"|"+pc]; ok && pc != "" {
+		return p, nil
+	}
+	if p, ok := g.byCity[addr.Country+"|"+strings.ToLower(addr.City)]; ok && addr.City != "" {
+		return p, nil
+	}
+	if addr.Country == "" && addr.City != "" {
+		// Country omitted: accept the city only if the name is unambiguous.
+		var found []Point
+		for k, p := range g.byCity {
+			if strings.HasSuffix(k, "|"+strings.ToLower(addr.City)) {
+				found = append(found, p)
+			}
+		}
+		if len(found) == 1 {
+			return found[0], nil
+		}
+	}
+	return Point{}, ErrNotFound
+}
+
+// ChainGeocoder tries each geocoder in order, which lets external
+// providers be layered over the offline gazetteer.
+type ChainGeocoder []Geocoder
+
+func (c ChainGeocoder) Geocode(addr model.Address) (Point, error) {
+	for _, g := range c {
+		p, err := g.Geocode(addr)
+		if err == nil {
+			return p, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return Point{}, err
+		}
+	}
+	return Point{}, ErrNotFound
+}
+
+// Resolve normalizes and validates an address and fills in its coordinates.
+// The returned address is usable even when err is ErrNotFound.
+func Resolve(g Geocoder, a model.Address) (model.Address, error) {
+	a = Normalize(a)
+	if err := Validate(a); err != nil {
+		return a, err
+	}
+	if g == nil {
+		return a, nil
+	}
+	p, err := g.Geocode(a)
+	if err != nil {
+		return a, err
+	}
+	a.Lat, a.Lng, a.Geocoded = p.Lat, p.Lng, true
+	return a, nil
+}
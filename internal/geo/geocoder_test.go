@@ -0,0 +1,79 @@
+package geo
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"deliverymanagement/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testGazetteer = `country,postal_code,city,lat,lng
+KZ,050000,Almaty,43.2389,76.8897
+KZ,050010,Almaty,43.2567,76.9286
+KZ,010000,Astana,51.1282,71.4307
+`
+
+func TestParseAndNormalizeAddress(t *testing.T) {
+	a := ParseAddress("  abay ave.   10, almaty, 050 000, Kazakhstan ")
+	assert.Equal(t, "Abay Avenue", a.Street)
+	assert.Equal(t, "10", a.Building)
+	assert.Equal(t, "Almaty", a.City)
+	assert.Equal(t, "050000", a.PostalCode)
+	assert.Equal(t, "KZ", a.Country)
+	assert.Equal(t, "Abay Avenue 10, Almaty, 050000, KZ", a.String())
+
+	// Unclassifiable input stays in the street
+	assert.Equal(t, "Warehouse 3", ParseAddress("warehouse 3").String())
+}
+
+func TestValidateAddress(t *testing.T) {
+	assert.NoError(t, Validate(Normalize(model.Address{Street: "Abay", City: "Almaty", PostalCode: "050000", Country: "kz"})))
+	assert.True(t, errors.Is(Validate(model.Address{City: "Almaty"}), ErrInvalidAddress))
+	assert.True(t, errors.Is(Validate(Normalize(model.Address{Street: "Abay", PostalCode: "12", Country: "KZ"})), ErrInvalidAddress))
+	assert.True(t, errors.Is(Validate(Normalize(model.Address{Street: "Abay", Country: "Atlantis"})), ErrInvalidAddress))
+}
+
+func TestGazetteerGeocode(t *testing.T) {
+	g, err := LoadGazetteer(strings.NewReader(testGazetteer))
+	assert.NoError(t, err)
+
+	// Postal code wins over city centroid
+	p, err := g.Geocode(model.Address{PostalCode: "050010", City: "Almaty", Country: "KZ"})
+	assert.NoError(t, err)
+	assert.Equal(t, 43.2567, p.Lat)
+
+	// City fallback
+	p, err = g.Geocode(model.Address{City: "Astana", Country: "KZ"})
+	assert.NoError(t, err)
+	assert.Equal(t, 71.4307, p.Lng)
+
+	_, err = g.Geocode(model.Address{City: "Nowhere", Country: "KZ"})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+type fakeProvider struct{ p Point }
+
+func (f fakeProvider) Geocode(model.Address) (Point, error) { return f.p, nil }
+
+func TestChainAndResolve(t *testing.T) {
+	g, _ := LoadGazetteer(strings.NewReader(testGazetteer))
+	chain := ChainGeocoder{g, fakeProvider{Point{Lat: 1, Lng: 2}}}
+
+	a, err := Resolve(chain, ParseAddress("Abay 10, Almaty, Kazakhstan"))
+	assert.NoError(t, err)
+	assert.True(t, a.Geocoded)
+	assert.Equal(t, 43.2389, a.Lat)
+
+	// Falls through to the external provider
+	a, err = Resolve(chain, ParseAddress("Main St 1, Springfield, USA"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, a.Lat)
+
+	a, err = Resolve(g, ParseAddress("Main St 1, Springfield, USA"))
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.False(t, a.Geocoded)
+	assert.Equal(t, "Main Street", a.Street)
+}
@@ -0,0 +1,91 @@
+package geo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"deliverymanagement/internal/model"
+)
+
+var ErrInvalidGeometry = errors.New("invalid geometry")
+
+// ParseGeoJSON accepts a Polygon or MultiPolygon geometry, optionally wrapped
+// in a Feature, and returns its polygons.
+func ParseGeoJSON(raw []byte) ([]model.Polygon, error) {
+	var obj struct {
+		Type        string          `json:"type"`
+		Geometry    json.RawMessage `json:"geometry"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidGeometry, err)
+	}
+	var polys []model.Polygon
+	switch obj.Type {
+	case "Feature":
+		return ParseGeoJSON(obj.Geometry)
+	case "Polygon":
+		var p model.Polygon
+		if err := json.Unmarshal(obj.Coordinates, &p); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidGeometry, err)
+		}
+		polys = []model.Polygon{p}
+	case "MultiPolygon":
+		if err := json.Unmarshal(obj.Coordinates, &polys); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidGeometry, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported type %q", ErrInvalidGeometry, obj.Type)
+	}
+	for _, p := range polys {
+		if len(p) == 0 {
+			return nil, fmt.Errorf("%w: polygon without rings", ErrInvalidGeometry)
+		}
+		for _, ring := range p {
+			if len(ring) < 4 || ring[0] != ring[len(ring)-1] {
+				return nil, fmt.Errorf("%w: rings must be closed with at least 4 positions", ErrInvalidGeometry)
+			}
+		}
+	}
+	return polys, nil
+}
+
+// Contains reports whether p lies inside the polygon's outer ring and
+// outside all of its holes.
+func Contains(poly model.Polygon, p Point) bool {
+	if len(poly) == 0 || !ringContains(poly[0], p) {
+		return false
+	}
+	for _, hole := range poly[1:] {
+		if ringContains(hole, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// ringContains is the even-odd ray casting test.
+func ringContains(ring [][2]float64, p Point) bool {
+	in := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > p.Lat) != (yj > p.Lat) && p.Lng < (xj-xi)*(p.Lat-yi)/(yj-yi)+xi {
+			in = !in
+		}
+	}
+	return in
+}
+
+// FindZone returns the first zone whose geometry contains p, or nil.
+func FindZone(zones []model.Zone, p Point) *model.Zone {
+	for i := range zones {
+		for _, poly := range zones[i].Polygons {
+			if Contains(poly, p) {
+				return &zones[i]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package geo
+
+import (
+	"testing"
+
+	"deliverymanagement/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGeoJSONAndContains(t *testing.T) {
+	polys, err := ParseGeoJSON([]byte(`{"type":"Feature","geometry":{"type":"Polygon","coordinates":[
+		[[76.8,43.2],[77.0,43.2],[77.0,43.3],[76.8,43.3],[76.8,43.2]],
+		[[76.88,43.23],[76.90,43.23],[76.90,43.25],[76.88,43.25],[76.88,43.23]]
+	]}}`))
+	assert.NoError(t, err)
+	assert.Len(t, polys, 1)
+
+	assert.True(t, Contains(polys[0], Point{Lat: 43.21, Lng: 76.81}))
+	assert.False(t, Contains(polys[0], Point{Lat: 43.24, Lng: 76.89}), "point in hole")
+	assert.False(t, Contains(polys[0], Point{Lat: 51.12, Lng: 71.43}))
+
+	_, err = ParseGeoJSON([]byte(`{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1]]]}`))
+	assert.ErrorIs(t, err, ErrInvalidGeometry)
+	_, err = ParseGeoJSON([]byte(`{"type":"Point","coordinates":[0,0]}`))
+	assert.ErrorIs(t, err, ErrInvalidGeometry)
+}
+
+func TestFindZone(t *testing.T) {
+	square := func(minLng, minLat, maxLng, maxLat float64) model.Polygon {
+		return model.Polygon{{{minLng, minLat}, {maxLng, minLat}, {maxLng, maxLat}, {minLng, maxLat}, {minLng, minLat}}}
+	}
+	zones := []model.Zone{
+		{ID: 1, Polygons: []model.Polygon{square(76, 43, 77, 44)}},
+		{ID: 2, Polygons: []model.Polygon{square(71, 51, 72, 52), square(69, 42, 70, 43)}},
+	}
+	assert.Equal(t, uint(1), FindZone(zones, Point{Lat: 43.5, Lng: 76.5}).ID)
+	assert.Equal(t, uint(2), FindZone(zones, Point{Lat: 42.3, Lng: 69.6}).ID)
+	assert.Nil(t, FindZone(zones, Point{Lat: 0, Lng: 0}))
+}
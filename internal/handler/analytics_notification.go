@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"time"
 	"deliverymanagement/internal/model"
 	"deliverymanagement/internal/repo"
 	"deliverymanagement/pkg/ws"
@@ -24,12 +25,15 @@ type NotificationHandler struct {
 // GET /api/admin/analytics/summary
 func (h *AnalyticsHandler) Summary(c *gin.Context) {
 	deliveries, _ := h.Deliveries.ListDeliveries()
+	deliveries = filterDeliveries(c, deliveries)
 	total := len(deliveries)
 	byStatus := map[string]int{}
+	byZone := map[uint]int{}
 	var totalTime float64
 	var deliveredCount int
 	for _, d := range deliveries {
 		byStatus[d.Status]++
+		byZone[d.ZoneID]++
 		if d.Status == "delivered" {
 			deliveredCount++
 			totalTime += d.DeliveredAt.Sub(d.CreatedAt).Hours()
@@ -39,12 +43,13 @@ func (h *AnalyticsHandler) Summary(c *gin.Context) {
 	if deliveredCount > 0 {
 		avgTime = totalTime / float64(deliveredCount)
 	}
-	c.JSON(http.StatusOK, gin.H{"total": total, "by_status": byStatus, "avg_time": avgTime})
+	c.JSON(http.StatusOK, gin.H{"total": total, "by_status": byStatus, "by_zone": byZone, "avg_time": avgTime})
 }
 
 // GET /api/admin/analytics/by-courier
 func (h *AnalyticsHandler) ByCourier(c *gin.Context) {
 	deliveries, _ := h.Deliveries.ListDeliveries()
+	deliveries = filterDeliveries(c, deliveries)
 	courierStats := map[uint]int{}
 	for _, d := range deliveries {
 		courierStats[d.CourierID]++
@@ -80,6 +85,24 @@ func (h *NotificationHandler) PublishNotification(n *model.Notification) {
 	}
 }
 
+// notifyRole sends a copy of n to every user with the given role.
+// It is a no-op when either dependency is missing.
+func notifyRole(users repo.UserRepository, notifier *NotificationHandler, role string, n model.Notification) {
+	if users == nil || notifier == nil {
+		return
+	}
+	list, _ := users.ListUsers()
+	for _, u := range list {
+		if u.Role != role {
+			continue
+		}
+		msg := n
+		msg.UserID = uint64(u.ID)
+		msg.CreatedAt = time.Now()
+		notifier.PublishNotification(&msg)
+	}
+}
+
 func getUserIDFromContext(c *gin.Context) uint64 {
 	// TODO: extract from JWT/session
 	return 1
@@ -1,8 +1,13 @@
 package handler
 
 import (
+	"crypto/sha256"
+	"deliverymanagement/internal/jwtkeys"
 	"deliverymanagement/internal/model"
 	"deliverymanagement/internal/repo"
+	"encoding/hex"
+	"errors"
+	"log"
 	"net/http"
 	"time"
 
@@ -11,10 +16,20 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-var jwtSecret = []byte("supersecret")
+const (
+	defaultAccessTTL  = 15 * time.Minute
+	defaultRefreshTTL = 30 * 24 * time.Hour
+)
 
 type AuthHandler struct {
 	Users repo.UserRepository
+	// Keys signs the access tokens.
+	Keys *jwtkeys.Manager
+	// Tokens keeps refresh tokens and the access token denylist. Without
+	// it Login issues a single 24-hour access token.
+	Tokens     repo.TokenRepository
+	AccessTTL  time.Duration // 15 minutes when zero
+	RefreshTTL time.Duration // 30 days when zero
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -57,15 +72,158 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"role":    "client",
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
-	})
-	tokenString, err := token.SignedString(jwtSecret)
+	if user.Disabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "account disabled"})
+		return
+	}
+	if h.Tokens == nil {
+		tokenString, err := h.signAccessToken(user, "", time.Now(), time.Now().Add(time.Hour*24))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"token": tokenString})
+		return
+	}
+	res, err := h.tokenPair(user, generateToken(), GenerateSecret(), time.Now())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create token"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"token": tokenString})
+	c.JSON(http.StatusOK, res)
+}
+
+// POST /api/auth/refresh
+// Body: {"refresh_token": "..."}. Returns a new token pair and uses up the
+// presented refresh token. Presenting a used refresh token again means it
+// was copied, so every token of that login is revoked.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	now := time.Now()
+	old, err := h.Tokens.GetRefreshToken(hashToken(req.RefreshToken))
+	if err != nil || !old.RevokedAt.IsZero() || now.After(old.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+	user := userByID(h.Users, old.UserID)
+	if user == nil || user.Disabled {
+		h.Tokens.RevokeFamily(old.FamilyID, now)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+	refresh := GenerateSecret()
+	if err := h.Tokens.UseRefreshToken(old.Hash, hashToken(refresh), now); err != nil {
+		if errors.Is(err, repo.ErrRefreshTokenUsed) {
+			h.Tokens.RevokeFamily(old.FamilyID, now)
+			log.Printf("refresh token reused for user %d; revoked its login", old.UserID)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token reuse detected, please log in again"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	res, err := h.tokenPair(user, old.FamilyID, refresh, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create token"})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// POST /api/auth/logout
+// Body: {"refresh_token": "..."}. Revokes the login the refresh token
+// belongs to, including the access tokens issued with it. Unknown tokens
+// are accepted silently.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	if t, err := h.Tokens.GetRefreshToken(hashToken(req.RefreshToken)); err == nil {
+		h.Tokens.RevokeFamily(t.FamilyID, time.Now())
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// tokenPair issues an access token and stores the refresh token in the
+// given family.
+func (h *AuthHandler) tokenPair(user *model.User, familyID, refresh string, now time.Time) (gin.H, error) {
+	accessTTL, refreshTTL := h.AccessTTL, h.RefreshTTL
+	if accessTTL <= 0 {
+		accessTTL = defaultAccessTTL
+	}
+	if refreshTTL <= 0 {
+		refreshTTL = defaultRefreshTTL
+	}
+	jti := generateToken()
+	access, err := h.signAccessToken(user, jti, now, now.Add(accessTTL))
+	if err != nil {
+		return nil, err
+	}
+	if err := h.Tokens.RecordAccessToken(jti, user.ID, familyID, now.Add(accessTTL)); err != nil {
+		return nil, err
+	}
+	err = h.Tokens.CreateRefreshToken(&model.RefreshToken{
+		Hash:      hashToken(refresh),
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(refreshTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"token":         access,
+		"token_type":    "Bearer",
+		"expires_in":    int(accessTTL.Seconds()),
+		"refresh_token": refresh,
+	}, nil
+}
+
+// signAccessToken signs an access token carrying the user's role; users
+// who signed up themselves have none and are clients. jti is left out when
+// empty.
+func (h *AuthHandler) signAccessToken(user *model.User, jti string, now, exp time.Time) (string, error) {
+	role := user.Role
+	if role == "" {
+		role = "client"
+	}
+	claims := jwt.MapClaims{
+		"user_id": user.ID,
+		"role":    role,
+		"iat":     now.Unix(),
+		"exp":     exp.Unix(),
+	}
+	if jti != "" {
+		claims["jti"] = jti
+	}
+	return h.Keys.Sign(claims)
+}
+
+// hashToken is how refresh tokens are stored, so a leaked store does not
+// leak usable tokens.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GET /.well-known/jwks.json
+// The public keys our tokens are signed with, for other services to verify
+// them. Keys being rotated out stay listed until they are removed from the
+// configuration.
+func JWKS(keys *jwtkeys.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, keys.JWKS())
+	}
 }
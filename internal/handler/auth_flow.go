@@ -83,6 +83,13 @@ func (h *AuthFlowHandler) VerifyEmail(c *gin.Context) {
 	c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token"})
 }
 
+// GenerateSecret returns a random key for signing when none is configured.
+func GenerateSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 func generateToken() string {
 	b := make([]byte, 16)
 	rand.Read(b)
@@ -2,6 +2,8 @@ package handler
 
 import (
 	"bytes"
+	"deliverymanagement/internal/jwtkeys"
+	"deliverymanagement/internal/model"
 	"deliverymanagement/internal/repo"
 	"encoding/json"
 	"net/http"
@@ -10,11 +12,12 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func setupAuthRouter() (*gin.Engine, *repo.InMemoryUserRepo) {
 	repo := repo.NewInMemoryUserRepo()
-	h := &AuthHandler{Users: repo}
+	h := &AuthHandler{Users: repo, Keys: jwtkeys.NewHS256(testSecret)}
 	r := gin.Default()
 	r.POST("/api/auth/register", h.Register)
 	r.POST("/api/auth/login", h.Login)
@@ -55,3 +58,114 @@ func TestRegisterAndLogin(t *testing.T) {
 	r.ServeHTTP(w4, req4)
 	assert.Equal(t, 401, w4.Code)
 }
+
+func TestRefreshTokens(t *testing.T) {
+	users := repo.NewInMemoryUserRepo()
+	tokens := repo.NewInMemoryTokenRepo()
+	keys := jwtkeys.NewHS256(testSecret)
+	h := &AuthHandler{Users: users, Keys: keys, Tokens: tokens}
+	admin := &UserAdminHandler{Users: users, Tokens: tokens}
+	r := gin.Default()
+	r.POST("/api/auth/register", h.Register)
+	r.POST("/api/auth/login", h.Login)
+	r.POST("/api/auth/refresh", h.Refresh)
+	r.POST("/api/auth/logout", h.Logout)
+	r.PUT("/api/admin/users/:id", admin.UpdateUser)
+	r.GET("/me", JWTAuth(keys, tokens), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.GetUint("user_id")})
+	})
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+	type pair struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+	}
+	login := func() pair {
+		w := post("/api/auth/login", `{"email":"a@b.com","password":"pass"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var p pair
+		json.Unmarshal(w.Body.Bytes(), &p)
+		return p
+	}
+	refresh := func(token string) (int, pair) {
+		w := post("/api/auth/refresh", `{"refresh_token":"`+token+`"}`)
+		var p pair
+		json.Unmarshal(w.Body.Bytes(), &p)
+		return w.Code, p
+	}
+	me := func(token string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	post("/api/auth/register", `{"email":"a@b.com","password":"pass"}`)
+	first := login()
+	assert.Equal(t, 900, first.ExpiresIn)
+	assert.NotEmpty(t, first.RefreshToken)
+	assert.Equal(t, http.StatusOK, me(first.Token))
+
+	// Rotation: the new refresh token works once, the old one is used up.
+	code, second := refresh(first.RefreshToken)
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	assert.Equal(t, http.StatusOK, me(second.Token))
+
+	// Reuse of the old token revokes the whole family, access tokens too.
+	code, _ = refresh(first.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = refresh(second.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, http.StatusUnauthorized, me(second.Token))
+	assert.Equal(t, http.StatusUnauthorized, me(first.Token))
+
+	// Logout ends one login and leaves the others alone.
+	other, current := login(), login()
+	assert.Equal(t, http.StatusNoContent, post("/api/auth/logout", `{"refresh_token":"`+current.RefreshToken+`"}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, me(current.Token))
+	code, _ = refresh(current.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, http.StatusOK, me(other.Token))
+	assert.Equal(t, http.StatusNoContent, post("/api/auth/logout", `{"refresh_token":"unknown"}`).Code)
+
+	// Disabling the user revokes everything at once and blocks login.
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/api/admin/users/1", bytes.NewBufferString(`{"disabled":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, me(other.Token))
+	code, _ = refresh(other.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, http.StatusForbidden, post("/api/auth/login", `{"email":"a@b.com","password":"pass"}`).Code)
+}
+
+func TestLoginCarriesRole(t *testing.T) {
+	users := repo.NewInMemoryUserRepo()
+	keys := jwtkeys.NewHS256(testSecret)
+	h := &AuthHandler{Users: users, Keys: keys}
+	r := gin.Default()
+	r.POST("/api/auth/register", h.Register)
+	r.POST("/api/auth/login", h.Login)
+	r.GET("/api/admin/ping", JWTAuth(keys, nil), AdminOnly(), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	hash, _ := bcrypt.GenerateFromPassword([]byte("pass"), bcrypt.MinCost)
+	users.CreateUser(&model.User{Email: "admin@example.com", PasswordHash: string(hash), Role: "admin"})
+	serveJSON(r, "POST", "/api/auth/register", "", `{"email":"c@example.com","password":"pass"}`)
+	login := func(email string) string {
+		var resp struct{ Token string }
+		json.Unmarshal(serveJSON(r, "POST", "/api/auth/login", "", `{"email":"`+email+`","password":"pass"}`).Body.Bytes(), &resp)
+		return resp.Token
+	}
+
+	assert.Equal(t, http.StatusNoContent, serveJSON(r, "GET", "/api/admin/ping", login("admin@example.com"), nil).Code)
+	assert.Equal(t, http.StatusForbidden, serveJSON(r, "GET", "/api/admin/ping", login("c@example.com"), nil).Code)
+}
@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"deliverymanagement/internal/model"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultBulkAsyncThreshold = 100
+
+// bulkStatuses are the statuses a dispatcher may set in bulk. Assignment
+// needs a courier and goes through the assign action; delivered, returned
+// and cancelled deliveries go through their dedicated flows.
+var bulkStatuses = map[string]bool{"CREATED": true, "ON_HOLD": true}
+
+type bulkRequest struct {
+	Action     string   `json:"action" binding:"required,oneof=assign reassign status cancel tag"`
+	IDs        []uint   `json:"ids"`
+	CourierID  uint     `json:"courier_id"`
+	Status     string   `json:"status"`
+	Tags       []string `json:"tags"`
+	RemoveTags []string `json:"remove_tags"`
+	Reason     string   `json:"reason"`
+}
+
+// POST /api/deliveries/bulk (dispatcher only)
+// Applies one action to the deliveries listed in "ids" or, without ids, to
+// every delivery matching the list filters in the query string. Large
+// selections run in the background and return a job ID.
+func (h *DeliveryHandler) BulkUpdate(c *gin.Context) {
+	var req bulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	switch {
+	case (req.Action == "assign" || req.Action == "reassign") && req.CourierID == 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "courier_id is required"})
+		return
+	case req.Action == "status" && !bulkStatuses[req.Status]:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be CREATED or ON_HOLD"})
+		return
+	case req.Action == "tag" && len(req.Tags) == 0 && len(req.RemoveTags) == 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "tags or remove_tags is required"})
+		return
+	}
+	ids := req.IDs
+	if len(ids) == 0 {
+		// A filter that is misspelt or does not parse would select everything.
+		filtered, err := checkListFilters(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !filtered {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ids or a list filter is required"})
+			return
+		}
+		all, _ := h.Deliveries.ListDeliveries()
+		for _, d := range filterDeliveries(c, all) {
+			ids = append(ids, d.ID)
+		}
+	}
+	ids = uniqueIDs(ids)
+
+	job := &model.BulkJob{
+		ID:        fmt.Sprintf("job-%d", rand.Int63()),
+		Action:    req.Action,
+		Status:    "RUNNING",
+		Total:     len(ids),
+		Results:   make([]model.BulkItemResult, 0, len(ids)),
+		CreatedBy: c.GetUint("user_id"),
+		CreatedAt: time.Now(),
+	}
+	threshold := h.BulkAsyncThreshold
+	if threshold == 0 {
+		threshold = defaultBulkAsyncThreshold
+	}
+	if len(ids) > threshold && h.BulkJobs != nil {
+		h.BulkJobs.SaveJob(job)
+		go h.runBulk(job, req, ids)
+		c.JSON(http.StatusAccepted, gin.H{"job_id": job.ID, "total": job.Total})
+		return
+	}
+	h.runBulk(job, req, ids)
+	c.JSON(http.StatusOK, job)
+}
+
+// GET /api/deliveries/bulk/jobs/:job_id (dispatcher only)
+func (h *DeliveryHandler) GetBulkJob(c *gin.Context) {
+	if h.BulkJobs == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	job, err := h.BulkJobs.GetJob(c.Param("job_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+func (h *DeliveryHandler) runBulk(job *model.BulkJob, req bulkRequest, ids []uint) {
+	for i, id := range ids {
+		res := model.BulkItemResult{DeliveryID: id, OK: true}
+		d, err := h.Deliveries.GetDelivery(id)
+		if err == nil {
+			err = h.applyBulk(d, req, job.CreatedBy)
+		}
+		if err != nil {
+			res.OK = false
+			res.Error = err.Error()
+			job.Failed++
+		} else {
+			job.Succeeded++
+		}
+		job.Results = append(job.Results, res)
+		if d != nil && h.Audit != nil {
+			h.Audit.CreateAudit(&model.AuditLog{
+				UserID:    job.CreatedBy,
+				Action:    "bulk." + req.Action,
+				Resource:  fmt.Sprintf("delivery:%d", id),
+				Success:   res.OK,
+				Timestamp: time.Now().Unix(),
+			})
+		}
+		if h.BulkJobs != nil && i%50 == 49 {
+			h.BulkJobs.SaveJob(job)
+		}
+	}
+	job.Status = "DONE"
+	job.FinishedAt = time.Now()
+	if h.BulkJobs != nil {
+		h.BulkJobs.SaveJob(job)
+	}
+}
+
+// applyBulk performs the action on one delivery.
+func (h *DeliveryHandler) applyBulk(d *model.Delivery, req bulkRequest, actorID uint) error {
+	switch d.Status {
+	case "DELIVERED", "CANCELLED", "RETURN_TO_SENDER":
+		if req.Action != "tag" {
+			return errors.New("delivery is " + d.Status)
+		}
+	}
+	switch req.Action {
+	case "assign":
+		if d.CourierID != 0 {
+			return errors.New("already assigned, use reassign")
+		}
+		return h.assign(d, req.CourierID, 0, actorID)
+	case "reassign":
+		if d.CourierID == 0 {
+			return errors.New("not assigned yet, use assign")
+		}
+		if d.Status == "AT_PICKUP_POINT" {
+			return errors.New("delivery is " + d.Status)
+		}
+		return h.assign(d, req.CourierID, 0, actorID)
+	case "status":
+		// A locker compartment or a live handover code would be left behind.
+		switch d.Status {
+		case "OUT_FOR_DELIVERY", "AT_PICKUP_POINT":
+			return errors.New("delivery is " + d.Status)
+		}
+		from := d.Status
+		d.Status = req.Status
+		if req.Status == "CREATED" {
+			// Back to the start: no longer with a courier or on a vehicle.
+			d.CourierID, d.VehicleID = 0, 0
+		}
+		if err := h.Deliveries.UpdateDelivery(d); err != nil {
+			return err
+		}
+		recordTimeline(h.Timeline, d.ID, actorID, "status_changed",
+			fmt.Sprintf("Status changed from %s to %s", from, req.Status),
+			map[string]interface{}{"from": from, "to": req.Status, "reason": req.Reason})
+	case "cancel":
+		switch d.Status {
+		case "OUT_FOR_DELIVERY", "AT_PICKUP_POINT":
+			return errors.New("delivery is " + d.Status)
+		}
+		d.Status = "CANCELLED"
+		if err := h.Deliveries.UpdateDelivery(d); err != nil {
+			return err
+		}
+		recordTimeline(h.Timeline, d.ID, actorID, "cancelled", "Cancelled by dispatcher: "+req.Reason, nil)
+	case "tag":
+		d.Tags = mergeTags(d.Tags, req.Tags, req.RemoveTags)
+		if err := h.Deliveries.UpdateDelivery(d); err != nil {
+			return err
+		}
+		recordTimeline(h.Timeline, d.ID, actorID, "tagged", "Tags updated",
+			map[string]interface{}{"added": req.Tags, "removed": req.RemoveTags})
+	}
+	return nil
+}
+
+// mergeTags adds and removes tags, keeping the existing order and no duplicates.
+func mergeTags(tags, add, remove []string) []string {
+	drop := map[string]bool{}
+	for _, t := range remove {
+		drop[t] = true
+	}
+	seen := map[string]bool{}
+	out := []string{}
+	for _, t := range append(append([]string(nil), tags...), add...) {
+		if t == "" || drop[t] || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return out
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := map[uint]bool{}
+	out := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkOperations(t *testing.T) {
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	audit := repo.NewInMemoryAuditLogRepo()
+	jobs := repo.NewInMemoryBulkJobRepo()
+	dh := &DeliveryHandler{Deliveries: deliveries, Audit: audit, BulkJobs: jobs, BulkAsyncThreshold: 3}
+	r := gin.Default()
+	api := r.Group("/api", JWTAuthMiddleware(testSecret), DispatcherOnly())
+	api.POST("/deliveries/bulk", dh.BulkUpdate)
+	api.GET("/deliveries/bulk/jobs/:job_id", dh.GetBulkJob)
+	do := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		return serveJSON(r, method, path, makeDispatcherJWT(9), body)
+	}
+	for _, status := range []string{"CREATED", "CREATED", "DELIVERED"} {
+		deliveries.CreateDelivery(&model.Delivery{Status: status})
+	}
+
+	assert.Equal(t, 400, do("POST", "/api/deliveries/bulk", map[string]interface{}{"action": "cancel"}).Code)
+	assert.Equal(t, 400, do("POST", "/api/deliveries/bulk", map[string]interface{}{"action": "assign", "ids": []uint{1}}).Code)
+	assert.Equal(t, 400, do("POST", "/api/deliveries/bulk", map[string]interface{}{"action": "status", "ids": []uint{1}, "status": "DELIVERED"}).Code)
+	assert.Equal(t, 400, do("POST", "/api/deliveries/bulk", map[string]interface{}{"action": "status", "ids": []uint{1}, "status": "ASSIGNED"}).Code)
+	// Filters that are unknown, empty or do not parse never select everything
+	for _, q := range []string{"?zone=3", "?x=1", "?status=", "?zone_id=abc", "?courier_id=-1"} {
+		assert.Equal(t, 400, do("POST", "/api/deliveries/bulk"+q, map[string]interface{}{"action": "cancel"}).Code, q)
+	}
+	d, _ := deliveries.GetDelivery(2)
+	assert.Equal(t, "CREATED", d.Status)
+
+	w := do("POST", "/api/deliveries/bulk", map[string]interface{}{"action": "assign", "ids": []uint{1, 3, 42, 1}, "courier_id": 5})
+	assert.Equal(t, 200, w.Code)
+	var job model.BulkJob
+	json.Unmarshal(w.Body.Bytes(), &job)
+	assert.Equal(t, 3, job.Total)
+	assert.Equal(t, 1, job.Succeeded)
+	assert.Equal(t, 2, job.Failed)
+	assert.Contains(t, job.Results[1].Error, "DELIVERED")
+	assert.Equal(t, "delivery not found", job.Results[2].Error)
+	d, _ = deliveries.GetDelivery(1)
+	assert.Equal(t, "ASSIGNED", d.Status)
+	assert.Equal(t, uint(5), d.CourierID)
+
+	// Assigning again is refused, reassigning is fine
+	json.Unmarshal(do("POST", "/api/deliveries/bulk", map[string]interface{}{"action": "assign", "ids": []uint{1}, "courier_id": 6}).Body.Bytes(), &job)
+	assert.Equal(t, 1, job.Failed)
+	json.Unmarshal(do("POST", "/api/deliveries/bulk", map[string]interface{}{"action": "reassign", "ids": []uint{1}, "courier_id": 6}).Body.Bytes(), &job)
+	assert.Equal(t, 1, job.Succeeded)
+
+	// Selection by filter: cancel whatever is still CREATED
+	json.Unmarshal(do("POST", "/api/deliveries/bulk?status=CREATED", map[string]interface{}{"action": "cancel", "reason": "client closed"}).Body.Bytes(), &job)
+	assert.Equal(t, 1, job.Total)
+	d, _ = deliveries.GetDelivery(2)
+	assert.Equal(t, "CANCELLED", d.Status)
+
+	json.Unmarshal(do("POST", "/api/deliveries/bulk", map[string]interface{}{"action": "tag", "ids": []uint{1, 3}, "tags": []string{"vip", "fragile"}}).Body.Bytes(), &job)
+	assert.Equal(t, 2, job.Succeeded)
+	json.Unmarshal(do("POST", "/api/deliveries/bulk", map[string]interface{}{"action": "tag", "ids": []uint{1}, "tags": []string{"vip"}, "remove_tags": []string{"fragile"}}).Body.Bytes(), &job)
+	d, _ = deliveries.GetDelivery(1)
+	assert.Equal(t, []string{"vip"}, d.Tags)
+
+	logs, _ := audit.ListAuditLogs()
+	assert.Len(t, logs, 8) // none for the unknown delivery
+	assert.Equal(t, "bulk.assign", logs[0].Action)
+	assert.Equal(t, "delivery:1", logs[0].Resource)
+	assert.False(t, logs[1].Success)
+
+	// Above the threshold the job runs in the background
+	for i := 0; i < 4; i++ {
+		deliveries.CreateDelivery(&model.Delivery{Status: "CREATED"})
+	}
+	w = do("POST", "/api/deliveries/bulk?status=CREATED", map[string]interface{}{"action": "status", "status": "ON_HOLD"})
+	assert.Equal(t, 202, w.Code)
+	var accepted struct {
+		JobID string `json:"job_id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &accepted)
+	assert.Eventually(t, func() bool {
+		w := do("GET", "/api/deliveries/bulk/jobs/"+accepted.JobID, nil)
+		json.Unmarshal(w.Body.Bytes(), &job)
+		return w.Code == 200 && job.Status == "DONE"
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 4, job.Succeeded)
+	assert.Equal(t, 404, do("GET", "/api/deliveries/bulk/jobs/job-0", nil).Code)
+
+	// Going back to CREATED takes the delivery off its courier and vehicle
+	deliveries.CreateDelivery(&model.Delivery{Status: "ASSIGNED", CourierID: 5, VehicleID: 2})
+	json.Unmarshal(do("POST", "/api/deliveries/bulk", map[string]interface{}{"action": "status", "ids": []uint{8}, "status": "CREATED"}).Body.Bytes(), &job)
+	assert.Equal(t, 1, job.Succeeded)
+	d, _ = deliveries.GetDelivery(8)
+	assert.Equal(t, uint(0), d.CourierID)
+	assert.Equal(t, uint(0), d.VehicleID)
+
+	// Parcels in a locker or out for handover keep their status
+	out := &model.Delivery{Status: "OUT_FOR_DELIVERY"}
+	locker := &model.Delivery{Status: "AT_PICKUP_POINT"}
+	deliveries.CreateDelivery(out)
+	deliveries.CreateDelivery(locker)
+	json.Unmarshal(do("POST", "/api/deliveries/bulk", map[string]interface{}{"action": "status", "ids": []uint{out.ID, locker.ID}, "status": "CREATED"}).Body.Bytes(), &job)
+	assert.Equal(t, 2, job.Failed)
+	d, _ = deliveries.GetDelivery(locker.ID)
+	assert.Equal(t, "AT_PICKUP_POINT", d.Status)
+}
@@ -0,0 +1,446 @@
+package handler
+
+import (
+	"deliverymanagement/internal/email"
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"deliverymanagement/pkg/rabbitmq"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+// ClaimHandler runs damage claims through review:
+// SUBMITTED → UNDER_REVIEW → APPROVED or REJECTED, and APPROVED → PAID.
+type ClaimHandler struct {
+	Claims     repo.DamageClaimRepository
+	Deliveries repo.DeliveryRepository
+	// Users, Notifications and Publisher tell the client and the reporter
+	// about progress; all optional.
+	Users         repo.UserRepository
+	Notifications *NotificationHandler
+	Publisher     rabbitmq.Publisher
+	Timeline      repo.TimelineRepository
+}
+
+// Open creates the claim for a new damage report. A claimed amount of 0
+// claims the full declared value.
+func (h *ClaimHandler) Open(report *model.DamageReport, d *model.Delivery, claimed int64) (*model.DamageClaim, error) {
+	if claimed == 0 {
+		claimed = d.DeclaredValue
+	}
+	claim := &model.DamageClaim{
+		ReportID:      report.ID,
+		DeliveryID:    d.ID,
+		ClientID:      d.ClientID,
+		ReporterID:    report.ReporterID,
+		Status:        model.ClaimSubmitted,
+		ClaimedAmount: claimed,
+		Currency:      d.DeclaredCurrency,
+		SubmittedAt:   report.Timestamp,
+	}
+	if err := h.Claims.CreateClaim(claim); err != nil {
+		return nil, err
+	}
+	recordTimeline(h.Timeline, d.ID, report.ReporterID, "claim.submitted",
+		fmt.Sprintf("Damage claim #%d submitted for %s", claim.ID, formatAmount(claim.ClaimedAmount, claim.Currency)),
+		map[string]interface{}{"claim_id": claim.ID, "report_id": report.ID})
+	h.emailClient(claim, "damage_reported.html", "Damage reported for your delivery", nil)
+	return claim, nil
+}
+
+// load returns the claim and writes 404 when it does not exist. Clients may
+// only see their own claims and reporters the ones they raised.
+func (h *ClaimHandler) load(c *gin.Context) *model.DamageClaim {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return nil
+	}
+	claim, err := h.Claims.GetClaim(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return nil
+	}
+	userID := c.GetUint("user_id")
+	switch c.GetString("role") {
+	case "dispatcher", "admin":
+	default:
+		if claim.ClientID != userID && claim.ReporterID != userID {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+			return nil
+		}
+	}
+	return claim
+}
+
+// GET /api/claims/:id
+func (h *ClaimHandler) GetClaim(c *gin.Context) {
+	if claim := h.load(c); claim != nil {
+		c.JSON(http.StatusOK, claim)
+	}
+}
+
+// GET /api/claims?status=&reviewer_id=
+// Reviewers see every claim, everyone else the claims they are part of.
+func (h *ClaimHandler) ListClaims(c *gin.Context) {
+	c.JSON(http.StatusOK, h.filterClaims(c))
+}
+
+func (h *ClaimHandler) filterClaims(c *gin.Context) []model.DamageClaim {
+	all, _ := h.Claims.ListClaims()
+	role, userID := c.GetString("role"), c.GetUint("user_id")
+	status := c.Query("status")
+	reviewerID, reviewerErr := strconv.ParseUint(c.Query("reviewer_id"), 10, 64)
+	out := make([]model.DamageClaim, 0, len(all))
+	for _, cl := range all {
+		if role != "dispatcher" && role != "admin" && cl.ClientID != userID && cl.ReporterID != userID {
+			continue
+		}
+		if status != "" && cl.Status != status {
+			continue
+		}
+		if reviewerErr == nil && cl.ReviewerID != uint(reviewerID) {
+			continue
+		}
+		out = append(out, cl)
+	}
+	return out
+}
+
+// POST /api/claims/:id/assign (dispatcher or admin)
+// Body: {"reviewer_id": 7}. Puts a submitted claim under review, or hands a
+// claim under review to another reviewer.
+func (h *ClaimHandler) AssignReviewer(c *gin.Context) {
+	claim := h.load(c)
+	if claim == nil {
+		return
+	}
+	var req struct {
+		ReviewerID uint `json:"reviewer_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	if claim.Status != model.ClaimSubmitted && claim.Status != model.ClaimUnderReview {
+		c.JSON(http.StatusConflict, gin.H{"error": "claim is " + claim.Status})
+		return
+	}
+	if reviewer := userByID(h.Users, req.ReviewerID); h.Users != nil && (reviewer == nil || (reviewer.Role != "dispatcher" && reviewer.Role != "admin")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reviewer must be a dispatcher or admin"})
+		return
+	}
+	first := claim.Status == model.ClaimSubmitted
+	claim.ReviewerID = req.ReviewerID
+	claim.Status = model.ClaimUnderReview
+	if !h.save(c, claim, "claim.under_review", fmt.Sprintf("Claim #%d assigned to reviewer #%d", claim.ID, req.ReviewerID)) {
+		return
+	}
+	h.notify(req.ReviewerID, claim, "claim.assigned", fmt.Sprintf("Damage claim #%d was assigned to you", claim.ID))
+	if first {
+		h.emailClient(claim, "damage_claim_under_review.html", "Your damage claim is under review", nil)
+	}
+	c.JSON(http.StatusOK, claim)
+}
+
+// POST /api/claims/:id/evidence-requests (assigned reviewer)
+// Body: {"message": "..."}. Asks the reporter for more evidence; only one
+// request can be open at a time.
+func (h *ClaimHandler) RequestEvidence(c *gin.Context) {
+	claim := h.loadForReviewer(c)
+	if claim == nil {
+		return
+	}
+	var req struct {
+		Message string `json:"message" binding:"required,max=2000"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	if claim.OpenEvidenceRequest() >= 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "an evidence request is already open"})
+		return
+	}
+	claim.EvidenceRequests = append(claim.EvidenceRequests, model.EvidenceRequest{
+		Message:     req.Message,
+		RequestedBy: c.GetUint("user_id"),
+		RequestedAt: time.Now(),
+	})
+	if !h.save(c, claim, "claim.evidence_requested", "Evidence requested: "+req.Message) {
+		return
+	}
+	h.notify(claim.ReporterID, claim, "claim.evidence_requested",
+		fmt.Sprintf("More evidence is needed for damage claim #%d: %s", claim.ID, req.Message))
+	if to := userByID(h.Users, claim.ReporterID); to != nil {
+		h.sendEmail(to, claim, "damage_claim_evidence_requested.html", "More evidence needed for your damage claim",
+			map[string]interface{}{"Message": req.Message})
+	}
+	c.JSON(http.StatusOK, claim)
+}
+
+// POST /api/claims/:id/evidence (reporter)
+// Body: {"response": "..."}. Answers the open evidence request.
+func (h *ClaimHandler) SubmitEvidence(c *gin.Context) {
+	claim := h.load(c)
+	if claim == nil {
+		return
+	}
+	var req struct {
+		Response string `json:"response" binding:"required,max=5000"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	if claim.ReporterID != c.GetUint("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the reporter can submit evidence"})
+		return
+	}
+	i := claim.OpenEvidenceRequest()
+	if i < 0 || claim.Status != model.ClaimUnderReview {
+		c.JSON(http.StatusConflict, gin.H{"error": "no evidence was requested"})
+		return
+	}
+	claim.EvidenceRequests[i].Response = req.Response
+	claim.EvidenceRequests[i].RespondedAt = time.Now()
+	if !h.save(c, claim, "claim.evidence_submitted", "Evidence submitted") {
+		return
+	}
+	h.notify(claim.ReviewerID, claim, "claim.evidence_submitted", fmt.Sprintf("Evidence was submitted for damage claim #%d", claim.ID))
+	c.JSON(http.StatusOK, claim)
+}
+
+// POST /api/claims/:id/decision (assigned reviewer)
+// Body: {"decision": "approve"|"reject", "approved_amount": 1000, "notes": "..."}.
+// The approved amount defaults to the claimed amount and cannot exceed it.
+func (h *ClaimHandler) Decide(c *gin.Context) {
+	claim := h.loadForReviewer(c)
+	if claim == nil {
+		return
+	}
+	var req struct {
+		Decision       string `json:"decision" binding:"required,oneof=approve reject"`
+		ApprovedAmount *int64 `json:"approved_amount"`
+		Notes          string `json:"notes" binding:"max=5000"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	if claim.OpenEvidenceRequest() >= 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "waiting for requested evidence"})
+		return
+	}
+	template, subject := "damage_claim_approved.html", "Your damage claim was approved"
+	if req.Decision == "reject" {
+		if req.Notes == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "notes are required when rejecting"})
+			return
+		}
+		claim.Status = model.ClaimRejected
+		claim.ApprovedAmount = 0
+		template, subject = "damage_claim_rejected.html", "Your damage claim was rejected"
+	} else {
+		amount := claim.ClaimedAmount
+		if req.ApprovedAmount != nil {
+			amount = *req.ApprovedAmount
+		}
+		if amount <= 0 || amount > claim.ClaimedAmount {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "approved_amount must be positive and at most the claimed amount"})
+			return
+		}
+		claim.Status = model.ClaimApproved
+		claim.ApprovedAmount = amount
+	}
+	claim.DecisionNotes = req.Notes
+	claim.DecidedAt = time.Now()
+	outcome := strings.ToLower(claim.Status)
+	if !h.save(c, claim, "claim."+outcome, fmt.Sprintf("Claim #%d %s", claim.ID, outcome)) {
+		return
+	}
+	h.emailClient(claim, template, subject, nil)
+	c.JSON(http.StatusOK, claim)
+}
+
+// POST /api/claims/:id/pay (dispatcher or admin)
+// Body: {"payment_reference": "..."}. Records the payout of an approved claim.
+func (h *ClaimHandler) MarkPaid(c *gin.Context) {
+	claim := h.load(c)
+	if claim == nil {
+		return
+	}
+	var req struct {
+		PaymentReference string `json:"payment_reference" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	if claim.Status != model.ClaimApproved {
+		c.JSON(http.StatusConflict, gin.H{"error": "only approved claims can be paid"})
+		return
+	}
+	claim.Status = model.ClaimPaid
+	claim.PaymentReference = req.PaymentReference
+	claim.PaidAt = time.Now()
+	if !h.save(c, claim, "claim.paid", fmt.Sprintf("Claim #%d paid: %s", claim.ID, formatAmount(claim.ApprovedAmount, claim.Currency))) {
+		return
+	}
+	h.emailClient(claim, "damage_claim_paid.html", "Your damage claim was paid", nil)
+	c.JSON(http.StatusOK, claim)
+}
+
+// GET /api/claims/export?format=csv|xlsx&status= (dispatcher or admin)
+// One row per claim for finance, amounts in major units.
+func (h *ClaimHandler) ExportClaims(c *gin.Context) {
+	claims := h.filterClaims(c)
+	header := []string{"ClaimID", "DeliveryID", "ClientID", "Status", "Currency", "ClaimedAmount", "ApprovedAmount",
+		"ReviewerID", "SubmittedAt", "DecidedAt", "PaidAt", "PaymentReference"}
+	row := func(cl model.DamageClaim) []string {
+		return []string{
+			strconv.Itoa(int(cl.ID)), strconv.Itoa(int(cl.DeliveryID)), strconv.Itoa(int(cl.ClientID)), cl.Status, cl.Currency,
+			majorUnits(cl.ClaimedAmount), majorUnits(cl.ApprovedAmount), strconv.Itoa(int(cl.ReviewerID)),
+			formatTime(cl.SubmittedAt), formatTime(cl.DecidedAt), formatTime(cl.PaidAt), cl.PaymentReference,
+		}
+	}
+	switch c.DefaultQuery("format", "csv") {
+	case "csv":
+		c.Header("Content-Disposition", "attachment; filename=claims.csv")
+		c.Header("Content-Type", "text/csv")
+		w := csv.NewWriter(c.Writer)
+		w.Write(header)
+		for _, cl := range claims {
+			w.Write(row(cl))
+		}
+		w.Flush()
+	case "xlsx":
+		f := excelize.NewFile()
+		f.SetSheetRow("Sheet1", "A1", &header)
+		for i, cl := range claims {
+			r := row(cl)
+			f.SetSheetRow("Sheet1", fmt.Sprintf("A%d", i+2), &r)
+		}
+		c.Header("Content-Disposition", "attachment; filename=claims.xlsx")
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		f.Write(c.Writer)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid format"})
+	}
+}
+
+// loadForReviewer is load for actions reserved to the assigned reviewer of a
+// claim under review.
+func (h *ClaimHandler) loadForReviewer(c *gin.Context) *model.DamageClaim {
+	claim := h.load(c)
+	if claim == nil {
+		return nil
+	}
+	if claim.Status != model.ClaimUnderReview {
+		c.JSON(http.StatusConflict, gin.H{"error": "claim is " + claim.Status})
+		return nil
+	}
+	if claim.ReviewerID != c.GetUint("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the assigned reviewer can do this"})
+		return nil
+	}
+	return claim
+}
+
+func (h *ClaimHandler) save(c *gin.Context, claim *model.DamageClaim, event, msg string) bool {
+	if err := h.Claims.UpdateClaim(claim); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, repo.ErrClaimConflict) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return false
+	}
+	recordTimeline(h.Timeline, claim.DeliveryID, c.GetUint("user_id"), event, msg,
+		map[string]interface{}{"claim_id": claim.ID, "status": claim.Status})
+	return true
+}
+
+func (h *ClaimHandler) notify(userID uint, claim *model.DamageClaim, typ, msg string) {
+	if h.Notifications == nil || userID == 0 {
+		return
+	}
+	h.Notifications.PublishNotification(&model.Notification{
+		UserID:    uint64(userID),
+		Type:      typ,
+		Message:   msg,
+		Data:      map[string]interface{}{"claim_id": claim.ID, "delivery_id": claim.DeliveryID},
+		CreatedAt: time.Now(),
+	})
+}
+
+// emailClient emails the client who booked the delivery.
+func (h *ClaimHandler) emailClient(claim *model.DamageClaim, template, subject string, extra map[string]interface{}) {
+	if to := userByID(h.Users, claim.ClientID); to != nil {
+		h.sendEmail(to, claim, template, subject, extra)
+	}
+}
+
+// sendEmail renders one of the damage templates and queues the email. When
+// the template cannot be rendered the subject goes out as plain text.
+func (h *ClaimHandler) sendEmail(to *model.User, claim *model.DamageClaim, template, subject string, extra map[string]interface{}) {
+	if h.Publisher == nil {
+		return
+	}
+	data := map[string]interface{}{
+		"RecipientName":  to.Name,
+		"DeliveryID":     claim.DeliveryID,
+		"ClaimID":        claim.ID,
+		"ClaimedAmount":  formatAmount(claim.ClaimedAmount, claim.Currency),
+		"ApprovedAmount": formatAmount(claim.ApprovedAmount, claim.Currency),
+		"DecisionNotes":  claim.DecisionNotes,
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+	body, err := email.RenderTemplate(template, data)
+	if err != nil {
+		body = fmt.Sprintf("%s (claim #%d, delivery #%d).", subject, claim.ID, claim.DeliveryID)
+	}
+	h.Publisher.Publish("email.queue", map[string]interface{}{
+		"to":      to.Email,
+		"subject": subject,
+		"body":    body,
+	})
+}
+
+func userByID(users repo.UserRepository, id uint) *model.User {
+	if users == nil {
+		return nil
+	}
+	list, _ := users.ListUsers()
+	for _, u := range list {
+		if u.ID == id {
+			return u
+		}
+	}
+	return nil
+}
+
+func majorUnits(amount int64) string {
+	return fmt.Sprintf("%d.%02d", amount/100, amount%100)
+}
+
+func formatAmount(amount int64, currency string) string {
+	return majorUnits(amount) + " " + currency
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
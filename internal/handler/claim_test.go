@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"bytes"
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"deliverymanagement/internal/storage"
+	"deliverymanagement/pkg/rabbitmq"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDamageClaimWorkflow(t *testing.T) {
+	users := repo.NewInMemoryUserRepo()
+	client := &model.User{Email: "client@example.com", Name: "Client", Role: "client"}
+	courier := &model.User{Email: "courier@example.com", Name: "Courier", Role: "courier"}
+	reviewer := &model.User{Email: "reviewer@example.com", Name: "Reviewer", Role: "dispatcher"}
+	users.CreateUser(client)
+	users.CreateUser(courier)
+	users.CreateUser(reviewer)
+
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	d := &model.Delivery{ClientID: client.ID, CourierID: courier.ID, Status: "IN_TRANSIT", DeclaredValue: 50000, DeclaredCurrency: "KZT"}
+	deliveries.CreateDelivery(d)
+	notifications := repo.NewInMemoryNotificationRepo()
+	pub := &rabbitmq.FakePublisher{}
+	claims := &ClaimHandler{
+		Claims:        repo.NewInMemoryDamageClaimRepo(),
+		Deliveries:    deliveries,
+		Users:         users,
+		Notifications: &NotificationHandler{Notifications: notifications},
+		Publisher:     pub,
+	}
+	reports := &DamageReportHandler{DamageReports: repo.NewInMemoryDamageReportRepo(), Blobs: storage.NewMemoryStore(), Claims: claims}
+
+	r := gin.Default()
+	auth := JWTAuthMiddleware(testSecret)
+	r.POST("/api/damage-report", auth, reports.CreateDamageReport)
+	r.GET("/api/claims", auth, claims.ListClaims)
+	r.GET("/api/claims/export", auth, DispatcherOrAdminOnly(), claims.ExportClaims)
+	r.GET("/api/claims/:id", auth, claims.GetClaim)
+	r.POST("/api/claims/:id/assign", auth, DispatcherOrAdminOnly(), claims.AssignReviewer)
+	r.POST("/api/claims/:id/evidence-requests", auth, DispatcherOrAdminOnly(), claims.RequestEvidence)
+	r.POST("/api/claims/:id/evidence", auth, claims.SubmitEvidence)
+	r.POST("/api/claims/:id/decision", auth, DispatcherOrAdminOnly(), claims.Decide)
+	r.POST("/api/claims/:id/pay", auth, DispatcherOrAdminOnly(), claims.MarkPaid)
+
+	report := func(amount string) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		mw := multipart.NewWriter(&b)
+		mw.WriteField("delivery_id", fmt.Sprint(d.ID))
+		mw.WriteField("type", "broken")
+		mw.WriteField("claimed_amount", amount)
+		fw, _ := mw.CreateFormFile("photo", "p.jpg")
+		fw.Write(testJPEG())
+		mw.Close()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/damage-report", &b)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+makeCourierJWT(courier.ID))
+		r.ServeHTTP(w, req)
+		return w
+	}
+	call := func(method, path, token, body string) *httptest.ResponseRecorder {
+		return serveJSON(r, method, path, token, body)
+	}
+	claimOf := func(w *httptest.ResponseRecorder) model.DamageClaim {
+		var c model.DamageClaim
+		json.Unmarshal(w.Body.Bytes(), &c)
+		return c
+	}
+	dispatcher := makeDispatcherJWT(reviewer.ID)
+
+	// The claim is capped by the declared value
+	assert.Equal(t, 422, report("60000").Code)
+	w := report("40000")
+	assert.Equal(t, 200, w.Code)
+	var rep model.DamageReport
+	json.Unmarshal(w.Body.Bytes(), &rep)
+	assert.Equal(t, uint(1), rep.ClaimID)
+	assert.Equal(t, "client@example.com", pub.Messages[0].Body.(map[string]interface{})["to"])
+
+	claim := claimOf(call("GET", "/api/claims/1", makeJWT(client.ID), ""))
+	assert.Equal(t, model.ClaimSubmitted, claim.Status)
+	assert.Equal(t, int64(40000), claim.ClaimedAmount)
+	assert.Equal(t, courier.ID, claim.ReporterID)
+	assert.Equal(t, 404, call("GET", "/api/claims/1", makeJWT(99), "").Code)
+	assert.Equal(t, 403, call("POST", "/api/claims/1/assign", makeJWT(client.ID), `{"reviewer_id": 3}`).Code)
+
+	// Deciding needs an assigned reviewer
+	assert.Equal(t, 409, call("POST", "/api/claims/1/decision", dispatcher, `{"decision": "approve"}`).Code)
+	assert.Equal(t, 400, call("POST", "/api/claims/1/assign", dispatcher, fmt.Sprintf(`{"reviewer_id": %d}`, courier.ID)).Code)
+	w = call("POST", "/api/claims/1/assign", dispatcher, fmt.Sprintf(`{"reviewer_id": %d}`, reviewer.ID))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, model.ClaimUnderReview, claimOf(w).Status)
+	assert.Equal(t, 403, call("POST", "/api/claims/1/decision", makeDispatcherJWT(42), `{"decision": "approve"}`).Code)
+
+	// Evidence requests go back to the reporter and block the decision
+	assert.Equal(t, 200, call("POST", "/api/claims/1/evidence-requests", dispatcher, `{"message": "Photo of the box please"}`).Code)
+	list, _ := notifications.ListNotifications(uint64(courier.ID))
+	assert.Len(t, list, 1)
+	assert.Equal(t, "claim.evidence_requested", list[0].Type)
+	assert.Equal(t, 409, call("POST", "/api/claims/1/decision", dispatcher, `{"decision": "approve"}`).Code)
+	assert.Equal(t, 403, call("POST", "/api/claims/1/evidence", makeJWT(client.ID), `{"response": "here"}`).Code)
+	w = call("POST", "/api/claims/1/evidence", makeCourierJWT(courier.ID), `{"response": "Uploaded"}`)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "Uploaded", claimOf(w).EvidenceRequests[0].Response)
+
+	// Approval cannot exceed the claimed amount, rejection needs notes
+	assert.Equal(t, 400, call("POST", "/api/claims/1/decision", dispatcher, `{"decision": "approve", "approved_amount": 45000}`).Code)
+	assert.Equal(t, 400, call("POST", "/api/claims/1/decision", dispatcher, `{"decision": "reject"}`).Code)
+	assert.Equal(t, 409, call("POST", "/api/claims/1/pay", dispatcher, `{"payment_reference": "TX-1"}`).Code)
+	w = call("POST", "/api/claims/1/decision", dispatcher, `{"decision": "approve", "approved_amount": 30000, "notes": "Partial"}`)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, model.ClaimApproved, claimOf(w).Status)
+	w = call("POST", "/api/claims/1/pay", dispatcher, `{"payment_reference": "TX-1"}`)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, model.ClaimPaid, claimOf(w).Status)
+	assert.Equal(t, 409, call("POST", "/api/claims/1/pay", dispatcher, `{"payment_reference": "TX-2"}`).Code)
+
+	subjects := []string{}
+	for _, m := range pub.Messages {
+		if body, ok := m.Body.(map[string]interface{}); ok && body["subject"] != nil {
+			subjects = append(subjects, body["subject"].(string))
+		}
+	}
+	assert.Contains(t, subjects, "Your damage claim was approved")
+	assert.Contains(t, subjects, "Your damage claim was paid")
+	assert.Contains(t, subjects, "More evidence needed for your damage claim")
+
+	// Finance export
+	w = call("GET", "/api/claims/export?status=PAID", dispatcher, "")
+	assert.Equal(t, 200, w.Code)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[1], "PAID,KZT,400.00,300.00")
+	assert.Contains(t, lines[1], "TX-1")
+	assert.Equal(t, 403, call("GET", "/api/claims/export", makeJWT(client.ID), "").Code)
+}
+
+type failingClaimRepo struct{ repo.DamageClaimRepository }
+
+func (failingClaimRepo) CreateClaim(*model.DamageClaim) error {
+	return errors.New("claims unavailable")
+}
+
+func TestDamageReportRemovedWhenClaimFails(t *testing.T) {
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	d := &model.Delivery{ClientID: 1, CourierID: 2, Status: "IN_TRANSIT", DeclaredValue: 50000}
+	deliveries.CreateDelivery(d)
+	reportRepo := repo.NewInMemoryDamageReportRepo()
+	claims := &ClaimHandler{Claims: failingClaimRepo{repo.NewInMemoryDamageClaimRepo()}, Deliveries: deliveries}
+	reports := &DamageReportHandler{DamageReports: reportRepo, Blobs: storage.NewMemoryStore(), Claims: claims}
+	r := gin.Default()
+	r.POST("/api/damage-report", JWTAuthMiddleware(testSecret), reports.CreateDamageReport)
+
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	mw.WriteField("delivery_id", fmt.Sprint(d.ID))
+	mw.WriteField("type", "broken")
+	fw, _ := mw.CreateFormFile("photo", "p.jpg")
+	fw.Write(testJPEG())
+	mw.Close()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/damage-report", &b)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+makeCourierJWT(2))
+	r.ServeHTTP(w, req)
+
+	// A retry after the failure must not find a report left behind
+	assert.Equal(t, 500, w.Code)
+	assert.Empty(t, reportRepo.ListDamageReports(d.ID))
+}
@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+type CODHandler struct {
+	Deliveries repo.DeliveryRepository
+	COD        repo.CODRepository
+}
+
+// POST /api/cod/remittances (dispatcher only)
+// Records cash a courier handed over at the hub.
+func (h *CODHandler) CreateRemittance(c *gin.Context) {
+	var req struct {
+		CourierID  uint   `json:"courier_id" binding:"required"`
+		Amount     int64  `json:"amount" binding:"required,gt=0"`
+		Currency   string `json:"currency"`
+		RemittedAt string `json:"remitted_at"` // RFC 3339, defaults to now
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	if req.Currency == "" {
+		req.Currency = defaultCurrency
+	}
+	if !currencyRe.MatchString(req.Currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid currency"})
+		return
+	}
+	remittedAt := time.Now()
+	if req.RemittedAt != "" {
+		t, err := time.Parse(time.RFC3339, req.RemittedAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid remitted_at"})
+			return
+		}
+		remittedAt = t
+	}
+	rem := &model.CODRemittance{
+		CourierID:  req.CourierID,
+		Amount:     req.Amount,
+		Currency:   req.Currency,
+		RecordedBy: c.GetUint("user_id"),
+		RemittedAt: remittedAt,
+	}
+	if err := h.COD.CreateRemittance(rem); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rem)
+}
+
+// CourierReconciliation compares, for one courier and currency on one day,
+// what should have been collected, what was collected and what was remitted.
+type CourierReconciliation struct {
+	CourierID     uint     `json:"courier_id"`
+	Currency      string   `json:"currency"`
+	Expected      int64    `json:"expected"`
+	Collected     int64    `json:"collected"`
+	CollectedCash int64    `json:"collected_cash"`
+	CollectedCard int64    `json:"collected_card"`
+	Remitted      int64    `json:"remitted"`
+	Discrepancies []string `json:"discrepancies"`
+}
+
+// GET /api/cod/reconciliation?date=YYYY-MM-DD (dispatcher only)
+// Card payments settle through the acquirer, so only cash is expected back
+// as a remittance.
+func (h *CODHandler) Reconciliation(c *gin.Context) {
+	from, to, ok := parseDay(c, c.DefaultQuery("date", time.Now().UTC().Format("2006-01-02")))
+	if !ok {
+		return
+	}
+	type key struct {
+		courier  uint
+		currency string
+	}
+	rows := map[key]*CourierReconciliation{}
+	row := func(k key) *CourierReconciliation {
+		if rows[k] == nil {
+			rows[k] = &CourierReconciliation{CourierID: k.courier, Currency: k.currency, Discrepancies: []string{}}
+		}
+		return rows[k]
+	}
+	deliveries, _ := h.Deliveries.ListDeliveries()
+	for _, d := range deliveries {
+		if d.Status == "DELIVERED" && d.CODAmount > 0 && !d.DeliveredAt.Before(from) && d.DeliveredAt.Before(to) {
+			row(key{d.CourierID, d.CODCurrency}).Expected += d.CODAmount
+		}
+	}
+	collections, _ := h.COD.ListCollections(from, to)
+	for _, col := range collections {
+		r := row(key{col.CourierID, col.Currency})
+		r.Collected += col.Amount
+		if col.PaymentMethod == "CASH" {
+			r.CollectedCash += col.Amount
+		} else {
+			r.CollectedCard += col.Amount
+		}
+	}
+	remittances, _ := h.COD.ListRemittances(from, to)
+	for _, rem := range remittances {
+		row(key{rem.CourierID, rem.Currency}).Remitted += rem.Amount
+	}
+	out := make([]CourierReconciliation, 0, len(rows))
+	for _, r := range rows {
+		if r.Collected != r.Expected {
+			r.Discrepancies = append(r.Discrepancies, "collection_mismatch")
+		}
+		if r.Remitted < r.CollectedCash {
+			r.Discrepancies = append(r.Discrepancies, "remittance_shortfall")
+		}
+		if r.Remitted > r.CollectedCash {
+			r.Discrepancies = append(r.Discrepancies, "remittance_excess")
+		}
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CourierID != out[j].CourierID {
+			return out[i].CourierID < out[j].CourierID
+		}
+		return out[i].Currency < out[j].Currency
+	})
+	c.JSON(http.StatusOK, gin.H{"date": from.Format("2006-01-02"), "couriers": out})
+}
+
+// ClientSettlement totals the COD money collected on behalf of a client.
+type ClientSettlement struct {
+	ClientID   uint   `json:"client_id"`
+	Currency   string `json:"currency"`
+	Deliveries int    `json:"deliveries"`
+	Collected  int64  `json:"collected"`
+	Cash       int64  `json:"cash"`
+	Card       int64  `json:"card"`
+}
+
+// GET /api/cod/settlements?from=YYYY-MM-DD&to=YYYY-MM-DD&client_id=&format=json|xlsx
+// Dispatchers may report on any client; clients only see their own settlement.
+func (h *CODHandler) Settlements(c *gin.Context) {
+	from, _, ok := parseDay(c, c.DefaultQuery("from", time.Now().UTC().Format("2006-01-02")))
+	if !ok {
+		return
+	}
+	_, to, ok := parseDay(c, c.DefaultQuery("to", from.Format("2006-01-02")))
+	if !ok {
+		return
+	}
+	var clientID uint64
+	switch role, _ := c.Get("role"); role {
+	case "client":
+		clientID = uint64(c.GetUint("user_id"))
+	case "dispatcher", "admin":
+		clientID, _ = strconv.ParseUint(c.Query("client_id"), 10, 64)
+	default:
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return
+	}
+	collections, _ := h.COD.ListCollections(from, to)
+	sort.Slice(collections, func(i, j int) bool { return collections[i].CollectedAt.Before(collections[j].CollectedAt) })
+	type key struct {
+		client   uint
+		currency string
+	}
+	totals := map[key]*ClientSettlement{}
+	items := make([]model.CODCollection, 0, len(collections))
+	for _, col := range collections {
+		if clientID != 0 && col.ClientID != uint(clientID) {
+			continue
+		}
+		items = append(items, col)
+		k := key{col.ClientID, col.Currency}
+		if totals[k] == nil {
+			totals[k] = &ClientSettlement{ClientID: col.ClientID, Currency: col.Currency}
+		}
+		t := totals[k]
+		t.Deliveries++
+		t.Collected += col.Amount
+		if col.PaymentMethod == "CASH" {
+			t.Cash += col.Amount
+		} else {
+			t.Card += col.Amount
+		}
+	}
+	summary := make([]ClientSettlement, 0, len(totals))
+	for _, t := range totals {
+		summary = append(summary, *t)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].ClientID != summary[j].ClientID {
+			return summary[i].ClientID < summary[j].ClientID
+		}
+		return summary[i].Currency < summary[j].Currency
+	})
+
+	if c.DefaultQuery("format", "json") == "xlsx" {
+		f := excelize.NewFile()
+		f.SetSheetName("Sheet1", "Summary")
+		f.SetSheetRow("Summary", "A1", &[]string{"ClientID", "Currency", "Deliveries", "Collected", "Cash", "Card"})
+		for i, s := range summary {
+			row := []interface{}{s.ClientID, s.Currency, s.Deliveries, s.Collected, s.Cash, s.Card}
+			f.SetSheetRow("Summary", fmt.Sprintf("A%d", i+2), &row)
+		}
+		f.NewSheet("Items")
+		f.SetSheetRow("Items", "A1", &[]string{"DeliveryID", "ClientID", "CourierID", "CollectedAt", "PaymentMethod", "Amount", "Currency"})
+		for i, it := range items {
+			row := []interface{}{it.DeliveryID, it.ClientID, it.CourierID, it.CollectedAt.Format(time.RFC3339), it.PaymentMethod, it.Amount, it.Currency}
+			f.SetSheetRow("Items", fmt.Sprintf("A%d", i+2), &row)
+		}
+		c.Header("Content-Disposition", "attachment; filename=cod_settlement.xlsx")
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		f.Write(c.Writer)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"from":    from.Format("2006-01-02"),
+		"to":      to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"clients": summary,
+		"items":   items,
+	})
+}
+
+// parseDay returns the [start, end) bounds of a YYYY-MM-DD day in UTC and
+// writes a 400 response when the value is malformed.
+func parseDay(c *gin.Context, v string) (time.Time, time.Time, bool) {
+	day, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date " + v})
+		return time.Time{}, time.Time{}, false
+	}
+	return day, day.AddDate(0, 0, 1), true
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"bytes"
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestCODCollectionAndReconciliation(t *testing.T) {
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	cod := repo.NewInMemoryCODRepo()
+	dh := &DeliveryHandler{Deliveries: deliveries, COD: cod}
+	ch := &CODHandler{Deliveries: deliveries, COD: cod}
+	r := gin.Default()
+	api := r.Group("/api", JWTAuthMiddleware(testSecret))
+	api.POST("/deliveries", dh.CreateDelivery)
+	api.POST("/deliveries/:id/assign", DispatcherOnly(), dh.AssignDelivery)
+	api.POST("/deliveries/:id/deliver", CourierOnly(), dh.CompleteDelivery)
+	api.POST("/cod/remittances", DispatcherOnly(), ch.CreateRemittance)
+	api.GET("/cod/reconciliation", DispatcherOnly(), ch.Reconciliation)
+	api.GET("/cod/settlements", ch.Settlements)
+	do := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		return serveJSON(r, method, path, token, body)
+	}
+	book := func(clientID uint, amount int64) model.Delivery {
+		w := do("POST", "/api/deliveries", makeJWT(clientID), map[string]interface{}{"from_address": "A", "to_address": "B", "cod_amount": amount})
+		assert.Equal(t, 200, w.Code)
+		var d model.Delivery
+		json.Unmarshal(w.Body.Bytes(), &d)
+		return d
+	}
+
+	d1 := book(1, 10000)
+	d2 := book(2, 5000)
+	assert.Equal(t, uint(1), d1.ClientID)
+	assert.Equal(t, "KZT", d1.CODCurrency)
+	assert.Equal(t, 400, do("POST", "/api/deliveries", makeJWT(1), map[string]interface{}{"from_address": "A", "to_address": "B", "cod_amount": -1}).Code)
+
+	// Only the assigned courier may complete
+	do("POST", fmt.Sprintf("/api/deliveries/%d/assign", d1.ID), makeDispatcherJWT(9), map[string]uint{"courier_id": 7})
+	w := do("POST", fmt.Sprintf("/api/deliveries/%d/deliver", d1.ID), makeCourierJWT(8), map[string]interface{}{"collected_amount": 10000, "payment_method": "CASH"})
+	assert.Equal(t, 403, w.Code)
+
+	// Payment method is required for COD deliveries
+	w = do("POST", fmt.Sprintf("/api/deliveries/%d/deliver", d1.ID), makeCourierJWT(7), map[string]interface{}{"collected_amount": 10000})
+	assert.Equal(t, 400, w.Code)
+
+	w = do("POST", fmt.Sprintf("/api/deliveries/%d/deliver", d1.ID), makeCourierJWT(7), map[string]interface{}{"collected_amount": 10000, "payment_method": "CASH"})
+	assert.Equal(t, 200, w.Code)
+	var delivered model.Delivery
+	json.Unmarshal(w.Body.Bytes(), &delivered)
+	assert.Equal(t, "DELIVERED", delivered.Status)
+
+	// Unassigned deliveries cannot be completed by whoever picks them up
+	assert.Equal(t, 403, do("POST", fmt.Sprintf("/api/deliveries/%d/deliver", d2.ID), makeCourierJWT(7), map[string]interface{}{"collected_amount": 5000, "payment_method": "CASH"}).Code)
+
+	// Courier 7 also delivers d2 but collects short, by card
+	do("POST", fmt.Sprintf("/api/deliveries/%d/assign", d2.ID), makeDispatcherJWT(9), map[string]uint{"courier_id": 7})
+	w = do("POST", fmt.Sprintf("/api/deliveries/%d/deliver", d2.ID), makeCourierJWT(7), map[string]interface{}{"collected_amount": 4000, "payment_method": "CARD"})
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, 409, do("POST", fmt.Sprintf("/api/deliveries/%d/deliver", d2.ID), makeCourierJWT(7), map[string]interface{}{"collected_amount": 4000, "payment_method": "CARD"}).Code)
+
+	// Remits only part of the cash
+	w = do("POST", "/api/cod/remittances", makeDispatcherJWT(9), map[string]interface{}{"courier_id": 7, "amount": 9000})
+	assert.Equal(t, 200, w.Code)
+
+	today := time.Now().UTC().Format("2006-01-02")
+	w = do("GET", "/api/cod/reconciliation?date="+today, makeDispatcherJWT(9), nil)
+	assert.Equal(t, 200, w.Code)
+	var rec struct {
+		Couriers []CourierReconciliation `json:"couriers"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &rec)
+	assert.Len(t, rec.Couriers, 1)
+	row := rec.Couriers[0]
+	assert.Equal(t, int64(15000), row.Expected)
+	assert.Equal(t, int64(14000), row.Collected)
+	assert.Equal(t, int64(10000), row.CollectedCash)
+	assert.Equal(t, int64(9000), row.Remitted)
+	assert.ElementsMatch(t, []string{"collection_mismatch", "remittance_shortfall"}, row.Discrepancies)
+
+	// A client only sees their own settlement
+	w = do("GET", "/api/cod/settlements?from="+today+"&client_id=1", makeJWT(2), nil)
+	var settlement struct {
+		Clients []ClientSettlement `json:"clients"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &settlement)
+	assert.Len(t, settlement.Clients, 1)
+	assert.Equal(t, uint(2), settlement.Clients[0].ClientID)
+	assert.Equal(t, int64(4000), settlement.Clients[0].Card)
+
+	// XLSX export
+	w = do("GET", "/api/cod/settlements?from="+today+"&format=xlsx", makeDispatcherJWT(9), nil)
+	assert.Equal(t, 200, w.Code)
+	f, err := excelize.OpenReader(w.Body)
+	assert.NoError(t, err)
+	rows, _ := f.GetRows("Items")
+	assert.Len(t, rows, 3)
+}
+
+// racingDeliveries loses the next UpdateDelivery to a concurrent writer.
+type racingDeliveries struct {
+	*repo.InMemoryDeliveryRepo
+	lose bool
+}
+
+func (r *racingDeliveries) UpdateDelivery(d *model.Delivery) error {
+	if r.lose {
+		r.lose = false
+		return repo.ErrVersionConflict
+	}
+	return r.InMemoryDeliveryRepo.UpdateDelivery(d)
+}
+
+func TestCODCollectionAfterVersionConflict(t *testing.T) {
+	deliveries := &racingDeliveries{InMemoryDeliveryRepo: repo.NewInMemoryDeliveryRepo()}
+	deliveries.CreateDelivery(&model.Delivery{ClientID: 1, CourierID: 7, Status: "OUT_FOR_DELIVERY", CODAmount: 500, CODCurrency: "KZT"})
+	cod := repo.NewInMemoryCODRepo()
+	dh := &DeliveryHandler{Deliveries: deliveries, COD: cod}
+	r := gin.Default()
+	r.POST("/api/deliveries/:id/deliver", JWTAuthMiddleware(testSecret), CourierOnly(), dh.CompleteDelivery)
+	deliver := func(id uint) int {
+		b, _ := json.Marshal(map[string]interface{}{"collected_amount": 500, "payment_method": "CASH"})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/api/deliveries/%d/deliver", id), bytes.NewReader(b))
+		req.Header.Set("Authorization", "Bearer "+makeCourierJWT(7))
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	deliveries.lose = true
+	assert.Equal(t, http.StatusConflict, deliver(1))
+	_, err := cod.GetCollectionByDelivery(1)
+	assert.Error(t, err, "nothing is collected while the delivery is not delivered")
+
+	assert.Equal(t, http.StatusOK, deliver(1))
+	got, err := cod.GetCollectionByDelivery(1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(500), got.Amount)
+	}
+
+	// Only parcels out for handover can be completed
+	for _, status := range []string{"CANCELLED", "RETURN_TO_SENDER", "AT_PICKUP_POINT"} {
+		d := &model.Delivery{ClientID: 1, CourierID: 7, Status: status, CODAmount: 500, CODCurrency: "KZT"}
+		deliveries.CreateDelivery(d)
+		assert.Equal(t, http.StatusConflict, deliver(d.ID), status)
+		_, err := cod.GetCollectionByDelivery(d.ID)
+		assert.Error(t, err, status)
+	}
+}
@@ -0,0 +1,255 @@
+package handler
+
+import (
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"deliverymanagement/internal/storage"
+	"deliverymanagement/pkg/ws"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxCommentAttachments = 5
+	maxAttachmentSize     = 5 * 1024 * 1024
+)
+
+// mentionRe matches @name or @name@example.com; a name is the local part of
+// the user's email.
+var mentionRe = regexp.MustCompile(`(?:^|\s)@([A-Za-z0-9._%+-]+(?:@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)+)?)`)
+
+type CommentHandler struct {
+	Comments   repo.CommentRepository
+	Deliveries repo.DeliveryRepository
+	Blobs      storage.BlobStore // attachments
+	// Users and Notifications resolve and notify @mentions; both optional.
+	Users         repo.UserRepository
+	Notifications *NotificationHandler
+	WSHub         *ws.Hub
+	Timeline      repo.TimelineRepository
+	// Storage enforces the client's storage quota; optional.
+	Storage *StorageHandler
+	// Scanner checks attachments for malware after upload; optional.
+	Scanner *FileScanner
+}
+
+// load returns the delivery when the caller may take part in its thread.
+// Clients only see their own deliveries and couriers the ones assigned to them.
+func (h *CommentHandler) load(c *gin.Context) *model.Delivery {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return nil
+	}
+	d, err := h.Deliveries.GetDelivery(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return nil
+	}
+	if !canComment(c.GetString("role"), c.GetUint("user_id"), d) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return nil
+	}
+	return d
+}
+
+func canComment(role string, userID uint, d *model.Delivery) bool {
+	switch role {
+	case "client", "":
+		return d.ClientID == userID
+	case "courier":
+		return d.CourierID == userID
+	}
+	return true
+}
+
+// canSee reports whether a user with the role may read a comment with the
+// given visibility.
+func canSee(role, visibility string) bool {
+	return visibility == model.CommentClient || (role != "client" && role != "")
+}
+
+// GET /api/deliveries/:id/comments
+// Clients only get the comments visible to them.
+func (h *CommentHandler) ListComments(c *gin.Context) {
+	d := h.load(c)
+	if d == nil {
+		return
+	}
+	role := c.GetString("role")
+	all, _ := h.Comments.ListComments(d.ID)
+	out := make([]model.Comment, 0, len(all))
+	for _, cm := range all {
+		if canSee(role, cm.Visibility) {
+			out = append(out, cm)
+		}
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// POST /api/deliveries/:id/comments
+// JSON {"body", "visibility"} or multipart with the same fields plus up to
+// five "attachments" (JPEG, PNG or PDF, 5MB each). Staff comments default to
+// internal; clients can only write comments visible to the client.
+func (h *CommentHandler) CreateComment(c *gin.Context) {
+	d := h.load(c)
+	if d == nil {
+		return
+	}
+	var req struct {
+		Body       string `json:"body" form:"body" binding:"max=5000"`
+		Visibility string `json:"visibility" form:"visibility"`
+	}
+	bind := c.ShouldBindJSON
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		bind = c.ShouldBind
+	}
+	if err := bind(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	role, userID := c.GetString("role"), c.GetUint("user_id")
+	if req.Visibility == "" {
+		req.Visibility = model.CommentInternal
+		if role == "client" {
+			req.Visibility = model.CommentClient
+		}
+	}
+	if req.Visibility != model.CommentInternal && req.Visibility != model.CommentClient {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "visibility must be internal or client"})
+		return
+	}
+	if !canSee(role, req.Visibility) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "clients cannot write internal comments"})
+		return
+	}
+	var files []*multipart.FileHeader
+	if form, err := c.MultipartForm(); err == nil {
+		files = form.File["attachments"]
+	}
+	if strings.TrimSpace(req.Body) == "" && len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "body or attachments required"})
+		return
+	}
+	if len(files) > maxCommentAttachments {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d attachments", maxCommentAttachments)})
+		return
+	}
+	for _, fh := range files {
+		if fh.Size > maxAttachmentSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fh.Filename + " is too large (max 5MB)"})
+			return
+		}
+		if !isAllowedImage(fh.Filename) && strings.ToLower(filepath.Ext(fh.Filename)) != ".pdf" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file type: " + fh.Filename})
+			return
+		}
+	}
+	cm := &model.Comment{
+		DeliveryID: d.ID,
+		AuthorID:   userID,
+		AuthorRole: role,
+		Body:       req.Body,
+		Visibility: req.Visibility,
+		CreatedAt:  time.Now(),
+	}
+	uploads, ok := saveUploads(c, h.Blobs, files)
+	if !ok {
+		return
+	}
+	admitted, ok := h.Storage.admit(c, d.ID, uploads)
+	if !ok {
+		return
+	}
+	defer admitted.release()
+	for _, u := range uploads {
+		cm.Attachments = append(cm.Attachments, model.CommentAttachment{Path: u.Path, Name: u.Name, Size: u.Size, Mime: u.Mime})
+	}
+	mentioned := h.mentionedUsers(cm, d)
+	for _, u := range mentioned {
+		cm.Mentions = append(cm.Mentions, u.ID)
+	}
+	paths := make([]string, 0, len(cm.Attachments))
+	for _, a := range cm.Attachments {
+		paths = append(paths, a.Path)
+	}
+	h.Scanner.Quarantine(paths...)
+	if err := h.Comments.CreateComment(cm); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	admitted.commit()
+	h.Scanner.Submit(paths...)
+	if h.Notifications != nil {
+		for _, u := range mentioned {
+			h.Notifications.PublishNotification(&model.Notification{
+				UserID:    uint64(u.ID),
+				Type:      "comment.mention",
+				Message:   fmt.Sprintf("You were mentioned on delivery %s: %s", d.TrackingNumber, cm.Body),
+				Data:      map[string]interface{}{"delivery_id": d.ID, "comment_id": cm.ID},
+				CreatedAt: cm.CreatedAt,
+			})
+		}
+	}
+	if cm.Visibility == model.CommentClient {
+		recordTimeline(h.Timeline, d.ID, userID, "comment", "Comment added", map[string]interface{}{"comment_id": cm.ID})
+	}
+	h.push(cm)
+	c.JSON(http.StatusOK, cm)
+}
+
+// push sends the comment to the delivery's WebSocket channel. Tracking
+// channels are public, so internal comments are announced without content
+// and staff fetch them through the API.
+func (h *CommentHandler) push(cm *model.Comment) {
+	if h.WSHub == nil {
+		return
+	}
+	msg := map[string]interface{}{
+		"event":       "comment.created",
+		"delivery_id": cm.DeliveryID,
+		"comment_id":  cm.ID,
+		"visibility":  cm.Visibility,
+	}
+	if cm.Visibility == model.CommentClient {
+		msg["comment"] = cm
+	}
+	h.WSHub.Publish(fmt.Sprint(cm.DeliveryID), mapToJSON(msg))
+}
+
+// mentionedUsers resolves the @mentions in the comment to users who may read
+// it, leaving out the author.
+func (h *CommentHandler) mentionedUsers(cm *model.Comment, d *model.Delivery) []*model.User {
+	if h.Users == nil {
+		return nil
+	}
+	handles := map[string]bool{}
+	for _, m := range mentionRe.FindAllStringSubmatch(cm.Body, -1) {
+		handles[strings.ToLower(strings.TrimRight(m[1], "."))] = true
+	}
+	if len(handles) == 0 {
+		return nil
+	}
+	users, _ := h.Users.ListUsers()
+	var out []*model.User
+	for _, u := range users {
+		email := strings.ToLower(u.Email)
+		local, _, _ := strings.Cut(email, "@")
+		if !handles[email] && !handles[local] {
+			continue
+		}
+		if u.ID == cm.AuthorID || !canSee(u.Role, cm.Visibility) || !canComment(u.Role, u.ID, d) {
+			continue
+		}
+		out = append(out, u)
+	}
+	return out
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"bytes"
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"deliverymanagement/internal/storage"
+	"encoding/json"
+	"image/jpeg"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeliveryComments(t *testing.T) {
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	users := repo.NewInMemoryUserRepo()
+	notifications := repo.NewInMemoryNotificationRepo()
+	comments := repo.NewInMemoryCommentRepo()
+	blobs := storage.NewMemoryStore()
+	h := &CommentHandler{
+		Blobs:         blobs,
+		Comments:      comments,
+		Deliveries:    deliveries,
+		Users:         users,
+		Notifications: &NotificationHandler{Notifications: notifications},
+	}
+	files := &FileHandler{DamageReports: repo.NewInMemoryDamageReportRepo(), Blobs: blobs, Comments: comments, Deliveries: deliveries}
+	r := gin.Default()
+	api := r.Group("/", JWTAuthMiddleware(testSecret))
+	api.GET("/api/deliveries/:id/comments", h.ListComments)
+	api.POST("/api/deliveries/:id/comments", h.CreateComment)
+	api.GET("/files/:filename", files.ServeFile)
+
+	for _, u := range []*model.User{
+		{Email: "client@shop.kz", Role: "client"},
+		{Email: "anna.k@dm.kz", Role: "dispatcher"},
+		{Email: "courier@dm.kz", Role: "courier"},
+		{Email: "other@shop.kz", Role: "client"},
+	} {
+		users.CreateUser(u)
+	}
+	ids := map[string]uint{}
+	list, _ := users.ListUsers()
+	for _, u := range list {
+		ids[u.Email] = u.ID
+	}
+	deliveries.CreateDelivery(&model.Delivery{ClientID: ids["client@shop.kz"], CourierID: ids["courier@dm.kz"], TrackingNumber: "DM1", Status: "ASSIGNED"})
+	client := makeJWT(ids["client@shop.kz"])
+	dispatcher := makeDispatcherJWT(ids["anna.k@dm.kz"])
+	courier := makeCourierJWT(ids["courier@dm.kz"])
+
+	do := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		return serveJSON(r, method, path, token, body)
+	}
+	mentions := func(userID uint) int {
+		ns, _ := notifications.ListNotifications(uint64(userID))
+		return len(ns)
+	}
+
+	// Internal note from the courier mentioning the dispatcher and the client:
+	// the client cannot read it, so only the dispatcher is notified
+	w := do("POST", "/api/deliveries/1/comments", courier, map[string]string{"body": "Gate locked, @anna.k please call @client@shop.kz"})
+	assert.Equal(t, 200, w.Code)
+	var cm model.Comment
+	json.Unmarshal(w.Body.Bytes(), &cm)
+	assert.Equal(t, model.CommentInternal, cm.Visibility)
+	assert.Equal(t, []uint{ids["anna.k@dm.kz"]}, cm.Mentions)
+	assert.Equal(t, 1, mentions(ids["anna.k@dm.kz"]))
+	assert.Equal(t, 0, mentions(ids["client@shop.kz"]))
+
+	w = do("POST", "/api/deliveries/1/comments", dispatcher, map[string]string{"body": "@client we will retry tomorrow", "visibility": "client"})
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, 1, mentions(ids["client@shop.kz"]))
+
+	assert.Equal(t, 403, do("POST", "/api/deliveries/1/comments", client, map[string]string{"body": "x", "visibility": "internal"}).Code)
+	assert.Equal(t, 403, do("POST", "/api/deliveries/1/comments", makeJWT(ids["other@shop.kz"]), map[string]string{"body": "x"}).Code)
+	assert.Equal(t, 403, do("GET", "/api/deliveries/1/comments", makeCourierJWT(99), nil).Code)
+	assert.Equal(t, 400, do("POST", "/api/deliveries/1/comments", client, map[string]string{"body": " "}).Code)
+	assert.Equal(t, 400, do("POST", "/api/deliveries/1/comments", dispatcher, map[string]string{"body": "x", "visibility": "public"}).Code)
+
+	// Client reply with an attachment
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	mw.WriteField("body", "Thanks, see the photo of the gate")
+	fw, _ := mw.CreateFormFile("attachments", "gate.jpg")
+	fw.Write(testJPEG())
+	mw.Close()
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/deliveries/1/comments", &b)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+client)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &cm)
+	assert.Equal(t, model.CommentClient, cm.Visibility)
+	assert.Len(t, cm.Attachments, 1)
+	assert.Equal(t, "image/jpeg", cm.Attachments[0].Mime)
+	assert.NotZero(t, cm.Attachments[0].Size)
+
+	var thread []model.Comment
+	json.Unmarshal(do("GET", "/api/deliveries/1/comments", client, nil).Body.Bytes(), &thread)
+	assert.Len(t, thread, 2)
+	json.Unmarshal(do("GET", "/api/deliveries/1/comments", dispatcher, nil).Body.Bytes(), &thread)
+	assert.Len(t, thread, 3)
+
+	path := "/files/" + cm.Attachments[0].Path
+	assert.Equal(t, 200, do("GET", path, client, nil).Code)
+	assert.Equal(t, 200, do("GET", path, courier, nil).Code)
+	w = do("GET", path+"?size=thumb", client, nil)
+	assert.Equal(t, 200, w.Code)
+	cfg, err := jpeg.DecodeConfig(w.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, cfg.Width)
+	assert.Equal(t, 400, do("GET", path+"?size=huge", client, nil).Code)
+	assert.Equal(t, 403, do("GET", path, makeJWT(ids["other@shop.kz"]), nil).Code)
+}
@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var customFieldKeyRe = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+// maxTags limits the free-form tags on one delivery.
+const maxTags = 20
+
+type CustomFieldHandler struct {
+	Fields repo.CustomFieldRepository
+}
+
+// POST /api/admin/clients/:client_id/custom-fields
+func (h *CustomFieldHandler) CreateField(c *gin.Context) {
+	clientID, err := strconv.ParseUint(c.Param("client_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid client id"})
+		return
+	}
+	var req struct {
+		Key      string   `json:"key" binding:"required"`
+		Label    string   `json:"label"`
+		Type     string   `json:"type" binding:"required,oneof=string number enum date"`
+		Options  []string `json:"options"`
+		Required bool     `json:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	if !customFieldKeyRe.MatchString(req.Key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key must be lowercase letters, digits and underscores"})
+		return
+	}
+	if (req.Type == model.CustomFieldEnum) != (len(req.Options) > 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "options are required for enum fields and only allowed there"})
+		return
+	}
+	if req.Label == "" {
+		req.Label = req.Key
+	}
+	f := &model.CustomFieldDefinition{
+		ClientID:  uint(clientID),
+		Key:       req.Key,
+		Label:     req.Label,
+		Type:      req.Type,
+		Options:   req.Options,
+		Required:  req.Required,
+		CreatedAt: time.Now(),
+	}
+	if err := h.Fields.CreateField(f); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, f)
+}
+
+// GET /api/admin/clients/:client_id/custom-fields
+func (h *CustomFieldHandler) ListFields(c *gin.Context) {
+	clientID, err := strconv.ParseUint(c.Param("client_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid client id"})
+		return
+	}
+	fields, _ := h.Fields.ListFields(uint(clientID))
+	c.JSON(http.StatusOK, fields)
+}
+
+// GET /api/custom-fields
+// The definitions of the calling client, to build its booking form.
+func (h *CustomFieldHandler) ListOwnFields(c *gin.Context) {
+	fields, _ := h.Fields.ListFields(c.GetUint("user_id"))
+	c.JSON(http.StatusOK, fields)
+}
+
+// DELETE /api/admin/clients/:client_id/custom-fields/:key
+// Values already stored on deliveries are kept.
+func (h *CustomFieldHandler) DeleteField(c *gin.Context) {
+	clientID, err := strconv.ParseUint(c.Param("client_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid client id"})
+		return
+	}
+	if err := h.Fields.DeleteField(uint(clientID), c.Param("key")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// validateCustomFields checks submitted values against the client's
+// definitions and merges them over current. Unknown keys are rejected, a null
+// value clears a field, and required fields must end up set.
+func validateCustomFields(fields repo.CustomFieldRepository, clientID uint, current map[string]string, in map[string]interface{}) (map[string]string, error) {
+	var defs []model.CustomFieldDefinition
+	if fields != nil {
+		defs, _ = fields.ListFields(clientID)
+	}
+	byKey := make(map[string]model.CustomFieldDefinition, len(defs))
+	for _, f := range defs {
+		byKey[f.Key] = f
+	}
+	out := make(map[string]string, len(current)+len(in))
+	for k, v := range current {
+		out[k] = v
+	}
+	for k, v := range in {
+		f, ok := byKey[k]
+		if !ok {
+			return nil, fmt.Errorf("unknown custom field %q", k)
+		}
+		if v == nil {
+			delete(out, k)
+			continue
+		}
+		s, err := f.Normalize(v)
+		if err != nil {
+			return nil, err
+		}
+		out[k] = s
+	}
+	for _, f := range defs {
+		if f.Required && out[f.Key] == "" {
+			return nil, fmt.Errorf("custom field %s is required", f.Key)
+		}
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out, nil
+}
+
+// validateTags trims the tags and drops duplicates.
+func validateTags(tags []string) ([]string, error) {
+	for i := range tags {
+		tags[i] = strings.TrimSpace(tags[i])
+		if len(tags[i]) > 50 {
+			return nil, fmt.Errorf("tag %q is longer than 50 characters", tags[i])
+		}
+	}
+	tags = mergeTags(nil, tags, nil)
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("at most %d tags are allowed", maxTags)
+	}
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	return tags, nil
+}
+
+// PATCH /api/deliveries/:id/fields
+// Body: {"custom_fields": {...}, "tags": [...]}. Either part may be omitted;
+// tags, when given, replace the current ones. Open to the owning client and
+// to dispatchers.
+func (h *DeliveryHandler) UpdateFields(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req struct {
+		CustomFields map[string]interface{} `json:"custom_fields"`
+		Tags         *[]string              `json:"tags"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	delivery := deliveryForUpdate(c, h.Deliveries, uint(id))
+	if delivery == nil {
+		return
+	}
+	if c.GetString("role") != "dispatcher" && delivery.ClientID != c.GetUint("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return
+	}
+	values, err := validateCustomFields(h.CustomFields, delivery.ClientID, delivery.CustomFields, req.CustomFields)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tags := delivery.Tags
+	if req.Tags != nil {
+		if tags, err = validateTags(*req.Tags); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	delivery.CustomFields = values
+	delivery.Tags = tags
+	if err := h.Deliveries.UpdateDelivery(delivery); err != nil {
+		updateFailed(c, err)
+		return
+	}
+	c.Header("ETag", deliveryETag(delivery))
+	recordTimeline(h.Timeline, delivery.ID, c.GetUint("user_id"), "fields_updated", "Tags and custom fields updated",
+		map[string]interface{}{"custom_fields": delivery.CustomFields, "tags": delivery.Tags})
+	c.JSON(http.StatusOK, delivery)
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCustomFieldNormalize(t *testing.T) {
+	num := model.CustomFieldDefinition{Key: "weight", Type: model.CustomFieldNumber}
+	v, err := num.Normalize(12.50)
+	assert.NoError(t, err)
+	assert.Equal(t, "12.5", v)
+	v, err = num.Normalize(" 7 ")
+	assert.NoError(t, err)
+	assert.Equal(t, "7", v)
+	_, err = num.Normalize("seven")
+	assert.Error(t, err)
+
+	date := model.CustomFieldDefinition{Key: "due", Type: model.CustomFieldDate}
+	_, err = date.Normalize("2026-02-30")
+	assert.Error(t, err)
+
+	enum := model.CustomFieldDefinition{Key: "dept", Type: model.CustomFieldEnum, Options: []string{"sales", "hr"}}
+	_, err = enum.Normalize("hr")
+	assert.NoError(t, err)
+	_, err = enum.Normalize("it")
+	assert.EqualError(t, err, "dept must be one of sales, hr")
+
+	str := model.CustomFieldDefinition{Key: "order", Type: model.CustomFieldString}
+	_, err = str.Normalize(42.0)
+	assert.Error(t, err)
+}
+
+func TestCustomFieldsOnDeliveries(t *testing.T) {
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	fields := repo.NewInMemoryCustomFieldRepo()
+	fh := &CustomFieldHandler{Fields: fields}
+	dh := &DeliveryHandler{Deliveries: deliveries, CustomFields: fields}
+	r := gin.Default()
+	r.POST("/api/admin/clients/:client_id/custom-fields", fh.CreateField)
+	api := r.Group("/api", JWTAuthMiddleware(testSecret))
+	api.GET("/custom-fields", fh.ListOwnFields)
+	api.POST("/deliveries", dh.CreateDelivery)
+	api.GET("/deliveries", dh.ListDeliveries)
+	api.PATCH("/deliveries/:id/fields", dh.UpdateFields)
+	api.GET("/deliveries/export", dh.ExportDeliveries)
+	do := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		return serveJSON(r, method, path, token, body)
+	}
+	client, other := makeJWT(1), makeJWT(2)
+
+	for _, f := range []map[string]interface{}{
+		{"key": "order_no", "type": "string", "required": true},
+		{"key": "amount", "type": "number"},
+		{"key": "dept", "type": "enum", "options": []string{"sales", "hr"}},
+		{"key": "due", "type": "date"},
+	} {
+		assert.Equal(t, 200, do("POST", "/api/admin/clients/1/custom-fields", "", f).Code)
+	}
+	assert.Equal(t, 409, do("POST", "/api/admin/clients/1/custom-fields", "", map[string]string{"key": "dept", "type": "string"}).Code)
+	assert.Equal(t, 400, do("POST", "/api/admin/clients/1/custom-fields", "", map[string]string{"key": "Cost Center", "type": "string"}).Code)
+	assert.Equal(t, 400, do("POST", "/api/admin/clients/1/custom-fields", "", map[string]string{"key": "kind", "type": "enum"}).Code)
+	var defs []model.CustomFieldDefinition
+	json.Unmarshal(do("GET", "/api/custom-fields", client, nil).Body.Bytes(), &defs)
+	assert.Len(t, defs, 4)
+
+	book := func(token string, body map[string]interface{}) *httptest.ResponseRecorder {
+		body["from_address"], body["to_address"] = "A", "B"
+		return do("POST", "/api/deliveries", token, body)
+	}
+	w := book(client, map[string]interface{}{"custom_fields": map[string]interface{}{"amount": 5}})
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), "order_no is required")
+	w = book(client, map[string]interface{}{"custom_fields": map[string]interface{}{"order_no": "A-1", "colour": "red"}})
+	assert.Contains(t, w.Body.String(), `unknown custom field \"colour\"`)
+	assert.Equal(t, 400, book(client, map[string]interface{}{"custom_fields": map[string]interface{}{"order_no": "A-1", "dept": "it"}}).Code)
+
+	assert.Equal(t, 200, book(client, map[string]interface{}{
+		"custom_fields": map[string]interface{}{"order_no": "A-1", "amount": 99.90, "dept": "sales", "due": "2026-11-01"},
+		"tags":          []string{"vip", " fragile", "vip"},
+	}).Code)
+	assert.Equal(t, 200, book(client, map[string]interface{}{
+		"custom_fields": map[string]interface{}{"order_no": "A-2", "dept": "hr"},
+		"tags":          []string{"vip"},
+	}).Code)
+	// Another client has no definitions, so only tags are accepted
+	assert.Equal(t, 400, book(other, map[string]interface{}{"custom_fields": map[string]interface{}{"order_no": "X"}}).Code)
+	assert.Equal(t, 200, book(other, map[string]interface{}{"tags": []string{"fragile"}}).Code)
+
+	d, _ := deliveries.GetDelivery(1)
+	assert.Equal(t, []string{"vip", "fragile"}, d.Tags)
+	assert.Equal(t, "99.9", d.CustomFields["amount"])
+
+	list := func(query string) []model.Delivery {
+		var out []model.Delivery
+		json.Unmarshal(do("GET", "/api/deliveries?"+query, client, nil).Body.Bytes(), &out)
+		return out
+	}
+	assert.Len(t, list("tag=vip"), 2)
+	assert.Len(t, list("tag=vip&tag=fragile"), 1)
+	assert.Len(t, list("tag=fragile"), 2)
+	got := list("cf.dept=hr")
+	assert.Len(t, got, 1)
+	assert.Equal(t, uint(2), got[0].ID)
+
+	// Updating: only the owner, values validated, null clears, tags replace
+	assert.Equal(t, 403, do("PATCH", "/api/deliveries/2/fields", other, map[string]interface{}{"tags": []string{}}).Code)
+	assert.Equal(t, 400, do("PATCH", "/api/deliveries/2/fields", client, map[string]interface{}{"custom_fields": map[string]interface{}{"order_no": nil}}).Code)
+	w = do("PATCH", "/api/deliveries/2/fields", client, map[string]interface{}{
+		"custom_fields": map[string]interface{}{"dept": nil, "amount": "12"},
+		"tags":          []string{"urgent"},
+	})
+	assert.Equal(t, 200, w.Code)
+	d, _ = deliveries.GetDelivery(2)
+	assert.Equal(t, map[string]string{"order_no": "A-2", "amount": "12"}, d.CustomFields)
+	assert.Equal(t, []string{"urgent"}, d.Tags)
+
+	w = do("GET", "/api/deliveries/export?format=csv&tag=vip", client, nil)
+	assert.Equal(t, 200, w.Code)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Equal(t, "ID,FromAddress,ToAddress,Status,ZoneID,Tags,amount,dept,due,order_no", lines[0])
+	assert.Len(t, lines, 2)
+	assert.True(t, strings.HasSuffix(lines[1], ",vip;fragile,99.9,sales,2026-11-01,A-1"))
+}
@@ -3,11 +3,11 @@ package handler
 import (
 	"deliverymanagement/internal/model"
 	"deliverymanagement/internal/repo"
+	"deliverymanagement/internal/storage"
 	"deliverymanagement/pkg/rabbitmq"
 	"fmt"
-	"io"
+	"mime/multipart"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -16,56 +16,105 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// maxDamageAttachments limits the files on one damage report, including
+// the ones added later.
+const maxDamageAttachments = 10
+
 type DamageReportHandler struct {
 	DamageReports repo.DamageReportRepository
 	Publisher     rabbitmq.Publisher
+	Blobs         storage.BlobStore
+	// Deliveries decides who may read a delivery's reports.
+	Deliveries repo.DeliveryRepository
+	// KeepGPS keeps the position found in photo metadata on the attachment,
+	// readable by admins only. It is always stripped from the stored files.
+	KeepGPS bool
+	// Claims, when set, opens a damage claim with every report.
+	Claims *ClaimHandler
+	// Storage enforces the client's storage quota; optional.
+	Storage *StorageHandler
+	// Scanner checks the files for malware after upload; optional.
+	Scanner *FileScanner
 }
 
-// POST /api/damage-report (multipart: delivery_id, type, description, photo)
+// POST /api/damage-report (multipart: delivery_id, type, description, photo
+// and/or attachments (repeatable, JPG/PNG/PDF), optional claimed_amount in
+// minor units defaulting to the declared value)
 func (h *DamageReportHandler) CreateDamageReport(c *gin.Context) {
 	deliveryID, _ := strconv.Atoi(c.PostForm("delivery_id"))
 	damageType := c.PostForm("type")
 	desc := c.PostForm("description")
-	file, header, err := c.Request.FormFile("photo")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "photo required"})
-		return
+	var claimed int64
+	if v := c.PostForm("claimed_amount"); v != "" {
+		var err error
+		if claimed, err = strconv.ParseInt(v, 10, 64); err != nil || claimed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid claimed_amount"})
+			return
+		}
 	}
-	defer file.Close()
-	if header.Size > 5*1024*1024 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "file too large (max 5MB)"})
-		return
+	var delivery *model.Delivery
+	if h.Claims != nil {
+		var err error
+		if delivery, err = h.Claims.Deliveries.GetDelivery(uint(deliveryID)); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "delivery not found"})
+			return
+		}
+		if claimed > delivery.DeclaredValue {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "claimed_amount exceeds the declared value", "declared_value": delivery.DeclaredValue})
+			return
+		}
 	}
-	if !isAllowedImage(header.Filename) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file type"})
+	files, ok := damageFiles(c, 0)
+	if !ok {
 		return
 	}
-	filename := fmt.Sprintf("%d_%d%s", time.Now().UnixNano(), deliveryID, filepath.Ext(header.Filename))
-	path := filepath.Join("uploads", filename)
-	out, err := os.Create(path)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not save file"})
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "photo required"})
 		return
 	}
-	defer out.Close()
-	size, _ := io.Copy(out, file)
 	report := &model.DamageReport{
 		DeliveryID:  uint(deliveryID),
 		Type:        damageType,
 		Description: desc,
-		PhotoPath:   filename,
-		PhotoSize:   size,
-		PhotoMime:   header.Header.Get("Content-Type"),
+		ReporterID:  c.GetUint("user_id"),
 		Timestamp:   time.Now(),
 	}
-	h.DamageReports.CreateDamageReport(report)
+	var admitted *admission
+	if report.Attachments, admitted, ok = h.saveDamageFiles(c, report.DeliveryID, files); !ok {
+		return
+	}
+	defer admitted.release()
+	first := report.Attachments[0]
+	report.PhotoPath, report.PhotoSize, report.PhotoMime = first.Path, first.Size, first.Mime
+	h.Scanner.Quarantine(attachmentPaths(report.Attachments)...)
+	if err := h.DamageReports.CreateDamageReport(report); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// The report only stands with its claim, so a failed claim removes it
+	// again and a retry does not leave a duplicate behind.
+	if delivery != nil {
+		claim, err := h.Claims.Open(report, delivery, claimed)
+		if err == nil {
+			err = h.DamageReports.SetClaimID(report.ID, claim.ID)
+		}
+		if err != nil {
+			h.DamageReports.DeleteDamageReport(report.ID)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		report.ClaimID = claim.ID
+	}
+	admitted.commit()
+	h.Scanner.Submit(attachmentPaths(report.Attachments)...)
 	if h.Publisher != nil {
 		h.Publisher.Publish("email.queue", map[string]interface{}{
 			"event":       "damage.reported",
 			"delivery_id": deliveryID,
-			"photo":       filename,
-			"file_size":   size,
-			"mime_type":   header.Header.Get("Content-Type"),
+			"photo":       first.Path,
+			"file_size":   first.Size,
+			"mime_type":   first.Mime,
+			"attachments": len(report.Attachments),
 		})
 	}
 	c.JSON(http.StatusOK, report)
@@ -75,3 +124,189 @@ func isAllowedImage(name string) bool {
 	ext := strings.ToLower(filepath.Ext(name))
 	return ext == ".jpg" || ext == ".jpeg" || ext == ".png"
 }
+
+// GET /api/deliveries/:id/damage-reports
+// Open to dispatchers, admins and warehouse staff, to the client who booked
+// the delivery and to its courier.
+func (h *DamageReportHandler) ListDeliveryReports(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	d, err := h.Deliveries.GetDelivery(uint(id))
+	if err != nil || !canReadDamageReports(c.GetString("role"), c.GetUint("user_id"), d) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	reports := h.DamageReports.ListDamageReports(d.ID)
+	if reports == nil {
+		reports = []*model.DamageReport{}
+	}
+	c.JSON(http.StatusOK, reports)
+}
+
+// GET /api/damage-report/:id
+func (h *DamageReportHandler) GetDamageReport(c *gin.Context) {
+	if report := h.loadReport(c); report != nil {
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// POST /api/damage-report/:id/attachments (multipart: attachments, repeatable)
+// Adds photos or documents to an existing report. Open to the reporter, to
+// dispatchers and to admins.
+func (h *DamageReportHandler) AddAttachments(c *gin.Context) {
+	report := h.loadReport(c)
+	if report == nil {
+		return
+	}
+	role := c.GetString("role")
+	if role != "dispatcher" && role != "admin" && report.ReporterID != c.GetUint("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the reporter can add attachments"})
+		return
+	}
+	files, ok := damageFiles(c, len(report.Attachments))
+	if !ok {
+		return
+	}
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "attachments required"})
+		return
+	}
+	added, admitted, ok := h.saveDamageFiles(c, report.DeliveryID, files)
+	if !ok {
+		return
+	}
+	defer admitted.release()
+	h.Scanner.Quarantine(attachmentPaths(added)...)
+	if err := h.DamageReports.AddDamageAttachments(report.ID, added...); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	admitted.commit()
+	h.Scanner.Submit(attachmentPaths(added)...)
+	report, _ = h.DamageReports.GetDamageReport(report.ID)
+	c.JSON(http.StatusOK, report)
+}
+
+// GET /api/admin/damage-reports/:id/locations (admin only)
+// The positions kept from photo metadata, when KeepGPS is on.
+func (h *DamageReportHandler) ListLocations(c *gin.Context) {
+	report := h.loadReport(c)
+	if report == nil {
+		return
+	}
+	out := []gin.H{}
+	for _, a := range report.Attachments {
+		if a.GPS != nil {
+			out = append(out, gin.H{"path": a.Path, "lat": a.GPS.Lat, "lon": a.GPS.Lon})
+		}
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// loadReport returns the report named by :id, writing 404 when it does not
+// exist or the caller may not read it.
+func (h *DamageReportHandler) loadReport(c *gin.Context) *model.DamageReport {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return nil
+	}
+	report, err := h.DamageReports.GetDamageReport(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return nil
+	}
+	role, userID := c.GetString("role"), c.GetUint("user_id")
+	if report.ReporterID == userID {
+		return report
+	}
+	var d *model.Delivery
+	if h.Deliveries != nil {
+		d, _ = h.Deliveries.GetDelivery(report.DeliveryID)
+	}
+	if d == nil || !canReadDamageReports(role, userID, d) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return nil
+	}
+	return report
+}
+
+func canReadDamageReports(role string, userID uint, d *model.Delivery) bool {
+	switch role {
+	case "dispatcher", "admin", "warehouse":
+		return true
+	case "client":
+		return d.ClientID == userID
+	case "courier":
+		return d.CourierID == userID
+	}
+	return false
+}
+
+// damageFiles collects the uploaded files from the photo and attachments
+// fields and validates them; existing is the number of files the report
+// already has. It writes 400 and returns false on invalid input.
+func damageFiles(c *gin.Context, existing int) ([]*multipart.FileHeader, bool) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, true
+	}
+	files := append(append([]*multipart.FileHeader(nil), form.File["photo"]...), form.File["attachments"]...)
+	if existing+len(files) > maxDamageAttachments {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d attachments per report", maxDamageAttachments)})
+		return nil, false
+	}
+	for _, fh := range files {
+		if fh.Size > maxAttachmentSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fh.Filename + " is too large (max 5MB)"})
+			return nil, false
+		}
+		if !isAllowedImage(fh.Filename) && strings.ToLower(filepath.Ext(fh.Filename)) != ".pdf" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file type: " + fh.Filename})
+			return nil, false
+		}
+	}
+	return files, true
+}
+
+// saveDamageFiles verifies and stores the files and admits them against the
+// storage quota, writing 400, 413 or 500 and returning false when one is
+// refused or cannot be saved. GPS positions are kept only when h.KeepGPS is
+// set. The caller releases the admission once the report is saved.
+func (h *DamageReportHandler) saveDamageFiles(c *gin.Context, deliveryID uint, files []*multipart.FileHeader) ([]model.DamageAttachment, *admission, bool) {
+	uploads, ok := saveUploads(c, h.Blobs, files)
+	if !ok {
+		return nil, nil, false
+	}
+	admitted, ok := h.Storage.admit(c, deliveryID, uploads)
+	if !ok {
+		return nil, nil, false
+	}
+	out := make([]model.DamageAttachment, 0, len(uploads))
+	for _, u := range uploads {
+		a := model.DamageAttachment{
+			Path:       u.Path,
+			Name:       u.Name,
+			Size:       u.Size,
+			Mime:       u.Mime,
+			UploadedBy: c.GetUint("user_id"),
+			UploadedAt: time.Now(),
+		}
+		if h.KeepGPS && u.GPS != nil {
+			a.GPS = &model.Coordinates{Lat: u.GPS.Lat, Lon: u.GPS.Lon}
+		}
+		out = append(out, a)
+	}
+	return out, admitted, true
+}
+
+func attachmentPaths(attachments []model.DamageAttachment) []string {
+	out := make([]string, 0, len(attachments))
+	for _, a := range attachments {
+		out = append(out, a.Path)
+	}
+	return out
+}
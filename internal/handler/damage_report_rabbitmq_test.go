@@ -3,6 +3,7 @@ package handler
 import (
 	"bytes"
 	"deliverymanagement/internal/repo"
+	"deliverymanagement/internal/storage"
 	"deliverymanagement/pkg/rabbitmq"
 	"mime/multipart"
 	"net/http"
@@ -15,7 +16,7 @@ import (
 
 func setupDamageReportRouterWithPublisher(pub rabbitmq.Publisher) (*gin.Engine, *repo.InMemoryDamageReportRepo, *rabbitmq.FakePublisher) {
 	repo := repo.NewInMemoryDamageReportRepo()
-	h := &DamageReportHandler{DamageReports: repo, Publisher: pub}
+	h := &DamageReportHandler{DamageReports: repo, Blobs: storage.NewMemoryStore(), Publisher: pub}
 	r := gin.Default()
 	r.POST("/api/damage-report", h.CreateDamageReport)
 	return r, repo, pub.(*rabbitmq.FakePublisher)
@@ -32,7 +33,7 @@ func TestDamageReportPublishesEvent(t *testing.T) {
 	w.WriteField("description", "test")
 	// Add a dummy file
 	fileWriter, _ := w.CreateFormFile("photo", "test.jpg")
-	fileWriter.Write([]byte("dummydata"))
+	fileWriter.Write(testJPEG())
 	w.Close()
 
 	rec := httptest.NewRecorder()
@@ -2,20 +2,37 @@ package handler
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"deliverymanagement/internal/model"
 	"deliverymanagement/internal/repo"
+	"deliverymanagement/internal/storage"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
+// testJPEG is a small valid photo for upload tests.
+func testJPEG() []byte {
+	var b bytes.Buffer
+	jpeg.Encode(&b, image.NewRGBA(image.Rect(0, 0, 300, 200)), nil)
+	return b.Bytes()
+}
+
+var testPDF = []byte("%PDF-1.4\n1 0 obj\n<<>>\nendobj\ntrailer\n<<>>\n%%EOF\n")
+
 func TestCreateDamageReport_UploadValidation(t *testing.T) {
 	repo := repo.NewInMemoryDamageReportRepo()
-	h := &DamageReportHandler{DamageReports: repo}
+	h := &DamageReportHandler{DamageReports: repo, Blobs: storage.NewMemoryStore()}
 	r := gin.Default()
 	r.POST("/api/damage-report", h.CreateDamageReport)
 
@@ -26,7 +43,7 @@ func TestCreateDamageReport_UploadValidation(t *testing.T) {
 	w.WriteField("type", "broken")
 	w.WriteField("description", "desc")
 	fw, _ := w.CreateFormFile("photo", "test.jpg")
-	fw.Write([]byte("dummydata"))
+	fw.Write(testJPEG())
 	w.Close()
 
 	rec := httptest.NewRecorder()
@@ -51,6 +68,21 @@ func TestCreateDamageReport_UploadValidation(t *testing.T) {
 	r.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
 
+	// Right extension, but not an image
+	b.Reset()
+	w = multipart.NewWriter(&b)
+	w.WriteField("delivery_id", "1")
+	fw, _ = w.CreateFormFile("photo", "test.jpg")
+	fw.Write([]byte("dummydata"))
+	w.Close()
+
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/damage-report", &b)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
 	// Too large
 	b.Reset()
 	w = multipart.NewWriter(&b)
@@ -66,3 +98,88 @@ func TestCreateDamageReport_UploadValidation(t *testing.T) {
 	r.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
 }
+
+func TestDamageReportAttachments(t *testing.T) {
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	d := &model.Delivery{ClientID: 1, CourierID: 2, Status: "IN_TRANSIT"}
+	deliveries.CreateDelivery(d)
+	blobs := storage.NewMemoryStore()
+	h := &DamageReportHandler{DamageReports: repo.NewInMemoryDamageReportRepo(), Blobs: blobs, Deliveries: deliveries}
+	r := gin.Default()
+	auth := JWTAuthMiddleware(testSecret)
+	r.POST("/api/damage-report", auth, h.CreateDamageReport)
+	r.GET("/api/damage-report/:id", auth, h.GetDamageReport)
+	r.POST("/api/damage-report/:id/attachments", auth, h.AddAttachments)
+	r.GET("/api/deliveries/:id/damage-reports", auth, h.ListDeliveryReports)
+
+	upload := func(path, token string, names ...string) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		mw := multipart.NewWriter(&b)
+		mw.WriteField("delivery_id", fmt.Sprint(d.ID))
+		mw.WriteField("type", "broken")
+		for _, name := range names {
+			fw, _ := mw.CreateFormFile("attachments", name)
+			if strings.HasSuffix(name, ".pdf") {
+				fw.Write(testPDF)
+			} else {
+				fw.Write(testJPEG())
+			}
+		}
+		mw.Close()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, &b)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+token)
+		r.ServeHTTP(w, req)
+		return w
+	}
+	get := func(path, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		r.ServeHTTP(w, req)
+		return w
+	}
+	var report model.DamageReport
+
+	w := upload("/api/damage-report", makeCourierJWT(2), "front.jpg", "side.png", "invoice.pdf")
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &report)
+	assert.Len(t, report.Attachments, 3)
+	assert.Equal(t, report.Attachments[0].Path, report.PhotoPath)
+	assert.Equal(t, "invoice.pdf", report.Attachments[2].Name)
+	assert.Equal(t, http.StatusBadRequest, upload("/api/damage-report", makeCourierJWT(2), "notes.txt").Code)
+	for _, a := range report.Attachments[:2] {
+		assert.Equal(t, "image/jpeg", a.Mime, "sniffed, not taken from the name")
+		_, err := blobs.Stat(context.Background(), variantPath(a.Path, "thumb"))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, "application/pdf", report.Attachments[2].Mime)
+	assert.Equal(t, report.Attachments[0].Path, report.Attachments[1].Path, "identical photos share one blob")
+	assert.Equal(t, storage.ContentKey(testPDF, ".pdf"), report.Attachments[2].Path)
+
+	// More files later, by the reporter only and up to the limit
+	path := fmt.Sprintf("/api/damage-report/%d/attachments", report.ID)
+	assert.Equal(t, http.StatusNotFound, upload(path, makeCourierJWT(3), "x.jpg").Code)
+	assert.Equal(t, http.StatusForbidden, upload(path, makeWarehouseJWT(4), "x.jpg").Code)
+	w = upload(path, makeCourierJWT(2), "packing-list.pdf")
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &report)
+	assert.Len(t, report.Attachments, 4)
+	many := make([]string, maxDamageAttachments)
+	for i := range many {
+		many[i] = fmt.Sprintf("%d.jpg", i)
+	}
+	assert.Equal(t, http.StatusBadRequest, upload(path, makeDispatcherJWT(9), many...).Code)
+
+	// Listing per delivery
+	w = get(fmt.Sprintf("/api/deliveries/%d/damage-reports", d.ID), makeJWT(1))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var list []model.DamageReport
+	json.Unmarshal(w.Body.Bytes(), &list)
+	assert.Len(t, list, 1)
+	assert.Len(t, list[0].Attachments, 4)
+	assert.Equal(t, http.StatusNotFound, get(fmt.Sprintf("/api/deliveries/%d/damage-reports", d.ID), makeJWT(5)).Code)
+	assert.Equal(t, http.StatusOK, get(fmt.Sprintf("/api/damage-report/%d", report.ID), makeDispatcherJWT(9)).Code)
+	assert.Equal(t, http.StatusNotFound, get(fmt.Sprintf("/api/damage-report/%d", report.ID), makeCourierJWT(3)).Code)
+}
@@ -1,20 +1,28 @@
 package handler
 
 import (
+	"deliverymanagement/internal/email"
+	"deliverymanagement/internal/geo"
+	"deliverymanagement/internal/jwtkeys"
 	"deliverymanagement/internal/model"
 	"deliverymanagement/internal/repo"
+	"deliverymanagement/internal/serviceability"
 	"deliverymanagement/pkg/rabbitmq"
 	"deliverymanagement/pkg/ws"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"math/rand"
 	"net/http"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/xuri/excelize/v2"
 )
 
@@ -22,43 +30,397 @@ type DeliveryHandler struct {
 	Deliveries repo.DeliveryRepository
 	Publisher  rabbitmq.Publisher
 	WSHub      *ws.Hub
+	Geocoder   geo.Geocoder
+	Zones      repo.ZoneRepository
+	// Serviceability, when set, refuses bookings we cannot serve and quotes
+	// the promised delivery date. Without it unzoned and unresolved
+	// deliveries are booked and flagged for dispatchers.
+	Serviceability *serviceability.Checker
+	COD            repo.CODRepository
+	Timeline       repo.TimelineRepository
+	// Returns creates reverse deliveries once MaxAttempts failed attempts
+	// have been recorded; optional.
+	Returns     *ReturnHandler
+	MaxAttempts int // defaults to 3
+	// Users and Notifications are used to alert dispatchers; both are optional.
+	Users         repo.UserRepository
+	Notifications *NotificationHandler
+	// RejectUnresolvedAddresses refuses deliveries whose addresses cannot be
+	// geocoded instead of flagging them for review.
+	RejectUnresolvedAddresses bool
+	PickupPoints              repo.PickupPointRepository // optional
+	// HandoverCodes backs the OTP mode; deliveries requiring a code cannot be
+	// sent out without it.
+	HandoverCodes       repo.HandoverCodeRepository
+	HandoverTTL         time.Duration // defaults to 12h
+	MaxHandoverAttempts int           // defaults to 3
+	Audit               repo.AuditLogRepository
+	// Vehicles, when set, loads assigned deliveries onto the courier's vehicle
+	// and enforces its capacity.
+	Vehicles repo.VehicleRepository
+	// RecipientLinks, when set, adds the self-service link to delivery emails.
+	RecipientLinks *RecipientLinks
+	// BulkJobs keeps the progress of bulk operations run in the background;
+	// without it every bulk operation runs synchronously.
+	BulkJobs           repo.BulkJobRepository
+	BulkAsyncThreshold int // defaults to 100 deliveries
+	// CustomFields holds the per-client field definitions deliveries are
+	// validated against; without it no custom fields are accepted.
+	CustomFields repo.CustomFieldRepository
+}
+
+const defaultCurrency = "KZT"
+
+var currencyRe = regexp.MustCompile(`^[A-Z]{3}$`)
+
+type addressInput struct {
+	Street     string `json:"street"`
+	Building   string `json:"building"`
+	City       string `json:"city"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"`
+}
+
+// toAddress uses the structured input when present and parses the legacy
+// single-line string otherwise.
+func (in *addressInput) toAddress(raw string) model.Address {
+	if in == nil {
+		return geo.ParseAddress(raw)
+	}
+	return model.Address{
+		Street:     in.Street,
+		Building:   in.Building,
+		City:       in.City,
+		PostalCode: in.PostalCode,
+		Country:    in.Country,
+	}
 }
 
 func (h *DeliveryHandler) CreateDelivery(c *gin.Context) {
-	_, ok := c.Get("user_id")
+	userID, ok := c.Get("user_id")
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
 	var req struct {
-		FromAddress string `json:"from_address"`
-		ToAddress   string `json:"to_address"`
+		FromAddress  string        `json:"from_address"`
+		ToAddress    string        `json:"to_address"`
+		From         *addressInput `json:"from"`
+		To           *addressInput `json:"to"`
+		ServiceLevel string        `json:"service_level"`
+		CODAmount    int64         `json:"cod_amount"` // minor units
+		CODCurrency  string        `json:"cod_currency"`
+		// DeclaredValue is the insured value in minor units; damage claims
+		// cannot exceed it.
+		DeclaredValue    int64   `json:"declared_value"`
+		DeclaredCurrency string  `json:"declared_currency"`
+		LengthCm         float64 `json:"length_cm"`
+		WidthCm          float64 `json:"width_cm"`
+		HeightCm         float64 `json:"height_cm"`
+		WeightKg         float64 `json:"weight_kg"`
+		// PickupPointID replaces the destination address with a pickup point.
+		PickupPointID  uint   `json:"pickup_point_id"`
+		RecipientEmail string `json:"recipient_email"`
+		RequireOTP     bool   `json:"require_otp"`
+		Refrigerated   bool   `json:"refrigerated"`
+		// Tags and CustomFields hold the client's own data; custom fields
+		// are validated against the client's definitions.
+		Tags         []string               `json:"tags"`
+		CustomFields map[string]interface{} `json:"custom_fields"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
 		return
 	}
+	customFields, err := validateCustomFields(h.CustomFields, userID.(uint), nil, req.CustomFields)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field": "custom_fields"})
+		return
+	}
+	tags, err := validateTags(req.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field": "tags"})
+		return
+	}
+	if req.LengthCm < 0 || req.WidthCm < 0 || req.HeightCm < 0 || req.WeightKg < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dimensions and weight must not be negative"})
+		return
+	}
+	var point *model.PickupPoint
+	if req.PickupPointID != 0 {
+		var err error
+		if h.PickupPoints != nil {
+			point, err = h.PickupPoints.GetPickupPoint(req.PickupPointID)
+		}
+		if point == nil || err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown pickup point"})
+			return
+		}
+		if req.CODAmount > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cash on delivery is not available at pickup points"})
+			return
+		}
+		if req.RecipientEmail == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "recipient_email is required for pickup points, the collection PIN is sent there"})
+			return
+		}
+	}
+	if req.CODAmount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cod_amount must not be negative"})
+		return
+	}
+	if req.CODAmount > 0 && req.CODCurrency == "" {
+		req.CODCurrency = defaultCurrency
+	}
+	if req.CODCurrency != "" && !currencyRe.MatchString(req.CODCurrency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cod_currency"})
+		return
+	}
+	if req.DeclaredValue < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "declared_value must not be negative"})
+		return
+	}
+	if req.DeclaredValue > 0 && req.DeclaredCurrency == "" {
+		req.DeclaredCurrency = defaultCurrency
+	}
+	if req.DeclaredCurrency != "" && !currencyRe.MatchString(req.DeclaredCurrency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid declared_currency"})
+		return
+	}
 	delivery := &model.Delivery{
-		FromAddress: req.FromAddress,
-		ToAddress:   req.ToAddress,
-		Status:      "CREATED",
+		ClientID:         userID.(uint),
+		Status:           "CREATED",
+		CreatedAt:        time.Now(),
+		CODAmount:        req.CODAmount,
+		CODCurrency:      req.CODCurrency,
+		DeclaredValue:    req.DeclaredValue,
+		DeclaredCurrency: req.DeclaredCurrency,
+		LengthCm:         req.LengthCm,
+		WidthCm:          req.WidthCm,
+		HeightCm:         req.HeightCm,
+		WeightKg:         req.WeightKg,
+		PickupPointID:    req.PickupPointID,
+		RecipientEmail:   req.RecipientEmail,
+		RequireOTP:       req.RequireOTP,
+		Refrigerated:     req.Refrigerated,
+		Tags:             tags,
+		CustomFields:     customFields,
+	}
+	var unresolved bool
+	for _, a := range []struct {
+		field string
+		in    *addressInput
+		raw   string
+		dst   *model.Address
+	}{
+		{"from", req.From, req.FromAddress, &delivery.Origin},
+		{"to", req.To, req.ToAddress, &delivery.Destination},
+	} {
+		if a.field == "to" && point != nil {
+			delivery.Destination = point.Address
+			unresolved = unresolved || !point.Address.Geocoded
+			continue
+		}
+		addr, err := geo.Resolve(h.Geocoder, a.in.toAddress(a.raw))
+		switch {
+		case errors.Is(err, geo.ErrNotFound):
+			if h.RejectUnresolvedAddresses {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "unresolvable address", "field": a.field})
+				return
+			}
+			unresolved = true
+		case err != nil:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field": a.field})
+			return
+		}
+		*a.dst = addr
+	}
+	delivery.FromAddress = delivery.Origin.String()
+	delivery.ToAddress = delivery.Destination.String()
+	delivery.AddressUnresolved = unresolved
+	delivery.ServiceLevel = req.ServiceLevel
+	if h.Serviceability != nil {
+		res := h.Serviceability.Check(delivery.Origin, delivery.Destination)
+		if !res.Serviceable {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "not serviceable", "reason": res.Reason})
+			return
+		}
+		if req.ServiceLevel == "" {
+			req.ServiceLevel = res.Options[0].Level
+		}
+		opt, ok := res.Option(req.ServiceLevel)
+		if !ok {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "service level not available", "service_levels": res.Options})
+			return
+		}
+		delivery.ServiceLevel = opt.Level
+		delivery.PromisedDate, _ = time.Parse("2006-01-02", opt.EarliestDelivery)
 	}
+	h.assignZone(delivery)
 	if err := h.Deliveries.CreateDelivery(delivery); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	delivery.TrackingNumber = trackingNumber("DM", delivery.ID)
+	if err := h.Deliveries.UpdateDelivery(delivery); err != nil {
+		updateFailed(c, err)
+		return
+	}
+	recordTimeline(h.Timeline, delivery.ID, delivery.ClientID, "created", "Delivery booked", nil)
+	if h.Zones != nil && delivery.ZoneID == 0 {
+		notifyRole(h.Users, h.Notifications, "dispatcher", model.Notification{
+			Type:    "delivery.unzoned",
+			Message: fmt.Sprintf("Delivery #%d is outside every delivery zone", delivery.ID),
+			Data:    map[string]interface{}{"delivery_id": delivery.ID, "to": delivery.ToAddress},
+		})
+	}
 	// Publish event to email.queue
 	if h.Publisher != nil {
-		h.Publisher.Publish("email.queue", map[string]interface{}{
+		event := map[string]interface{}{
 			"event":       "delivery.created",
 			"delivery_id": delivery.ID,
 			"from":        delivery.FromAddress,
 			"to":          delivery.ToAddress,
-		})
+			"unresolved":  delivery.AddressUnresolved,
+		}
+		if h.RecipientLinks != nil {
+			manageURL := h.RecipientLinks.URL(delivery.ID)
+			event["manage_url"] = manageURL
+			if delivery.RecipientEmail != "" {
+				h.Publisher.Publish("email.queue", map[string]interface{}{
+					"to":      delivery.RecipientEmail,
+					"subject": "Your parcel " + delivery.TrackingNumber + " is on its way",
+					"body":    "Choose a delivery window, a pickup point or leave instructions: " + manageURL,
+				})
+			}
+		}
+		h.Publisher.Publish("email.queue", event)
 	}
 	c.JSON(http.StatusOK, delivery)
 }
 
+// assignZone zones the delivery by its geocoded destination.
+func (h *DeliveryHandler) assignZone(d *model.Delivery) {
+	d.ZoneID = zoneFor(h.Zones, d.Destination)
+}
+
+// zoneFor returns the ID of the zone containing the address, or 0.
+func zoneFor(zones repo.ZoneRepository, a model.Address) uint {
+	if zones == nil || !a.Geocoded {
+		return 0
+	}
+	list, _ := zones.ListZones()
+	if z := geo.FindZone(list, geo.Point{Lat: a.Lat, Lng: a.Lng}); z != nil {
+		return z.ID
+	}
+	return 0
+}
+
+// trackingNumber builds a UPU S10 style identifier: a two-letter service
+// prefix, an eight-digit serial, a check digit and the origin country.
+func trackingNumber(prefix string, serial uint) string {
+	digits := fmt.Sprintf("%08d", serial%100000000)
+	weights := []int{8, 6, 4, 2, 3, 5, 9, 7}
+	sum := 0
+	for i, ch := range digits {
+		sum += int(ch-'0') * weights[i]
+	}
+	check := 11 - sum%11
+	switch check {
+	case 10:
+		check = 0
+	case 11:
+		check = 5
+	}
+	return fmt.Sprintf("%s%s%dKZ", prefix, digits, check)
+}
+
+// GET /api/deliveries
+func (h *DeliveryHandler) ListDeliveries(c *gin.Context) {
+	deliveries, _ := h.Deliveries.ListDeliveries()
+	c.JSON(http.StatusOK, filterDeliveries(c, deliveries))
+}
+
+// filterDeliveries applies the list filters shared by listing, export and
+// analytics: ?status=, ?zone_id= (0 selects unzoned deliveries), ?courier_id=,
+// ?template_id=, ?tag= (repeatable, all must be present) and ?cf.<key>=
+// matching a custom field value. Results are ordered by ID.
+func filterDeliveries(c *gin.Context, deliveries []model.Delivery) []model.Delivery {
+	status := c.Query("status")
+	tags := c.QueryArray("tag")
+	fields := map[string]string{}
+	for k, v := range c.Request.URL.Query() {
+		if strings.HasPrefix(k, "cf.") {
+			fields[strings.TrimPrefix(k, "cf.")] = v[0]
+		}
+	}
+	zoneID, zoneErr := strconv.ParseUint(c.Query("zone_id"), 10, 64)
+	courierID, courierErr := strconv.ParseUint(c.Query("courier_id"), 10, 64)
+	templateID, templateErr := strconv.ParseUint(c.Query("template_id"), 10, 64)
+	out := make([]model.Delivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		if status != "" && d.Status != status {
+			continue
+		}
+		if zoneErr == nil && d.ZoneID != uint(zoneID) {
+			continue
+		}
+		if courierErr == nil && d.CourierID != uint(courierID) {
+			continue
+		}
+		if templateErr == nil && d.TemplateID != uint(templateID) {
+			continue
+		}
+		if !hasTags(d.Tags, tags) || !hasCustomFields(d.CustomFields, fields) {
+			continue
+		}
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// checkListFilters reports whether the query sets at least one filter that
+// filterDeliveries applies, and fails when a numeric filter does not parse.
+func checkListFilters(c *gin.Context) (bool, error) {
+	q := c.Request.URL.Query()
+	found := false
+	for k := range q {
+		switch {
+		case k == "zone_id" || k == "courier_id" || k == "template_id":
+			if _, err := strconv.ParseUint(q.Get(k), 10, 64); err != nil {
+				return false, fmt.Errorf("invalid %s %q", k, q.Get(k))
+			}
+			found = true
+		case k == "status" || k == "tag" || strings.HasPrefix(k, "cf."):
+			found = found || q.Get(k) != ""
+		}
+	}
+	return found, nil
+}
+
+func hasTags(have, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, t := range have {
+			found = found || t == w
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func hasCustomFields(have, want map[string]string) bool {
+	for k, v := range want {
+		if got, ok := have[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
 func (h *DeliveryHandler) GetDelivery(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 64)
@@ -71,31 +433,45 @@ func (h *DeliveryHandler) GetDelivery(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 		return
 	}
+	c.Header("ETag", deliveryETag(delivery))
+	if match := c.GetHeader("If-None-Match"); match != "" && etagMatches(match, deliveryETag(delivery)) {
+		c.Status(http.StatusNotModified)
+		return
+	}
 	c.JSON(http.StatusOK, delivery)
 }
 
 // JWT middleware
 func JWTAuthMiddleware(secret []byte) gin.HandlerFunc {
+	return JWTAuth(jwtkeys.NewHS256(secret), nil)
+}
+
+// JWTAuth verifies bearer tokens with the key manager, which checks the
+// algorithm, issuer and audience, and refuses access tokens whose jti has
+// been revoked, e.g. at logout or when an admin disables the user. tokens
+// is optional.
+func JWTAuth(keys *jwtkeys.Manager, tokens repo.TokenRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		header := c.GetHeader("Authorization")
 		if len(header) < 8 || header[:7] != "Bearer " {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing or invalid token"})
 			return
 		}
-		tokenStr := header[7:]
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			return secret, nil
-		})
-		if err != nil || !token.Valid {
+		claims, err := keys.Parse(header[7:])
+		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			return
 		}
-		claims, ok := token.Claims.(jwt.MapClaims)
+		userID, ok := claims["user_id"].(float64)
 		if !ok {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token claims"})
 			return
 		}
-		c.Set("user_id", uint(claims["user_id"].(float64)))
+		if jti, _ := claims["jti"].(string); tokens != nil && jti != "" && tokens.IsAccessTokenRevoked(jti) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token revoked"})
+			return
+		}
+		c.Set("user_id", uint(userID))
 		c.Set("role", claims["role"])
 		c.Next()
 	}
@@ -113,6 +489,30 @@ func DispatcherOnly() gin.HandlerFunc {
 	}
 }
 
+// Role middleware for admins
+func AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, ok := c.Get("role")
+		if !ok || role != "admin" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin only"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Role middleware for dispatchers and admins, e.g. claim reviewers
+func DispatcherOrAdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, ok := c.Get("role")
+		if !ok || (role != "dispatcher" && role != "admin") {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "dispatcher or admin only"})
+			return
+		}
+		c.Next()
+	}
+}
+
 // Assign a courier to a delivery (dispatcher only)
 func (h *DeliveryHandler) AssignDelivery(c *gin.Context) {
 	idStr := c.Param("id")
@@ -123,26 +523,272 @@ func (h *DeliveryHandler) AssignDelivery(c *gin.Context) {
 	}
 	var req struct {
 		CourierID uint `json:"courier_id"`
+		// VehicleID defaults to the vehicle of the courier's current shift.
+		VehicleID uint `json:"vehicle_id"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
 		return
 	}
-	delivery, err := h.Deliveries.GetDelivery(uint(id))
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	delivery := deliveryForUpdate(c, h.Deliveries, uint(id))
+	if delivery == nil {
 		return
 	}
+	if err := h.assign(delivery, req.CourierID, req.VehicleID, c.GetUint("user_id")); err != nil {
+		switch {
+		case errors.Is(err, errUnknownVehicle):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, errVehicleCapacity):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			updateFailed(c, err)
+		}
+		return
+	}
+	c.Header("ETag", deliveryETag(delivery))
+	c.JSON(http.StatusOK, delivery)
+}
+
+var errUnknownVehicle = errors.New("unknown vehicle")
+
+// assign gives the delivery to a courier and loads it onto vehicleID, or the
+// vehicle of the courier's current shift when vehicleID is 0.
+func (h *DeliveryHandler) assign(delivery *model.Delivery, courierID, vehicleID, actorID uint) error {
+	loadOn := uint(0)
+	if h.Vehicles != nil {
+		if vehicleID == 0 {
+			if a, err := h.Vehicles.ActiveAssignment(courierID, time.Now()); err == nil {
+				vehicleID = a.VehicleID
+			}
+		}
+		if vehicleID != 0 {
+			v, err := h.Vehicles.GetVehicle(vehicleID)
+			if err != nil {
+				return errUnknownVehicle
+			}
+			vehicleLoads.Lock()
+			defer vehicleLoads.Unlock()
+			if err := checkVehicleCapacity(h.Deliveries, v, delivery); err != nil {
+				return err
+			}
+			loadOn = v.ID
+		}
+	}
 	delivery.Status = "ASSIGNED"
-	// Optionally, you could add delivery.CourierID = req.CourierID if model supports it
+	delivery.CourierID = courierID
+	delivery.VehicleID = loadOn
+	if err := h.Deliveries.UpdateDelivery(delivery); err != nil {
+		return err
+	}
+	recordTimeline(h.Timeline, delivery.ID, actorID, "assigned",
+		fmt.Sprintf("Assigned to courier #%d", courierID), map[string]interface{}{"courier_id": courierID})
+	return nil
+}
+
+// POST /api/deliveries/:id/deliver (courier only)
+// Completes the handover. For cash-on-delivery parcels the courier records
+// what was collected and how; mismatches surface in the daily reconciliation.
+func (h *DeliveryHandler) CompleteDelivery(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req struct {
+		CollectedAmount int64  `json:"collected_amount"`
+		Currency        string `json:"currency"`
+		PaymentMethod   string `json:"payment_method"`
+		HandoverCode    string `json:"handover_code"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	delivery := deliveryForUpdate(c, h.Deliveries, uint(id))
+	if delivery == nil {
+		return
+	}
+	courierID := c.GetUint("user_id")
+	if delivery.CourierID != courierID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "delivery is not assigned to you"})
+		return
+	}
+	// Parcels at a pickup point are collected with the locker PIN, and
+	// cancelled or returned ones are no longer out for handover.
+	switch delivery.Status {
+	case "ASSIGNED", "IN_TRANSIT", "OUT_FOR_DELIVERY":
+	case "DELIVERED":
+		c.JSON(http.StatusConflict, gin.H{"error": "already delivered"})
+		return
+	default:
+		c.JSON(http.StatusConflict, gin.H{"error": "delivery is " + delivery.Status})
+		return
+	}
+	if delivery.RequireOTP && !h.checkHandoverCode(c, delivery, req.HandoverCode) {
+		return
+	}
+	now := time.Now()
+	if delivery.CODAmount == 0 && req.CollectedAmount != 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "delivery has no cash on delivery"})
+		return
+	}
+	if delivery.CODAmount > 0 {
+		if req.PaymentMethod != "CASH" && req.PaymentMethod != "CARD" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "payment_method must be CASH or CARD"})
+			return
+		}
+		if req.Currency == "" {
+			req.Currency = delivery.CODCurrency
+		}
+		if req.Currency != delivery.CODCurrency || req.CollectedAmount < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "collected amount must be in " + delivery.CODCurrency})
+			return
+		}
+		if h.COD != nil {
+			if _, err := h.COD.GetCollectionByDelivery(delivery.ID); err == nil {
+				c.JSON(http.StatusConflict, gin.H{"error": "cod already collected for delivery"})
+				return
+			}
+		}
+	}
+	delivery.Status = "DELIVERED"
+	delivery.DeliveredAt = now
+	delivery.CourierID = courierID
+	if err := h.Deliveries.UpdateDelivery(delivery); err != nil {
+		updateFailed(c, err)
+		return
+	}
+	// The cash is recorded only once the delivery is, so a version conflict
+	// leaves nothing behind and the courier can simply retry.
+	if delivery.CODAmount > 0 && h.COD != nil {
+		if err := h.COD.CreateCollection(&model.CODCollection{
+			DeliveryID:    delivery.ID,
+			ClientID:      delivery.ClientID,
+			CourierID:     courierID,
+			Amount:        req.CollectedAmount,
+			Currency:      req.Currency,
+			PaymentMethod: req.PaymentMethod,
+			CollectedAt:   now,
+		}); err != nil {
+			log.Printf("delivery %d: recording cod collection: %v", delivery.ID, err)
+		}
+	}
+	c.Header("ETag", deliveryETag(delivery))
+	recordTimeline(h.Timeline, delivery.ID, courierID, "delivered", "Delivered to recipient", nil)
+	if h.Publisher != nil {
+		h.Publisher.Publish("email.queue", map[string]interface{}{
+			"event":       "delivery.delivered",
+			"delivery_id": delivery.ID,
+		})
+	}
 	c.JSON(http.StatusOK, delivery)
 }
 
+// POST /api/deliveries/:id/attempt-failed (courier only)
+// Records an unsuccessful delivery attempt. After MaxAttempts failures the
+// parcel is sent back to the sender through the regular return flow.
+func (h *DeliveryHandler) FailAttempt(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	delivery := deliveryForUpdate(c, h.Deliveries, uint(id))
+	if delivery == nil {
+		return
+	}
+	courierID := c.GetUint("user_id")
+	if delivery.CourierID != 0 && delivery.CourierID != courierID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "delivery is assigned to another courier"})
+		return
+	}
+	if delivery.Status == "DELIVERED" || delivery.Status == "RETURN_TO_SENDER" {
+		c.JSON(http.StatusConflict, gin.H{"error": "delivery is " + delivery.Status})
+		return
+	}
+	delivery.FailedAttempts++
+	delivery.Status = "ATTEMPT_FAILED"
+	if err := h.Deliveries.UpdateDelivery(delivery); err != nil {
+		updateFailed(c, err)
+		return
+	}
+	recordTimeline(h.Timeline, delivery.ID, courierID, "attempt_failed",
+		fmt.Sprintf("Delivery attempt %d failed: %s", delivery.FailedAttempts, req.Reason),
+		map[string]interface{}{"attempt": delivery.FailedAttempts, "reason": req.Reason})
+
+	maxAttempts := h.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = 3
+	}
+	resp := gin.H{"delivery": delivery}
+	if h.Returns != nil && delivery.FailedAttempts >= maxAttempts {
+		ret, reverse, err := h.Returns.CreateReturnFor(delivery, model.ReturnReasonFailedAttempts, req.Reason, 0)
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		resp["return"] = ret
+		resp["return_delivery"] = reverse
+	}
+	c.Header("ETag", deliveryETag(delivery))
+	c.JSON(http.StatusOK, resp)
+}
+
+// GET /api/deliveries/:id/label
+func (h *DeliveryHandler) GetLabel(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	d, err := h.Deliveries.GetDelivery(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	html, err := email.RenderTemplate("label.html", map[string]interface{}{
+		"TrackingNumber": d.TrackingNumber,
+		"From":           d.FromAddress,
+		"To":             d.ToAddress,
+		"ServiceLevel":   d.ServiceLevel,
+		"ZoneID":         d.ZoneID,
+		"CODAmount":      d.CODAmount,
+		"CODCurrency":    d.CODCurrency,
+		"IsReturn":       d.ReturnOf != 0,
+		"ReturnOf":       d.ReturnOf,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not render label"})
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
+}
+
+// Role middleware for couriers
+func CourierOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, ok := c.Get("role")
+		if !ok || role != "courier" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "courier only"})
+			return
+		}
+		c.Next()
+	}
+}
+
 // Handler for scan events
 
 type ScanEventHandler struct {
 	ScanEvents repo.ScanEventRepository
-	WSHub     *ws.Hub
+	WSHub      *ws.Hub
+	Timeline   repo.TimelineRepository
 }
 
 // Middleware for courier or warehouse roles
@@ -186,6 +832,9 @@ func (h *ScanEventHandler) CreateScanEvent(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	recordTimeline(h.Timeline, event.DeliveryID, c.GetUint("user_id"), "scan",
+		fmt.Sprintf("Scanned %s at %s", event.EventType, event.Location),
+		map[string]interface{}{"event_type": event.EventType, "location": event.Location})
 	// Broadcast to WebSocket clients for this delivery
 	if h.WSHub != nil {
 		h.WSHub.Publish(fmt.Sprint(event.DeliveryID), mapToJSON(map[string]interface{}{
@@ -204,28 +853,59 @@ func mapToJSON(m map[string]interface{}) []byte {
 	return b
 }
 
+// extraHeaders returns the custom field keys used by the exported deliveries
+// and the extra column headers: Tags, then one column per key.
+func extraHeaders(deliveries []model.Delivery) ([]string, []string) {
+	seen := map[string]bool{}
+	keys := []string{}
+	for _, d := range deliveries {
+		for k := range d.CustomFields {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys, append([]string{"Tags"}, keys...)
+}
+
+func extraColumns(d model.Delivery, keys []string) []string {
+	row := []string{strings.Join(d.Tags, ";")}
+	for _, k := range keys {
+		row = append(row, d.CustomFields[k])
+	}
+	return row
+}
+
 func (h *DeliveryHandler) ExportDeliveries(c *gin.Context) {
 	format := c.DefaultQuery("format", "csv")
-	deliveries, _ := h.Deliveries.ListDeliveries() // Assume this returns []model.Delivery
+	deliveries, _ := h.Deliveries.ListDeliveries()
+	deliveries = filterDeliveries(c, deliveries)
 	if len(deliveries) <= 1000 {
+		keys, extra := extraHeaders(deliveries)
 		// Sync export
 		if format == "csv" {
 			c.Header("Content-Disposition", "attachment; filename=deliveries.csv")
 			c.Header("Content-Type", "text/csv")
 			w := csv.NewWriter(c.Writer)
-			w.Write([]string{"ID", "FromAddress", "ToAddress", "Status"})
+			w.Write(append([]string{"ID", "FromAddress", "ToAddress", "Status", "ZoneID"}, extra...))
 			for _, d := range deliveries {
-				w.Write([]string{
-					strconv.Itoa(int(d.ID)), d.FromAddress, d.ToAddress, d.Status,
-				})
+				w.Write(append([]string{
+					strconv.Itoa(int(d.ID)), d.FromAddress, d.ToAddress, d.Status, strconv.Itoa(int(d.ZoneID)),
+				}, extraColumns(d, keys)...))
 			}
 			w.Flush()
 			return
 		} else if format == "xlsx" {
 			f := excelize.NewFile()
-			f.SetSheetRow("Sheet1", "A1", &[]string{"ID", "FromAddress", "ToAddress", "Status"})
+			header := append([]string{"ID", "FromAddress", "ToAddress", "Status", "ZoneID"}, extra...)
+			f.SetSheetRow("Sheet1", "A1", &header)
 			for i, d := range deliveries {
-				row := []interface{}{d.ID, d.FromAddress, d.ToAddress, d.Status}
+				row := []interface{}{d.ID, d.FromAddress, d.ToAddress, d.Status, d.ZoneID}
+				for _, v := range extraColumns(d, keys) {
+					row = append(row, v)
+				}
 				f.SetSheetRow("Sheet1", fmt.Sprintf("A%d", i+2), &row)
 			}
 			c.Header("Content-Disposition", "attachment; filename=deliveries.xlsx")
@@ -243,6 +923,7 @@ func (h *DeliveryHandler) ExportDeliveries(c *gin.Context) {
 			"job_id": jobID,
 			"format": format,
 			"email":  c.Query("email"),
+			"filter": c.Request.URL.Query(),
 		})
 	}
 	c.JSON(202, gin.H{"job_id": jobID})
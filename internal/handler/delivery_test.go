@@ -2,13 +2,16 @@ package handler
 
 import (
 	"bytes"
+	"deliverymanagement/internal/geo"
 	"deliverymanagement/internal/model"
 	"deliverymanagement/internal/repo"
+	"deliverymanagement/internal/storage"
 	"encoding/json"
 	"fmt"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -59,6 +62,37 @@ func makeWarehouseJWT(userID uint) string {
 	return t
 }
 
+func makeAdminJWT(userID uint) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": userID,
+		"role":    "admin",
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	})
+	t, _ := token.SignedString(testSecret)
+	return t
+}
+
+// serveJSON sends a request through r and returns the response. body is
+// sent as is when it is a string and encoded as JSON otherwise; token, when
+// set, goes in the Authorization header and headers are name, value pairs.
+func serveJSON(r http.Handler, method, path, token string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	b, ok := body.(string)
+	if !ok {
+		raw, _ := json.Marshal(body)
+		b = string(raw)
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, strings.NewReader(b))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
 func setupDeliveryRouter() (*gin.Engine, *repo.InMemoryDeliveryRepo) {
 	repo := repo.NewInMemoryDeliveryRepo()
 	h := &DeliveryHandler{Deliveries: repo}
@@ -92,7 +126,7 @@ func setupScanRouter() (*gin.Engine, *repo.InMemoryScanEventRepo) {
 
 func setupDamageReportRouter() (*gin.Engine, *repo.InMemoryDamageReportRepo) {
 	repo := repo.NewInMemoryDamageReportRepo()
-	h := &DamageReportHandler{DamageReports: repo}
+	h := &DamageReportHandler{DamageReports: repo, Blobs: storage.NewMemoryStore()}
 	r := gin.Default()
 	r.POST("/api/damage-report", JWTAuthMiddleware(testSecret), CourierOrWarehouseOnly(), h.CreateDamageReport)
 	return r, repo
@@ -251,7 +285,7 @@ func TestDamageReportHandlers(t *testing.T) {
 	_ = writer.WriteField("type", "box damaged")
 	_ = writer.WriteField("description", "Corner crushed")
 	fw, _ := writer.CreateFormFile("photo", "photo.jpg")
-	fw.Write([]byte("imagedata"))
+	fw.Write(testJPEG())
 	writer.Close()
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/api/damage-report", body)
@@ -313,3 +347,50 @@ func TestDamageReportHandlers(t *testing.T) {
 	assert.Len(t, reports, 1)
 	assert.Equal(t, "box damaged", reports[0].Type)
 }
+
+func TestCreateDeliveryNormalizesAndGeocodes(t *testing.T) {
+	gz, _ := geo.LoadGazetteer(strings.NewReader("KZ,050000,Almaty,43.2389,76.8897\n"))
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	h := &DeliveryHandler{Deliveries: deliveries, Geocoder: gz}
+	r := gin.Default()
+	r.POST("/api/deliveries", JWTAuthMiddleware(testSecret), h.CreateDelivery)
+	post := func(body interface{}) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/deliveries", bytes.NewReader(b))
+		req.Header.Set("Authorization", "Bearer "+makeJWT(1))
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Structured destination, legacy origin string
+	w := post(map[string]interface{}{
+		"from_address": "abay ave 10, almaty, 050000, kazakhstan",
+		"to":           map[string]string{"street": "tole bi  st", "building": "5a", "city": "almaty", "postal_code": "050 000", "country": "KZ"},
+	})
+	assert.Equal(t, 200, w.Code)
+	var created model.Delivery
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Equal(t, "Tole Bi Street 5A, Almaty, 050000, KZ", created.ToAddress)
+	assert.True(t, created.Destination.Geocoded)
+	assert.Equal(t, 43.2389, created.Destination.Lat)
+	assert.False(t, created.AddressUnresolved)
+
+	// Invalid postal code is rejected
+	w = post(map[string]interface{}{
+		"from_address": "Abay 10, Almaty, Kazakhstan",
+		"to":           map[string]string{"street": "Tole Bi", "city": "Almaty", "postal_code": "12", "country": "KZ"},
+	})
+	assert.Equal(t, 400, w.Code)
+
+	// Unknown city is flagged by default...
+	w = post(map[string]string{"from_address": "Abay 10, Almaty, Kazakhstan", "to_address": "Lenin 1, Nowhere, Kazakhstan"})
+	assert.Equal(t, 200, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.True(t, created.AddressUnresolved)
+
+	// ...and rejected when configured
+	h.RejectUnresolvedAddresses = true
+	w = post(map[string]string{"from_address": "Abay 10, Almaty, Kazakhstan", "to_address": "Lenin 1, Nowhere, Kazakhstan"})
+	assert.Equal(t, 422, w.Code)
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// deliveryETag identifies one version of a delivery.
+func deliveryETag(d *model.Delivery) string {
+	return fmt.Sprintf(`"%d-%d"`, d.ID, d.Version)
+}
+
+// RequireIfMatch refuses mutating requests without an If-Match header with
+// 428, so clients cannot overwrite changes they have not seen. The handlers
+// compare the header with the delivery's current ETag.
+func RequireIfMatch() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("If-Match") == "" {
+			c.AbortWithStatusJSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header is required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// deliveryForUpdate loads the delivery a mutating request targets. When the
+// request carries If-Match, it must match the current ETag; otherwise 412 is
+// written along with the current ETag and nil returned.
+func deliveryForUpdate(c *gin.Context, deliveries repo.DeliveryRepository, id uint) *model.Delivery {
+	d, err := deliveries.GetDelivery(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return nil
+	}
+	if match := c.GetHeader("If-Match"); match != "" && !etagMatches(match, deliveryETag(d)) {
+		c.Header("ETag", deliveryETag(d))
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "delivery has changed, reload it and try again", "version": d.Version})
+		return nil
+	}
+	return d
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header lists etag.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// updateFailed writes the response for a failed UpdateDelivery: 409 when a
+// concurrent change won the race, 500 otherwise.
+func updateFailed(c *gin.Context, err error) {
+	if errors.Is(err, repo.ErrVersionConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeliveryETags(t *testing.T) {
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	deliveries.CreateDelivery(&model.Delivery{Status: "CREATED"})
+	h := &DeliveryHandler{Deliveries: deliveries}
+	r := gin.Default()
+	api := r.Group("/api/deliveries", JWTAuthMiddleware(testSecret))
+	api.GET(":id", h.GetDelivery)
+	api.POST(":id/assign", DispatcherOnly(), RequireIfMatch(), h.AssignDelivery)
+	do := func(method, path, ifMatch string, headers ...string) *httptest.ResponseRecorder {
+		if ifMatch != "" {
+			headers = append(headers, "If-Match", ifMatch)
+		}
+		return serveJSON(r, method, path, makeDispatcherJWT(9), `{"courier_id": 5}`, headers...)
+	}
+
+	w := do("GET", "/api/deliveries/1", "")
+	assert.Equal(t, 200, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.Equal(t, `"1-1"`, etag)
+	assert.Equal(t, 304, do("GET", "/api/deliveries/1", "", "If-None-Match", etag).Code)
+
+	assert.Equal(t, 428, do("POST", "/api/deliveries/1/assign", "").Code)
+	w = do("POST", "/api/deliveries/1/assign", etag)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, `"1-2"`, w.Header().Get("ETag"))
+
+	// A second dispatcher still holding the old version is refused
+	w = do("POST", "/api/deliveries/1/assign", etag)
+	assert.Equal(t, 412, w.Code)
+	assert.Equal(t, `"1-2"`, w.Header().Get("ETag"))
+	assert.Equal(t, 200, do("POST", "/api/deliveries/1/assign", `W/"1-2"`).Code)
+	assert.Equal(t, 200, do("GET", "/api/deliveries/1", "", "If-None-Match", etag).Code)
+}
+
+func TestUpdateFailedStatus(t *testing.T) {
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	deliveries.CreateDelivery(&model.Delivery{Status: "CREATED"})
+	stale, _ := deliveries.GetDelivery(1)
+	fresh, _ := deliveries.GetDelivery(1)
+	deliveries.UpdateDelivery(fresh)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	updateFailed(c, deliveries.UpdateDelivery(stale))
+	assert.Equal(t, 409, w.Code)
+}
@@ -1,41 +1,172 @@
 package handler
 
 import (
+	"deliverymanagement/internal/model"
 	"deliverymanagement/internal/repo"
+	"deliverymanagement/internal/storage"
+	"errors"
+	"mime"
 	"net/http"
-	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type FileHandler struct {
 	DamageReports repo.DamageReportRepository
+	Blobs         storage.BlobStore
+	// Comments and Deliveries grant access to comment attachments; optional.
+	Comments   repo.CommentRepository
+	Deliveries repo.DeliveryRepository
+	// Links mints and checks signed download URLs; optional.
+	Links *FileLinks
+	// Audit records refused requests; optional.
+	Audit repo.AuditLogRepository
+	// Scanner withholds files until they are scanned clean; optional.
+	Scanner *FileScanner
 }
 
-// GET /files/:filename
+// GET /files/:filename?size=thumb|medium|original&download=1
+// Images have thumb and medium variants; documents only the original.
+// Callers authenticate with a bearer token or a signed link (see
+// Authenticate). Range, If-None-Match and If-Range requests are
+// supported; download=1 asks the browser to save the file. Files not yet
+// scanned clean answer 423.
 func (h *FileHandler) ServeFile(c *gin.Context) {
 	filename := c.Param("filename")
-	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
-	reports := h.DamageReports.ListDamageReports(0) // get all
-	var allowed bool
-	for _, r := range reports {
-		if r.PhotoPath == filename {
-			if role == "admin" || role == "dispatcher" || userID == r.DeliveryID {
-				allowed = true
-				break
-			}
-		}
+	size := c.DefaultQuery("size", "original")
+	if !validFileSize(size) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "size must be thumb, medium or original"})
+		return
 	}
-	if !allowed {
-		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+	allowed, name := h.canAccess(c, filename)
+	if !allowed && !signedFor(c) {
+		h.denied(c, filename)
 		return
 	}
-	path := filepath.Join("uploads", filename)
-	if _, err := os.Stat(path); os.IsNotExist(err) {
+	if fs := h.Scanner.status(filename); fs != nil && fs.Status != model.ScanClean {
+		msg := "file is awaiting a malware scan"
+		if fs.Status == model.ScanInfected {
+			msg = "file is quarantined"
+		}
+		c.JSON(http.StatusLocked, gin.H{"error": msg, "scan": fs.Status})
+		return
+	}
+	key := filename
+	if size != "original" {
+		key = variantPath(filename, size)
+	}
+	blob, info, err := h.Blobs.Get(c.Request.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 		return
 	}
-	c.File(path)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not read file"})
+		return
+	}
+	defer blob.Close()
+	if info.ContentType != "" {
+		c.Header("Content-Type", info.ContentType)
+	}
+	// Keys are content hashes, so the key identifies the bytes.
+	c.Header("ETag", `"`+key+`"`)
+	c.Header("Cache-Control", "private, max-age=3600")
+	disposition := "inline"
+	if c.Query("download") == "1" {
+		disposition = "attachment"
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": downloadName(name, filename, size)}))
+	http.ServeContent(c.Writer, c.Request, key, info.ModTime, blob)
+}
+
+// canAccess reports whether the caller may read the file and returns the
+// name it was uploaded under, if known, even when access is refused. A file is readable through the
+// delivery it belongs to: by its client and assigned courier, by whoever
+// reported the damage, and by dispatchers and admins. Comment attachments
+// also follow the comment's visibility. Identical uploads share one file,
+// so every record holding it is asked and any of them may grant access.
+func (h *FileHandler) canAccess(c *gin.Context, filename string) (bool, string) {
+	role, userID := c.GetString("role"), c.GetUint("user_id")
+	firstName := ""
+	for _, report := range h.DamageReports.FindDamageReportsByFile(filename) {
+		name := report.AttachmentName(filename)
+		if firstName == "" {
+			firstName = name
+		}
+		if role == "admin" || role == "dispatcher" || (userID != 0 && report.ReporterID == userID) {
+			return true, name
+		}
+		var d *model.Delivery
+		if h.Deliveries != nil {
+			d, _ = h.Deliveries.GetDelivery(report.DeliveryID)
+		}
+		if d != nil && isDeliveryParty(role, userID, d) {
+			return true, name
+		}
+	}
+	if h.Comments == nil || h.Deliveries == nil {
+		return false, firstName
+	}
+	for _, cm := range h.Comments.FindCommentsByAttachment(filename) {
+		name := ""
+		for _, a := range cm.Attachments {
+			if a.Path == filename {
+				name = a.Name
+			}
+		}
+		if firstName == "" {
+			firstName = name
+		}
+		d, err := h.Deliveries.GetDelivery(cm.DeliveryID)
+		if err == nil && canSee(role, cm.Visibility) && canComment(role, userID, d) {
+			return true, name
+		}
+	}
+	return false, firstName
+}
+
+// isDeliveryParty reports whether the caller is the delivery's client or its
+// assigned courier.
+func isDeliveryParty(role string, userID uint, d *model.Delivery) bool {
+	switch role {
+	case "client":
+		return d.ClientID == userID
+	case "courier":
+		return d.CourierID == userID
+	}
+	return false
+}
+
+// denied audits a refused file request and writes 403.
+func (h *FileHandler) denied(c *gin.Context, filename string) {
+	if h.Audit != nil {
+		h.Audit.CreateAudit(&model.AuditLog{
+			UserID:    c.GetUint("user_id"),
+			Action:    "file.read",
+			Resource:  "file:" + filename,
+			Success:   false,
+			Timestamp: time.Now().Unix(),
+		})
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+}
+
+func validFileSize(size string) bool {
+	return size == "original" || size == "thumb" || size == "medium"
+}
+
+// downloadName is the uploaded name with the stored extension, which may
+// differ after re-encoding, and the variant appended.
+func downloadName(name, filename, size string) string {
+	if name == "" {
+		name = filename
+	}
+	base := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	if size != "original" {
+		base += "_" + size
+	}
+	return base + filepath.Ext(filename)
 }
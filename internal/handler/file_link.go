@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"deliverymanagement/internal/model"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultFileLinkTTL = 15 * time.Minute
+	maxFileLinkTTL     = 24 * time.Hour
+)
+
+var (
+	errInvalidFileLink = errors.New("invalid or expired link")
+	audienceRe         = regexp.MustCompile(`^[A-Za-z0-9:._-]{1,64}$`)
+)
+
+// FileLinks signs download URLs for email links and <img> tags, which
+// cannot send a bearer token. A link is bound to one file, one size and an
+// audience naming who it was minted for. Links for "user:<id>" are only
+// honoured together with that user's bearer token; other audiences, e.g.
+// "email", let in whoever holds the link.
+type FileLinks struct {
+	Secret []byte
+	TTL    time.Duration // defaults to 15 minutes
+}
+
+func (l *FileLinks) sign(filename, size, audience string, exp int64) string {
+	mac := hmac.New(sha256.New, l.Secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%d", filename, size, audience, exp)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// URL returns the signed path and query for the file, valid for ttl (TTL
+// when 0).
+func (l *FileLinks) URL(filename, size, audience string, ttl time.Duration, now time.Time) (string, time.Time) {
+	if ttl == 0 {
+		ttl = l.TTL
+	}
+	if ttl == 0 {
+		ttl = defaultFileLinkTTL
+	}
+	exp := now.Add(ttl).Truncate(time.Second)
+	q := url.Values{
+		"size": {size},
+		"aud":  {audience},
+		"exp":  {strconv.FormatInt(exp.Unix(), 10)},
+		"sig":  {l.sign(filename, size, audience, exp.Unix())},
+	}
+	return "/files/" + url.PathEscape(filename) + "?" + q.Encode(), exp
+}
+
+// Verify checks a signed request for filename.
+func (l *FileLinks) Verify(filename string, q url.Values, now time.Time) error {
+	exp, err := strconv.ParseInt(q.Get("exp"), 10, 64)
+	if err != nil || now.Unix() >= exp {
+		return errInvalidFileLink
+	}
+	size := q.Get("size")
+	if size == "" {
+		size = "original"
+	}
+	if !hmac.Equal([]byte(q.Get("sig")), []byte(l.sign(filename, size, q.Get("aud"), exp))) {
+		return errInvalidFileLink
+	}
+	return nil
+}
+
+// Authenticate lets /files requests in by their signature when they carry
+// one, and by bearer token otherwise or when links are not configured.
+// Links for a user also need that user's token, which ServeFile checks
+// through signedFor. Bad signatures are audited.
+func (h *FileHandler) Authenticate(jwtAuth gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Query("sig") == "" || h.Links == nil {
+			jwtAuth(c)
+			return
+		}
+		if err := h.Links.Verify(c.Param("filename"), c.Request.URL.Query(), time.Now()); err != nil {
+			if h.Audit != nil {
+				h.Audit.CreateAudit(&model.AuditLog{
+					Action:    "file.read",
+					Resource:  "file:" + c.Param("filename") + " link:" + c.Query("aud"),
+					Success:   false,
+					Timestamp: time.Now().Unix(),
+				})
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set("signed_file", true)
+		c.Set("file_audience", c.Query("aud"))
+		if strings.HasPrefix(c.Query("aud"), "user:") {
+			jwtAuth(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// signedFor reports whether the request carries a valid signed link meant
+// for the caller.
+func signedFor(c *gin.Context) bool {
+	if !c.GetBool("signed_file") {
+		return false
+	}
+	id, ok := strings.CutPrefix(c.GetString("file_audience"), "user:")
+	return !ok || id == strconv.FormatUint(uint64(c.GetUint("user_id")), 10)
+}
+
+// POST /api/files/:filename/links
+// Body: {"size": "thumb", "audience": "email", "ttl_seconds": 600}; the
+// audience is required. The caller must be allowed to read the file. A
+// "user:<id>" audience needs that user's token as well.
+func (h *FileHandler) CreateLink(c *gin.Context) {
+	if h.Links == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "file links are not configured"})
+		return
+	}
+	var req struct {
+		Size       string `json:"size"`
+		Audience   string `json:"audience" binding:"required"`
+		TTLSeconds int    `json:"ttl_seconds"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	if req.Size == "" {
+		req.Size = "original"
+	}
+	if !validFileSize(req.Size) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "size must be thumb, medium or original"})
+		return
+	}
+	if !audienceRe.MatchString(req.Audience) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid audience"})
+		return
+	}
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+	if ttl < 0 || ttl > maxFileLinkTTL {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("ttl_seconds must be at most %d", int(maxFileLinkTTL.Seconds()))})
+		return
+	}
+	filename := c.Param("filename")
+	if allowed, _ := h.canAccess(c, filename); !allowed {
+		h.denied(c, filename)
+		return
+	}
+	path, exp := h.Links.URL(filename, req.Size, req.Audience, ttl, time.Now())
+	c.JSON(http.StatusOK, gin.H{"url": os.Getenv("BASE_URL") + path, "expires_at": exp})
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"context"
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"deliverymanagement/internal/storage"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignedFileLinks(t *testing.T) {
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	deliveries.CreateDelivery(&model.Delivery{ClientID: 1, Status: "CREATED"})
+	comments := repo.NewInMemoryCommentRepo()
+	blobs := storage.NewMemoryStore()
+	key, _, _ := storage.PutContent(context.Background(), blobs, []byte("0123456789abcdefghij"), ".pdf", "application/pdf")
+	blobs.Put(context.Background(), variantPath(key, "thumb"), []byte("thumb"), "application/pdf")
+	comments.CreateComment(&model.Comment{
+		DeliveryID:  1,
+		AuthorID:    1,
+		Visibility:  model.CommentClient,
+		Attachments: []model.CommentAttachment{{Path: key, Name: "Packing list.pdf"}},
+	})
+	links := &FileLinks{Secret: []byte("file-secret")}
+	h := &FileHandler{DamageReports: repo.NewInMemoryDamageReportRepo(), Blobs: blobs, Comments: comments, Deliveries: deliveries, Links: links}
+	r := gin.Default()
+	r.GET("/files/:filename", h.Authenticate(JWTAuthMiddleware(testSecret)), h.ServeFile)
+	r.POST("/api/files/:filename/links", JWTAuthMiddleware(testSecret), h.CreateLink)
+
+	do := func(method, path, token, body string, headers ...string) *httptest.ResponseRecorder {
+		return serveJSON(r, method, path, token, body, headers...)
+	}
+	mint := func(token, body string) (int, string) {
+		w := do("POST", "/api/files/"+key+"/links", token, body)
+		var res struct{ URL string }
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return w.Code, res.URL
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, do("GET", "/files/"+key, "", "").Code)
+	code, _ := mint(makeJWT(2), `{"audience": "email"}`)
+	assert.Equal(t, http.StatusForbidden, code)
+	code, _ = mint(makeJWT(1), `{"audience": "email", "ttl_seconds": 90000}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = mint(makeJWT(1), "")
+	assert.Equal(t, http.StatusBadRequest, code, "the audience is required")
+
+	// A link for a user needs that user's token
+	code, url := mint(makeJWT(1), `{"audience": "user:1"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, url, "aud=user%3A1")
+	assert.Equal(t, http.StatusUnauthorized, do("GET", url, "", "").Code)
+	assert.Equal(t, http.StatusForbidden, do("GET", url, makeJWT(2), "").Code)
+	assert.Equal(t, http.StatusOK, do("GET", url, makeJWT(1), "").Code)
+
+	// A link for another audience works without a token
+	code, url = mint(makeJWT(1), `{"audience": "email"}`)
+	assert.Equal(t, http.StatusOK, code)
+	w := do("GET", url, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0123456789abcdefghij", w.Body.String())
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.Equal(t, `inline; filename="Packing list.pdf"`, w.Header().Get("Content-Disposition"))
+	etag := w.Header().Get("ETag")
+	assert.Equal(t, `"`+key+`"`, etag)
+
+	// Conditional and partial requests
+	assert.Equal(t, http.StatusNotModified, do("GET", url, "", "", "If-None-Match", etag).Code)
+	w = do("GET", url, "", "", "Range", "bytes=5-9")
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "56789", w.Body.String())
+	assert.Equal(t, "bytes 5-9/20", w.Header().Get("Content-Range"))
+	w = do("GET", url+"&download=1", "", "")
+	assert.Equal(t, `attachment; filename="Packing list.pdf"`, w.Header().Get("Content-Disposition"))
+
+	// The signature covers the size and audience
+	code, url = mint(makeJWT(1), `{"size": "thumb", "audience": "email"}`)
+	assert.Equal(t, http.StatusOK, code)
+	w = do("GET", url, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "thumb", w.Body.String())
+	assert.Equal(t, `inline; filename="Packing list_thumb.pdf"`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, http.StatusUnauthorized, do("GET", strings.Replace(url, "size=thumb", "size=original", 1), "", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do("GET", strings.Replace(url, "aud=email", "aud=web", 1), "", "").Code)
+
+	expired, _ := links.URL(key, "original", "email", time.Minute, time.Now().Add(-time.Hour))
+	assert.Equal(t, http.StatusUnauthorized, do("GET", expired, "", "").Code)
+
+	// Bearer tokens still work
+	assert.Equal(t, http.StatusOK, do("GET", "/files/"+key, makeJWT(1), "").Code)
+
+	// Without links configured, signatures are ignored and none are minted
+	h.Links = nil
+	assert.Equal(t, http.StatusUnauthorized, do("GET", url, "", "").Code)
+	assert.Equal(t, http.StatusOK, do("GET", url, makeJWT(1), "").Code)
+	code, _ = mint(makeJWT(1), `{"audience": "email"}`)
+	assert.Equal(t, http.StatusNotImplemented, code)
+}
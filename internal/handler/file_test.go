@@ -2,8 +2,10 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"deliverymanagement/internal/model"
 	"deliverymanagement/internal/repo"
+	"deliverymanagement/internal/storage"
 	"encoding/json"
 	"mime/multipart"
 	"net/http"
@@ -16,7 +18,7 @@ import (
 
 func setupFileTestRouter() (*gin.Engine, *repo.InMemoryDamageReportRepo) {
 	repo := repo.NewInMemoryDamageReportRepo()
-	h := &FileHandler{DamageReports: repo}
+	h := &FileHandler{DamageReports: repo, Blobs: storage.NewMemoryStore()}
 	r := gin.Default()
 	r.GET("/files/:filename", func(c *gin.Context) {
 		// Simulate JWT middleware
@@ -29,26 +31,29 @@ func setupFileTestRouter() (*gin.Engine, *repo.InMemoryDamageReportRepo) {
 
 func TestFileAccess_RoleBased(t *testing.T) {
 	r, repo := gin.Default(), repo.NewInMemoryDamageReportRepo()
-	h := &FileHandler{DamageReports: repo}
+	blobs := storage.NewMemoryStore()
+	h := &FileHandler{DamageReports: repo, Blobs: blobs}
 	// Simulate a real upload to get the actual PhotoPath
-	dh := &DamageReportHandler{DamageReports: repo}
+	dh := &DamageReportHandler{DamageReports: repo, Blobs: blobs}
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 	_ = writer.WriteField("delivery_id", "42")
 	_ = writer.WriteField("type", "box damaged")
 	_ = writer.WriteField("description", "Corner crushed")
 	fw, _ := writer.CreateFormFile("photo", "photo.jpg")
-	fw.Write([]byte("imagedata"))
+	fw.Write(testJPEG())
 	writer.Close()
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request = reqWithMultipartBody("/api/damage-report", body, writer.FormDataContentType())
+	c.Set("user_id", uint(42))
+	c.Set("role", "courier")
 	dh.CreateDamageReport(c)
 	assert.Equal(t, http.StatusOK, w.Code)
 	var report model.DamageReport
 	json.Unmarshal(w.Body.Bytes(), &report)
 
-	// Allowed: user_id matches DeliveryID
+	// Allowed: the courier reported the damage
 	r.GET("/files/:filename", func(c *gin.Context) {
 		c.Set("user_id", uint(42))
 		c.Set("role", "courier")
@@ -59,7 +64,7 @@ func TestFileAccess_RoleBased(t *testing.T) {
 	r.ServeHTTP(rec, req2)
 	assert.Equal(t, http.StatusOK, rec.Code)
 
-	// Forbidden: user_id does not match
+	// Forbidden: another courier with no link to the delivery
 	r2 := gin.Default()
 	r2.GET("/files/:filename", func(c *gin.Context) {
 		c.Set("user_id", uint(99))
@@ -72,6 +77,71 @@ func TestFileAccess_RoleBased(t *testing.T) {
 	assert.Equal(t, http.StatusForbidden, rec2.Code)
 }
 
+func TestFileAccess_ThroughDelivery(t *testing.T) {
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	deliveries.CreateDelivery(&model.Delivery{ClientID: 1, CourierID: 5, Status: "IN_TRANSIT"})
+	reports := repo.NewInMemoryDamageReportRepo()
+	reports.CreateDamageReport(&model.DamageReport{DeliveryID: 1, ReporterID: 7, PhotoPath: "abc.jpg"})
+	blobs := storage.NewMemoryStore()
+	blobs.Put(context.Background(), "abc.jpg", testJPEG(), "image/jpeg")
+	audit := repo.NewInMemoryAuditLogRepo()
+	h := &FileHandler{DamageReports: reports, Blobs: blobs, Deliveries: deliveries, Audit: audit}
+	r := gin.Default()
+	r.GET("/files/:filename", JWTAuthMiddleware(testSecret), h.ServeFile)
+
+	get := func(token string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/files/abc.jpg", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, get(makeJWT(1)))
+	assert.Equal(t, http.StatusOK, get(makeCourierJWT(5)))
+	assert.Equal(t, http.StatusOK, get(makeWarehouseJWT(7)))
+	assert.Equal(t, http.StatusOK, get(makeDispatcherJWT(3)))
+	assert.Equal(t, http.StatusForbidden, get(makeJWT(2)))
+	assert.Equal(t, http.StatusForbidden, get(makeCourierJWT(6)))
+	assert.Equal(t, http.StatusForbidden, get(makeWarehouseJWT(8)))
+
+	logs, _ := audit.ListAuditLogs()
+	if assert.Len(t, logs, 3) {
+		assert.Equal(t, uint(2), logs[0].UserID)
+		assert.Equal(t, "file:abc.jpg", logs[0].Resource)
+		assert.False(t, logs[0].Success)
+	}
+}
+
+func TestFileAccess_SharedBlob(t *testing.T) {
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	deliveries.CreateDelivery(&model.Delivery{ClientID: 1, CourierID: 5})
+	deliveries.CreateDelivery(&model.Delivery{ClientID: 2, CourierID: 5})
+	deliveries.CreateDelivery(&model.Delivery{ClientID: 3, CourierID: 5})
+	reports := repo.NewInMemoryDamageReportRepo()
+	comments := repo.NewInMemoryCommentRepo()
+	// The same photo uploaded for two deliveries, and attached to a
+	// comment on a third, is stored once.
+	reports.CreateDamageReport(&model.DamageReport{DeliveryID: 1, PhotoPath: "same.jpg"})
+	reports.CreateDamageReport(&model.DamageReport{DeliveryID: 2, PhotoPath: "same.jpg"})
+	comments.CreateComment(&model.Comment{DeliveryID: 3, Visibility: model.CommentClient,
+		Attachments: []model.CommentAttachment{{Path: "same.jpg", Name: "box.jpg"}}})
+	blobs := storage.NewMemoryStore()
+	blobs.Put(context.Background(), "same.jpg", testJPEG(), "image/jpeg")
+	h := &FileHandler{DamageReports: reports, Comments: comments, Blobs: blobs, Deliveries: deliveries}
+	r := gin.Default()
+	r.GET("/files/:filename", JWTAuthMiddleware(testSecret), h.ServeFile)
+
+	get := func(token string) *httptest.ResponseRecorder {
+		return serveJSON(r, "GET", "/files/same.jpg", token, "")
+	}
+	assert.Equal(t, http.StatusOK, get(makeJWT(1)).Code)
+	assert.Equal(t, http.StatusOK, get(makeJWT(2)).Code)
+	w := get(makeJWT(3))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "box.jpg")
+	assert.Equal(t, http.StatusForbidden, get(makeJWT(4)).Code)
+}
+
 func reqWithMultipartBody(url string, body *bytes.Buffer, contentType string) *http.Request {
 	req, _ := http.NewRequest("POST", url, body)
 	req.Header.Set("Content-Type", contentType)
@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"deliverymanagement/internal/model"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultHandoverTTL      = 12 * time.Hour
+	defaultHandoverAttempts = 3
+)
+
+// POST /api/deliveries/:id/out-for-delivery (courier only)
+// Marks the parcel as on its way to the recipient. Deliveries in OTP mode get
+// a handover code, which is sent to the recipient; a new one is issued only
+// once the previous code has expired.
+func (h *DeliveryHandler) OutForDelivery(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	delivery := deliveryForUpdate(c, h.Deliveries, uint(id))
+	if delivery == nil {
+		return
+	}
+	courierID := c.GetUint("user_id")
+	if delivery.CourierID != 0 && delivery.CourierID != courierID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "delivery is assigned to another courier"})
+		return
+	}
+	switch delivery.Status {
+	case "DELIVERED", "RETURN_TO_SENDER", "AT_PICKUP_POINT":
+		c.JSON(http.StatusConflict, gin.H{"error": "delivery is " + delivery.Status})
+		return
+	}
+	if delivery.RequireOTP {
+		if h.HandoverCodes == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "handover codes are not configured"})
+			return
+		}
+		prev, _ := h.HandoverCodes.GetCode(delivery.ID)
+		if prev != nil && prev.UsedAt.IsZero() && prev.OverriddenBy == 0 && time.Now().Before(prev.ExpiresAt) {
+			c.JSON(http.StatusConflict, gin.H{"error": "a handover code was already sent to the recipient", "expires_at": prev.ExpiresAt})
+			return
+		}
+		if err := h.issueHandoverCode(delivery, prev); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	delivery.Status = "OUT_FOR_DELIVERY"
+	delivery.CourierID = courierID
+	if err := h.Deliveries.UpdateDelivery(delivery); err != nil {
+		updateFailed(c, err)
+		return
+	}
+	c.Header("ETag", deliveryETag(delivery))
+	recordTimeline(h.Timeline, delivery.ID, courierID, "out_for_delivery", "Out for delivery",
+		map[string]interface{}{"handover_code": delivery.RequireOTP})
+	c.JSON(http.StatusOK, delivery)
+}
+
+// issueHandoverCode replaces the previous code of the delivery, if any, and
+// emails the new one to the recipient. Wrong attempts against an unused
+// previous code carry over, so re-issuing does not reset the limit. The
+// client is told a code was sent, but never sees it.
+func (h *DeliveryHandler) issueHandoverCode(d *model.Delivery, prev *model.HandoverCode) error {
+	code, err := generatePIN()
+	if err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	ttl := h.HandoverTTL
+	if ttl == 0 {
+		ttl = defaultHandoverTTL
+	}
+	now := time.Now()
+	hc := &model.HandoverCode{DeliveryID: d.ID, CodeHash: string(hash), CreatedAt: now, ExpiresAt: now.Add(ttl)}
+	if prev != nil && prev.UsedAt.IsZero() {
+		hc.Attempts = prev.Attempts
+	}
+	if err := h.HandoverCodes.SaveCode(hc); err != nil {
+		return err
+	}
+	if d.RecipientEmail != "" && h.Publisher != nil {
+		h.Publisher.Publish("email.queue", map[string]interface{}{
+			"to":      d.RecipientEmail,
+			"subject": "Your delivery code",
+			"body": fmt.Sprintf("Your parcel %s is out for delivery. Give the courier this code on handover: %s (valid until %s).",
+				d.TrackingNumber, code, hc.ExpiresAt.Format("2006-01-02 15:04")),
+		})
+	}
+	if h.Notifications != nil {
+		h.Notifications.PublishNotification(&model.Notification{
+			UserID:    uint64(d.ClientID),
+			Type:      "delivery.handover_code",
+			Message:   fmt.Sprintf("Parcel %s is out for delivery; the recipient was sent a handover code.", d.TrackingNumber),
+			Data:      map[string]interface{}{"delivery_id": d.ID, "expires_at": hc.ExpiresAt},
+			CreatedAt: now,
+		})
+	}
+	return nil
+}
+
+// checkHandoverCode validates the code submitted with a delivery in OTP mode
+// and writes the error response when completion must be refused.
+func (h *DeliveryHandler) checkHandoverCode(c *gin.Context, d *model.Delivery, code string) bool {
+	var hc *model.HandoverCode
+	if h.HandoverCodes != nil {
+		hc, _ = h.HandoverCodes.GetCode(d.ID)
+	}
+	if hc == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "no handover code issued, mark the delivery out for delivery first"})
+		return false
+	}
+	if hc.OverriddenBy != 0 {
+		return true
+	}
+	maxAttempts := h.MaxHandoverAttempts
+	if maxAttempts == 0 {
+		maxAttempts = defaultHandoverAttempts
+	}
+	switch {
+	case hc.Attempts >= maxAttempts:
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many wrong handover codes, contact the dispatcher"})
+		return false
+	case time.Now().After(hc.ExpiresAt):
+		c.JSON(http.StatusConflict, gin.H{"error": "handover code expired"})
+		return false
+	case code == "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "handover_code is required"})
+		return false
+	}
+	// The attempt is counted before the code is compared, so a burst of
+	// guesses cannot all pass the limit check. A correct code ends the
+	// handover, so counting it does no harm.
+	attempts, err := h.HandoverCodes.RecordFailedAttempt(d.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if attempts > maxAttempts {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many wrong handover codes, contact the dispatcher"})
+		return false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hc.CodeHash), []byte(code)) != nil {
+		recordTimeline(h.Timeline, d.ID, c.GetUint("user_id"), "handover_code.rejected",
+			fmt.Sprintf("Wrong handover code (%d of %d)", attempts, maxAttempts), nil)
+		c.JSON(http.StatusForbidden, gin.H{"error": "wrong handover code", "attempts_left": maxAttempts - attempts})
+		return false
+	}
+	hc.Attempts = attempts
+	hc.UsedAt = time.Now()
+	h.HandoverCodes.SaveCode(hc)
+	return true
+}
+
+// POST /api/deliveries/:id/handover-override (dispatcher only)
+// Lets the courier complete an OTP delivery without the code, e.g. when the
+// recipient lost it. Every override is audited.
+func (h *DeliveryHandler) OverrideHandover(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	delivery, err := h.Deliveries.GetDelivery(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if !delivery.RequireOTP || delivery.Status == "DELIVERED" {
+		c.JSON(http.StatusConflict, gin.H{"error": "delivery does not await a handover code"})
+		return
+	}
+	userID := c.GetUint("user_id")
+	hc := &model.HandoverCode{DeliveryID: delivery.ID, CreatedAt: time.Now()}
+	if h.HandoverCodes != nil {
+		if existing, err := h.HandoverCodes.GetCode(delivery.ID); err == nil {
+			hc = existing
+		}
+	}
+	hc.OverriddenBy = userID
+	hc.OverrideReason = req.Reason
+	if h.HandoverCodes != nil {
+		h.HandoverCodes.SaveCode(hc)
+	}
+	if h.Audit != nil {
+		h.Audit.CreateAudit(&model.AuditLog{
+			UserID:    userID,
+			Action:    "handover.override",
+			Resource:  fmt.Sprintf("delivery:%d", delivery.ID),
+			Success:   true,
+			Timestamp: time.Now().Unix(),
+		})
+	}
+	recordTimeline(h.Timeline, delivery.ID, userID, "handover_code.overridden",
+		"Handover code overridden: "+req.Reason, map[string]interface{}{"reason": req.Reason})
+	c.JSON(http.StatusOK, hc)
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"deliverymanagement/pkg/rabbitmq"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandoverCodeFlow(t *testing.T) {
+	notifications := repo.NewInMemoryNotificationRepo()
+	codes := repo.NewInMemoryHandoverCodeRepo()
+	audit := repo.NewInMemoryAuditLogRepo()
+	pub := &rabbitmq.FakePublisher{}
+	h := &DeliveryHandler{
+		Publisher:     pub,
+		Deliveries:    repo.NewInMemoryDeliveryRepo(),
+		Timeline:      repo.NewInMemoryTimelineRepo(),
+		Notifications: &NotificationHandler{Notifications: notifications},
+		HandoverCodes: codes,
+		Audit:         audit,
+	}
+	r := gin.Default()
+	api := r.Group("/api", JWTAuthMiddleware(testSecret))
+	api.POST("/deliveries", h.CreateDelivery)
+	api.POST("/deliveries/:id/assign", DispatcherOnly(), h.AssignDelivery)
+	api.POST("/deliveries/:id/out-for-delivery", CourierOnly(), h.OutForDelivery)
+	api.POST("/deliveries/:id/deliver", CourierOnly(), h.CompleteDelivery)
+	api.POST("/deliveries/:id/handover-override", DispatcherOnly(), h.OverrideHandover)
+	do := func(path, token string, body interface{}) *httptest.ResponseRecorder {
+		return serveJSON(r, "POST", path, token, body)
+	}
+	create := func() model.Delivery {
+		var d model.Delivery
+		json.Unmarshal(do("/api/deliveries", makeJWT(1), map[string]interface{}{
+			"from_address": "A", "to_address": "B", "require_otp": true, "recipient_email": "r@example.com"}).Body.Bytes(), &d)
+		return d
+	}
+	// lastCode is the code in the latest email to the recipient.
+	lastCode := func() string {
+		body := pub.Messages[len(pub.Messages)-1].Body.(map[string]interface{})
+		assert.Equal(t, "r@example.com", body["to"])
+		return regexp.MustCompile(`code on handover: (\d{6})`).FindStringSubmatch(body["body"].(string))[1]
+	}
+
+	d := create()
+	deliverPath := fmt.Sprintf("/api/deliveries/%d/deliver", d.ID)
+	do(fmt.Sprintf("/api/deliveries/%d/assign", d.ID), makeDispatcherJWT(9), map[string]uint{"courier_id": 5})
+	assert.Equal(t, 409, do(deliverPath, makeCourierJWT(5), map[string]string{}).Code)
+
+	assert.Equal(t, 200, do(fmt.Sprintf("/api/deliveries/%d/out-for-delivery", d.ID), makeCourierJWT(5), nil).Code)
+	ns, _ := notifications.ListNotifications(1)
+	if assert.Len(t, ns, 1) {
+		assert.Nil(t, ns[0].Data["code"], "the client never sees the code")
+	}
+	code := lastCode()
+	assert.NotContains(t, ns[0].Message, code)
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	assert.Equal(t, 400, do(deliverPath, makeCourierJWT(5), map[string]string{}).Code)
+	w := do(deliverPath, makeCourierJWT(5), map[string]string{"handover_code": wrong})
+	assert.Equal(t, 403, w.Code)
+	assert.Contains(t, w.Body.String(), `"attempts_left":2`)
+	assert.Equal(t, 200, do(deliverPath, makeCourierJWT(5), map[string]string{"handover_code": code}).Code)
+
+	// Attempt limit, then a dispatcher override
+	d = create()
+	deliverPath = fmt.Sprintf("/api/deliveries/%d/deliver", d.ID)
+	do(fmt.Sprintf("/api/deliveries/%d/out-for-delivery", d.ID), makeCourierJWT(5), nil)
+	for i := 0; i < 3; i++ {
+		do(deliverPath, makeCourierJWT(5), map[string]string{"handover_code": "abc"})
+	}
+	assert.Equal(t, 429, do(deliverPath, makeCourierJWT(5), map[string]string{"handover_code": "abc"}).Code)
+	// Going out again neither re-issues a live code nor resets the attempts
+	outPath := fmt.Sprintf("/api/deliveries/%d/out-for-delivery", d.ID)
+	assert.Equal(t, 409, do(outPath, makeCourierJWT(5), nil).Code)
+	hc, _ := codes.GetCode(d.ID)
+	hc.ExpiresAt = time.Now().Add(-time.Minute)
+	codes.SaveCode(hc)
+	assert.Equal(t, 200, do(outPath, makeCourierJWT(5), nil).Code)
+	assert.Equal(t, 429, do(deliverPath, makeCourierJWT(5), map[string]string{"handover_code": lastCode()}).Code)
+	overridePath := fmt.Sprintf("/api/deliveries/%d/handover-override", d.ID)
+	assert.Equal(t, 403, do(overridePath, makeCourierJWT(5), map[string]string{"reason": "x"}).Code)
+	assert.Equal(t, 200, do(overridePath, makeDispatcherJWT(9), map[string]string{"reason": "recipient ID checked by phone"}).Code)
+	assert.Equal(t, 200, do(deliverPath, makeCourierJWT(5), map[string]string{}).Code)
+	logs, _ := audit.ListAuditLogs()
+	assert.Len(t, logs, 1)
+	assert.Equal(t, "handover.override", logs[0].Action)
+	assert.Equal(t, fmt.Sprintf("delivery:%d", d.ID), logs[0].Resource)
+
+	// Expired codes are refused
+	d = create()
+	do(fmt.Sprintf("/api/deliveries/%d/out-for-delivery", d.ID), makeCourierJWT(5), nil)
+	hc, _ = codes.GetCode(d.ID)
+	hc.ExpiresAt = time.Now().Add(-time.Minute)
+	codes.SaveCode(hc)
+	w = do(fmt.Sprintf("/api/deliveries/%d/deliver", d.ID), makeCourierJWT(5), map[string]string{"handover_code": "123456"})
+	assert.Equal(t, 409, w.Code)
+	assert.Contains(t, w.Body.String(), "expired")
+
+	// A burst of guesses gets no more than the allowed attempts
+	d = create()
+	deliverPath = fmt.Sprintf("/api/deliveries/%d/deliver", d.ID)
+	do(fmt.Sprintf("/api/deliveries/%d/out-for-delivery", d.ID), makeCourierJWT(5), nil)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	rejected := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if do(deliverPath, makeCourierJWT(5), map[string]string{"handover_code": "abc"}).Code == 403 {
+				mu.Lock()
+				rejected++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 3, rejected)
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HubHandler struct {
+	Hubs repo.HubRepository
+}
+
+var clockRe = regexp.MustCompile(`^([01]\d|2[0-3]):[0-5]\d$`)
+
+// parseWeekday accepts a day's full English name or its three-letter
+// abbreviation, in any case: "mon", "Monday".
+func parseWeekday(s string) (time.Weekday, bool) {
+	s = strings.ToLower(s)
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		name := strings.ToLower(wd.String())
+		if s == name || s == name[:3] {
+			return wd, true
+		}
+	}
+	return 0, false
+}
+
+// PUT /api/admin/hubs/:code
+// Creates or replaces a hub and its calendar. Working days are given as
+// "mon".."sun", holidays as YYYY-MM-DD.
+func (h *HubHandler) SaveHub(c *gin.Context) {
+	var req struct {
+		Name        string   `json:"name" binding:"required"`
+		Timezone    string   `json:"timezone"`
+		WorkingDays []string `json:"working_days"`
+		Cutoff      string   `json:"cutoff"`
+		Holidays    []string `json:"holidays"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	hub := &model.Hub{Code: c.Param("code"), Name: req.Name, Timezone: req.Timezone, Cutoff: req.Cutoff}
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid timezone"})
+			return
+		}
+	}
+	if req.Cutoff != "" && !clockRe.MatchString(req.Cutoff) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cutoff must be HH:MM"})
+		return
+	}
+	for _, d := range req.WorkingDays {
+		wd, ok := parseWeekday(d)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid working day " + d})
+			return
+		}
+		hub.WorkingDays = append(hub.WorkingDays, wd)
+	}
+	for _, d := range req.Holidays {
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid holiday " + d})
+			return
+		}
+		hub.Holidays = append(hub.Holidays, d)
+	}
+	if err := h.Hubs.SaveHub(hub); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, hub)
+}
+
+// GET /api/admin/hubs
+func (h *HubHandler) ListHubs(c *gin.Context) {
+	hubs, _ := h.Hubs.ListHubs()
+	c.JSON(http.StatusOK, hubs)
+}
+
+// GET /api/admin/hubs/:code
+func (h *HubHandler) GetHub(c *gin.Context) {
+	hub, err := h.Hubs.GetHub(c.Param("code"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, hub)
+}
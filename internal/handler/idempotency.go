@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// captureWriter keeps a copy of the response body for replays.
+type captureWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency makes retried create requests safe. The first response to an
+// Idempotency-Key is stored per user for ttl (24h by default) and replayed for
+// identical retries; reusing the key for a different request is rejected with
+// 422, and a retry arriving while the first request still runs gets 409.
+// Server errors and panics are not stored, so the request can be retried.
+// Requests without the header, or without an authenticated user to scope
+// the key to, are passed through.
+func Idempotency(store repo.IdempotencyStore, ttl time.Duration) gin.HandlerFunc {
+	if ttl == 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" || c.GetUint("user_id") == 0 {
+			c.Next()
+			return
+		}
+		if len(key) > 255 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+		fingerprint, err := requestFingerprint(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		storeKey := fmt.Sprintf("%d:%s:%s", c.GetUint("user_id"), c.FullPath(), key)
+		rec := &model.IdempotencyRecord{Fingerprint: fingerprint, CreatedAt: time.Now()}
+		existing, claimed, err := store.Begin(storeKey, rec, ttl)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "idempotency store unavailable"})
+			return
+		}
+		if !claimed {
+			switch {
+			case existing != nil && existing.Fingerprint != fingerprint:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+			case existing == nil || !existing.Done:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key is still in progress"})
+			default:
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(existing.Status, existing.ContentType, existing.Body)
+				c.Abort()
+			}
+			return
+		}
+
+		completed := false
+		defer func() {
+			if !completed {
+				store.Release(storeKey)
+			}
+		}()
+		w := &captureWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		if w.Status() >= 500 {
+			return
+		}
+		completed = true
+		rec.Done = true
+		rec.Status = w.Status()
+		rec.ContentType = w.Header().Get("Content-Type")
+		rec.Body = w.body.Bytes()
+		store.Complete(storeKey, rec, ttl)
+	}
+}
+
+// requestFingerprint hashes what the request asks for. Multipart bodies are
+// hashed by field and file content, because clients pick a new boundary on
+// every retry. The body stays readable for the handler.
+func requestFingerprint(c *gin.Context) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", c.Request.Method, c.Request.URL.Path)
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
+			return "", err
+		}
+		form := c.Request.MultipartForm
+		writeSorted(h, form.Value)
+		names := make([]string, 0, len(form.File))
+		for name := range form.File {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, fh := range form.File[name] {
+				f, err := fh.Open()
+				if err != nil {
+					return "", err
+				}
+				fmt.Fprintf(h, "file %s %s\n", name, fh.Filename)
+				_, err = io.Copy(h, f)
+				f.Close()
+				if err != nil {
+					return "", err
+				}
+			}
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return "", err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func writeSorted(h hash.Hash, values map[string][]string) {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(h, "field %s=%q\n", k, values[k])
+	}
+}
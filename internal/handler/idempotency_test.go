@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"bytes"
+	"deliverymanagement/internal/repo"
+	"deliverymanagement/pkg/rabbitmq"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyKeys(t *testing.T) {
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	pub := &rabbitmq.FakePublisher{}
+	h := &DeliveryHandler{Deliveries: deliveries, Publisher: pub}
+	r := gin.Default()
+	r.POST("/api/deliveries", JWTAuthMiddleware(testSecret), Idempotency(repo.NewInMemoryIdempotencyStore(), 0), h.CreateDelivery)
+	post := func(user uint, key, body string) *httptest.ResponseRecorder {
+		var headers []string
+		if key != "" {
+			headers = []string{"Idempotency-Key", key}
+		}
+		return serveJSON(r, "POST", "/api/deliveries", makeJWT(user), body, headers...)
+	}
+	body := `{"from_address": "A", "to_address": "B"}`
+
+	first := post(1, "k1", body)
+	assert.Equal(t, 200, first.Code)
+	retry := post(1, "k1", body)
+	assert.Equal(t, 200, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	list, _ := deliveries.ListDeliveries()
+	assert.Len(t, list, 1)
+	assert.Len(t, pub.Messages, 1)
+
+	assert.Equal(t, 422, post(1, "k1", `{"from_address": "A", "to_address": "C"}`).Code)
+	// Keys are per user, and requests without a key are not deduplicated
+	assert.Equal(t, 200, post(2, "k1", body).Code)
+	assert.Equal(t, 200, post(1, "", body).Code)
+	assert.Equal(t, 200, post(1, "", body).Code)
+	list, _ = deliveries.ListDeliveries()
+	assert.Len(t, list, 4)
+
+	// Error responses are replayed too, so a bad request stays bad
+	assert.Equal(t, 400, post(1, "k2", `{`).Code)
+	assert.Equal(t, "true", post(1, "k2", `{`).Header().Get("Idempotent-Replayed"))
+}
+
+func TestIdempotencyMultipartAndServerErrors(t *testing.T) {
+	calls := 0
+	r := gin.Default()
+	asUser := func(c *gin.Context) {
+		if c.Query("anonymous") == "" {
+			c.Set("user_id", uint(1))
+		}
+	}
+	r.POST("/upload", asUser, Idempotency(repo.NewInMemoryIdempotencyStore(), 0), func(c *gin.Context) {
+		calls++
+		switch {
+		case c.PostForm("fail") == "yes" && calls == 1:
+			c.JSON(500, gin.H{"error": "boom"})
+			return
+		case c.PostForm("fail") == "panic" && calls == 1:
+			panic("boom")
+		}
+		file, _, err := c.Request.FormFile("photo")
+		if err != nil {
+			c.JSON(400, gin.H{"error": "photo required"})
+			return
+		}
+		file.Close()
+		c.JSON(200, gin.H{"calls": calls, "type": c.PostForm("type")})
+	})
+	upload := func(key, fail string, content string, query ...string) *httptest.ResponseRecorder {
+		var b bytes.Buffer
+		mw := multipart.NewWriter(&b) // a new random boundary every time
+		mw.WriteField("type", "broken")
+		mw.WriteField("fail", fail)
+		fw, _ := mw.CreateFormFile("photo", "p.jpg")
+		fw.Write([]byte(content))
+		mw.Close()
+		w := httptest.NewRecorder()
+		path := "/upload"
+		if len(query) > 0 {
+			path += "?" + query[0]
+		}
+		req, _ := http.NewRequest("POST", path, &b)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set("Idempotency-Key", key)
+		r.ServeHTTP(w, req)
+		return w
+	}
+	w := upload("a", "no", "jpeg")
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"type":"broken"`)
+	assert.Equal(t, w.Body.String(), upload("a", "no", "jpeg").Body.String())
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 422, upload("a", "no", "other photo").Code)
+
+	// A server error is not stored, the retry runs the handler again
+	calls = 0
+	assert.Equal(t, 500, upload("b", "yes", "jpeg").Code)
+	assert.Equal(t, 200, upload("b", "yes", "jpeg").Code)
+	assert.Equal(t, 2, calls)
+
+	// Neither is a panic; the key is released instead of staying in progress
+	calls = 0
+	assert.Equal(t, 500, upload("c", "panic", "jpeg").Code)
+	assert.Equal(t, 200, upload("c", "panic", "jpeg").Code)
+	assert.Equal(t, 2, calls)
+
+	// Anonymous callers would share one key space, so their keys are ignored
+	calls = 0
+	upload("d", "no", "jpeg", "anonymous=1")
+	assert.Empty(t, upload("d", "no", "jpeg", "anonymous=1").Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,382 @@
+package handler
+
+import (
+	"crypto/rand"
+	"deliverymanagement/internal/geo"
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"deliverymanagement/pkg/rabbitmq"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type PickupPointHandler struct {
+	Points     repo.PickupPointRepository
+	Deliveries repo.DeliveryRepository
+	Geocoder   geo.Geocoder
+	Timeline   repo.TimelineRepository
+	// Returns sends parcels that were not collected in time back to the
+	// sender; optional.
+	Returns       *ReturnHandler
+	Publisher     rabbitmq.Publisher
+	Notifications *NotificationHandler
+	HoldDays      int // defaults to 7, a pickup point may override it
+	MaxPINTries   int // defaults to 5
+	Now           func() time.Time
+}
+
+func (h *PickupPointHandler) now() time.Time {
+	if h.Now != nil {
+		return h.Now()
+	}
+	return time.Now()
+}
+
+// POST /api/admin/pickup-points
+func (h *PickupPointHandler) CreatePickupPoint(c *gin.Context) {
+	var req struct {
+		Code         string       `json:"code" binding:"required"`
+		Name         string       `json:"name" binding:"required"`
+		Type         string       `json:"type" binding:"required,oneof=LOCKER COUNTER"`
+		Address      addressInput `json:"address"`
+		HoldDays     int          `json:"hold_days" binding:"gte=0"`
+		Compartments []struct {
+			Code     string  `json:"code" binding:"required"`
+			Size     string  `json:"size"`
+			LengthCm float64 `json:"length_cm" binding:"gt=0"`
+			WidthCm  float64 `json:"width_cm" binding:"gt=0"`
+			HeightCm float64 `json:"height_cm" binding:"gt=0"`
+		} `json:"compartments" binding:"dive"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	if req.Type == model.PickupPointLocker && len(req.Compartments) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a locker needs at least one compartment"})
+		return
+	}
+	addr, err := geo.Resolve(h.Geocoder, req.Address.toAddress(""))
+	if err != nil && !errors.Is(err, geo.ErrNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	point := &model.PickupPoint{
+		Code:      req.Code,
+		Name:      req.Name,
+		Type:      req.Type,
+		Address:   addr,
+		HoldDays:  req.HoldDays,
+		CreatedAt: time.Now(),
+	}
+	seen := map[string]bool{}
+	for _, cm := range req.Compartments {
+		if seen[cm.Code] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "duplicate compartment " + cm.Code})
+			return
+		}
+		seen[cm.Code] = true
+		point.Compartments = append(point.Compartments, model.Compartment{
+			Code: cm.Code, Size: cm.Size, LengthCm: cm.LengthCm, WidthCm: cm.WidthCm, HeightCm: cm.HeightCm,
+		})
+	}
+	if err := h.Points.CreatePickupPoint(point); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, point)
+}
+
+// pickupPointView hides compartment occupancy from API consumers.
+type pickupPointView struct {
+	ID                 uint
+	Code               string
+	Name               string
+	Type               string
+	Address            model.Address
+	Compartments       int
+	FreeCompartments   int
+	FreeCompartmentsBy map[string]int // by size label
+}
+
+func viewPickupPoint(p model.PickupPoint) pickupPointView {
+	v := pickupPointView{ID: p.ID, Code: p.Code, Name: p.Name, Type: p.Type, Address: p.Address,
+		Compartments: len(p.Compartments), FreeCompartmentsBy: map[string]int{}}
+	for _, cm := range p.Compartments {
+		if cm.DeliveryID == 0 {
+			v.FreeCompartments++
+			v.FreeCompartmentsBy[cm.Size]++
+		}
+	}
+	return v
+}
+
+// GET /api/pickup-points
+func (h *PickupPointHandler) ListPickupPoints(c *gin.Context) {
+	points, _ := h.Points.ListPickupPoints()
+	out := make([]pickupPointView, 0, len(points))
+	for _, p := range points {
+		out = append(out, viewPickupPoint(p))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// GET /api/pickup-points/:id
+func (h *PickupPointHandler) GetPickupPoint(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	p, err := h.Points.GetPickupPoint(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, viewPickupPoint(*p))
+}
+
+// POST /api/deliveries/:id/drop-off (courier only)
+// Stores the parcel at its pickup point: lockers get the smallest free
+// compartment that fits, and the recipient receives a one-time PIN.
+func (h *PickupPointHandler) DropOff(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	d := deliveryForUpdate(c, h.Deliveries, uint(id))
+	if d == nil {
+		return
+	}
+	courierID := c.GetUint("user_id")
+	if d.CourierID != 0 && d.CourierID != courierID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "delivery is assigned to another courier"})
+		return
+	}
+	if d.PickupPointID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "delivery is not addressed to a pickup point"})
+		return
+	}
+	if d.RecipientEmail == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "delivery has no recipient email to send the PIN to"})
+		return
+	}
+	switch d.Status {
+	case "DELIVERED", "RETURN_TO_SENDER", "AT_PICKUP_POINT":
+		c.JSON(http.StatusConflict, gin.H{"error": "delivery is " + d.Status})
+		return
+	}
+	point, err := h.Points.GetPickupPoint(d.PickupPointID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "pickup point not found"})
+		return
+	}
+	pin, err := generatePIN()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate PIN"})
+		return
+	}
+	hash, _ := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	var compartment string
+	if point.Type == model.PickupPointLocker {
+		compartment, err = h.Points.AllocateCompartment(point.ID, d.ID, d.LengthCm, d.WidthCm, d.HeightCm)
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	d.Status = "AT_PICKUP_POINT"
+	d.CourierID = courierID
+	if err := h.Deliveries.UpdateDelivery(d); err != nil {
+		if compartment != "" {
+			h.Points.ReleaseCompartment(point.ID, compartment)
+		}
+		updateFailed(c, err)
+		return
+	}
+	holdDays := point.HoldDays
+	if holdDays == 0 {
+		holdDays = h.HoldDays
+	}
+	if holdDays == 0 {
+		holdDays = 7
+	}
+	now := h.now()
+	parcel := &model.PickupParcel{
+		DeliveryID:    d.ID,
+		PickupPointID: point.ID,
+		Compartment:   compartment,
+		PINHash:       string(hash),
+		Status:        model.PickupParcelStored,
+		StoredAt:      now,
+		ExpiresAt:     now.AddDate(0, 0, holdDays),
+	}
+	if err := h.Points.CreateParcel(parcel); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("ETag", deliveryETag(d))
+	recordTimeline(h.Timeline, d.ID, courierID, "pickup.stored",
+		fmt.Sprintf("Stored at %s %s", point.Name, compartment),
+		map[string]interface{}{"pickup_point_id": point.ID, "compartment": compartment, "expires_at": parcel.ExpiresAt})
+	h.sendPIN(d, point, parcel, pin)
+	c.JSON(http.StatusOK, parcel)
+}
+
+// sendPIN emails the PIN to the recipient. The client who booked the
+// delivery is told in-app where the parcel is, but not the PIN: only the
+// recipient may open the compartment.
+func (h *PickupPointHandler) sendPIN(d *model.Delivery, point *model.PickupPoint, parcel *model.PickupParcel, pin string) {
+	where := fmt.Sprintf("Your parcel %s is waiting at %s (%s). Please collect it before %s.",
+		d.TrackingNumber, point.Name, point.Address.String(), parcel.ExpiresAt.Format("2006-01-02"))
+	if h.Publisher != nil {
+		h.Publisher.Publish("email.queue", map[string]interface{}{
+			"to":      d.RecipientEmail,
+			"subject": "Your parcel is ready for collection",
+			"body":    where + " Collection PIN: " + pin + ".",
+		})
+	}
+	if h.Notifications != nil {
+		h.Notifications.PublishNotification(&model.Notification{
+			UserID:  uint64(d.ClientID),
+			Type:    "pickup.ready",
+			Message: where,
+			Data: map[string]interface{}{
+				"delivery_id":     d.ID,
+				"pickup_point_id": point.ID,
+			},
+			CreatedAt: time.Now(),
+		})
+	}
+}
+
+// generatePIN returns a random six digit PIN.
+func generatePIN() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// POST /api/pickup-points/:id/collect
+// Called by the locker terminal or counter staff with the tracking number
+// and the recipient's PIN. Too many wrong PINs lock the parcel.
+func (h *PickupPointHandler) Collect(c *gin.Context) {
+	pointID, _ := strconv.Atoi(c.Param("id"))
+	var req struct {
+		TrackingNumber string `json:"tracking_number" binding:"required"`
+		PIN            string `json:"pin" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	deliveries, _ := h.Deliveries.ListDeliveries()
+	var d *model.Delivery
+	for i := range deliveries {
+		if deliveries[i].TrackingNumber == req.TrackingNumber {
+			d, _ = h.Deliveries.GetDelivery(deliveries[i].ID)
+			break
+		}
+	}
+	var parcel *model.PickupParcel
+	if d != nil {
+		parcel, _ = h.Points.FindStoredParcel(d.ID)
+	}
+	if parcel == nil || parcel.PickupPointID != uint(pointID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no parcel waiting for this tracking number"})
+		return
+	}
+	maxTries := h.MaxPINTries
+	if maxTries == 0 {
+		maxTries = 5
+	}
+	// The attempt is counted before the PIN is compared, so concurrent
+	// guesses cannot all slip under the limit. A correct PIN closes the
+	// parcel, so counting it does no harm.
+	tries, err := h.Points.RecordFailedPIN(parcel.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if tries > maxTries {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many wrong PINs, contact support"})
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(parcel.PINHash), []byte(req.PIN)) != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "wrong PIN"})
+		return
+	}
+	parcel.FailedPINAttempts = tries
+	// The parcel is taken out first so that it cannot expire into a return
+	// at the same time. If the delivery changed meanwhile it is put back and
+	// the recipient can try again.
+	now := h.now()
+	if err := h.Points.CollectParcel(parcel.ID, now); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	d.Status = "DELIVERED"
+	d.DeliveredAt = now
+	if err := h.Deliveries.UpdateDelivery(d); err != nil {
+		h.Points.UpdateParcel(parcel)
+		updateFailed(c, err)
+		return
+	}
+	if parcel.Compartment != "" {
+		h.Points.ReleaseCompartment(parcel.PickupPointID, parcel.Compartment)
+	}
+	recordTimeline(h.Timeline, d.ID, 0, "delivered", "Collected from pickup point",
+		map[string]interface{}{"pickup_point_id": parcel.PickupPointID, "compartment": parcel.Compartment})
+	if h.Publisher != nil {
+		h.Publisher.Publish("email.queue", map[string]interface{}{
+			"event":       "delivery.delivered",
+			"delivery_id": d.ID,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"delivery": d, "compartment": parcel.Compartment})
+}
+
+// ExpireUncollected frees the compartments of parcels past their hold
+// period and sends them back through the return flow. It returns the
+// number of expired parcels.
+func (h *PickupPointHandler) ExpireUncollected() int {
+	now := h.now()
+	parcels, _ := h.Points.ListParcels()
+	expired := 0
+	for _, p := range parcels {
+		if p.Status != model.PickupParcelStored || now.Before(p.ExpiresAt) {
+			continue
+		}
+		if h.Points.ExpireParcel(p.ID) != nil {
+			continue // collected meanwhile
+		}
+		if p.Compartment != "" {
+			h.Points.ReleaseCompartment(p.PickupPointID, p.Compartment)
+		}
+		expired++
+		d, err := h.Deliveries.GetDelivery(p.DeliveryID)
+		if err != nil {
+			continue
+		}
+		recordTimeline(h.Timeline, d.ID, 0, "pickup.expired", "Not collected before "+p.ExpiresAt.Format("2006-01-02"), nil)
+		if h.Returns != nil {
+			h.Returns.CreateReturnFor(d, model.ReturnReasonUncollected, "not collected from pickup point", 0)
+		}
+	}
+	return expired
+}
+
+// StartExpiry runs ExpireUncollected every interval until the process exits.
+func (h *PickupPointHandler) StartExpiry(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			h.ExpireUncollected()
+		}
+	}()
+}
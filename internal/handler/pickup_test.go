@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"deliverymanagement/pkg/rabbitmq"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompartmentFits(t *testing.T) {
+	c := model.Compartment{LengthCm: 40, WidthCm: 30, HeightCm: 10}
+	assert.True(t, c.Fits(10, 40, 30)) // rotated
+	assert.True(t, c.Fits(0, 0, 0))
+	assert.False(t, c.Fits(41, 10, 10))
+	assert.False(t, c.Fits(20, 20, 20))
+}
+
+func TestPickupPointDropOffAndCollect(t *testing.T) {
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	points := repo.NewInMemoryPickupPointRepo()
+	timeline := repo.NewInMemoryTimelineRepo()
+	pub := &rabbitmq.FakePublisher{}
+	notifications := repo.NewInMemoryNotificationRepo()
+	returns := &ReturnHandler{Deliveries: deliveries, Returns: repo.NewInMemoryReturnRepo(), Timeline: timeline}
+	dh := &DeliveryHandler{Deliveries: deliveries, Timeline: timeline, PickupPoints: points}
+	ph := &PickupPointHandler{Points: points, Deliveries: deliveries, Timeline: timeline, Returns: returns,
+		Publisher: pub, Notifications: &NotificationHandler{Notifications: notifications}, HoldDays: 3, Now: func() time.Time { return now }}
+	r := gin.Default()
+	r.POST("/api/pickup-points/:id/collect", ph.Collect)
+	api := r.Group("/api", JWTAuthMiddleware(testSecret))
+	api.POST("/admin/pickup-points", ph.CreatePickupPoint)
+	api.POST("/deliveries", dh.CreateDelivery)
+	api.POST("/deliveries/:id/drop-off", CourierOnly(), ph.DropOff)
+	do := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		return serveJSON(r, method, path, token, body)
+	}
+
+	w := do("POST", "/api/admin/pickup-points", makeDispatcherJWT(9), map[string]interface{}{
+		"code": "ALA-L1", "name": "Mega Locker", "type": "LOCKER",
+		"address": map[string]string{"street": "Rozybakiev", "building": "247", "city": "Almaty", "country": "KZ"},
+		"compartments": []map[string]interface{}{
+			{"code": "L1", "size": "L", "length_cm": 60, "width_cm": 40, "height_cm": 40},
+			{"code": "S1", "size": "S", "length_cm": 40, "width_cm": 30, "height_cm": 10},
+		},
+	})
+	assert.Equal(t, 200, w.Code)
+	var point model.PickupPoint
+	json.Unmarshal(w.Body.Bytes(), &point)
+
+	create := func(body map[string]interface{}) model.Delivery {
+		var d model.Delivery
+		w := do("POST", "/api/deliveries", makeJWT(1), body)
+		assert.Equal(t, 200, w.Code, w.Body.String())
+		json.Unmarshal(w.Body.Bytes(), &d)
+		return d
+	}
+	small := create(map[string]interface{}{"from_address": "Sender 1", "pickup_point_id": point.ID,
+		"recipient_email": "r@example.com", "length_cm": 20, "width_cm": 15, "height_cm": 5})
+	assert.Contains(t, small.ToAddress, "Rozybakiev")
+	big := create(map[string]interface{}{"from_address": "Sender 1", "pickup_point_id": point.ID,
+		"recipient_email": "big@example.com", "length_cm": 50, "width_cm": 30, "height_cm": 30})
+	other := create(map[string]interface{}{"from_address": "Sender 1", "pickup_point_id": point.ID,
+		"recipient_email": "other@example.com", "length_cm": 50, "width_cm": 30, "height_cm": 30})
+	assert.Equal(t, 400, do("POST", "/api/deliveries", makeJWT(1), map[string]interface{}{
+		"from_address": "Sender 1", "pickup_point_id": point.ID, "recipient_email": "r@example.com", "cod_amount": 100}).Code)
+	// Nobody could open the compartment without a recipient to send the PIN to
+	assert.Equal(t, 400, do("POST", "/api/deliveries", makeJWT(1), map[string]interface{}{
+		"from_address": "Sender 1", "pickup_point_id": point.ID}).Code)
+
+	// The small parcel takes the small compartment, leaving L1 for the big one
+	w = do("POST", fmt.Sprintf("/api/deliveries/%d/drop-off", small.ID), makeCourierJWT(5), nil)
+	assert.Equal(t, 200, w.Code)
+	var parcel model.PickupParcel
+	json.Unmarshal(w.Body.Bytes(), &parcel)
+	assert.Equal(t, "S1", parcel.Compartment)
+	assert.Equal(t, now.AddDate(0, 0, 3), parcel.ExpiresAt)
+	w = do("POST", fmt.Sprintf("/api/deliveries/%d/drop-off", big.ID), makeCourierJWT(5), nil)
+	json.Unmarshal(w.Body.Bytes(), &parcel)
+	assert.Equal(t, "L1", parcel.Compartment)
+	assert.Equal(t, 409, do("POST", fmt.Sprintf("/api/deliveries/%d/drop-off", other.ID), makeCourierJWT(5), nil).Code)
+
+	// PIN goes to the recipient by email, the client only learns where the parcel is
+	assert.Len(t, pub.Messages, 2)
+	msg := pub.Messages[0].Body.(map[string]interface{})
+	assert.Equal(t, "r@example.com", msg["to"])
+	pin := regexp.MustCompile(`PIN: (\d{6})`).FindStringSubmatch(msg["body"].(string))[1]
+	ns, _ := notifications.ListNotifications(1)
+	if assert.Len(t, ns, 2) {
+		assert.NotContains(t, ns[0].Message, pin)
+		assert.Nil(t, ns[0].Data["pin"])
+	}
+
+	collectPath := fmt.Sprintf("/api/pickup-points/%d/collect", point.ID)
+	wrong := "000000"
+	if pin == wrong {
+		wrong = "111111"
+	}
+	assert.Equal(t, 403, do("POST", collectPath, "", map[string]string{"tracking_number": small.TrackingNumber, "pin": wrong}).Code)
+	assert.Equal(t, 200, do("POST", collectPath, "", map[string]string{"tracking_number": small.TrackingNumber, "pin": pin}).Code)
+	got, _ := deliveries.GetDelivery(small.ID)
+	assert.Equal(t, "DELIVERED", got.Status)
+	assert.Equal(t, 404, do("POST", collectPath, "", map[string]string{"tracking_number": small.TrackingNumber, "pin": pin}).Code)
+
+	// S1 is free again, so the next parcel can be dropped off
+	p, _ := points.GetPickupPoint(point.ID)
+	assert.Equal(t, 1, viewPickupPoint(*p).FreeCompartments)
+
+	// A burst of wrong PINs gets no more than the allowed tries
+	var wg sync.WaitGroup
+	codes := make([]int, 8)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = do("POST", collectPath, "", map[string]string{"tracking_number": big.TrackingNumber, "pin": wrong}).Code
+		}(i)
+	}
+	wg.Wait()
+	forbidden := 0
+	for _, code := range codes {
+		if code == 403 {
+			forbidden++
+		}
+	}
+	assert.Equal(t, 5, forbidden)
+
+	// The big parcel is never collected and goes back to the sender
+	now = now.AddDate(0, 0, 3)
+	assert.Equal(t, 1, ph.ExpireUncollected())
+	got, _ = deliveries.GetDelivery(big.ID)
+	assert.Equal(t, "RETURN_TO_SENDER", got.Status)
+	ret, err := returns.Returns.FindReturnByOriginal(big.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, model.ReturnReasonUncollected, ret.Reason)
+	p, _ = points.GetPickupPoint(point.ID)
+	assert.Equal(t, 2, viewPickupPoint(*p).FreeCompartments)
+	assert.Equal(t, 0, ph.ExpireUncollected())
+}
@@ -0,0 +1,308 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"deliverymanagement/internal/geo"
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"deliverymanagement/internal/serviceability"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errInvalidRecipientToken = errors.New("invalid or expired link")
+
+// RecipientLinks signs the self-service links sent to recipients, who have
+// no account. A token is "<delivery id>.<expiry unix>.<hmac>".
+type RecipientLinks struct {
+	Secret []byte
+	TTL    time.Duration // defaults to 14 days
+}
+
+func (l *RecipientLinks) sign(payload string) string {
+	mac := hmac.New(sha256.New, l.Secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Token returns a signed token for the delivery.
+func (l *RecipientLinks) Token(deliveryID uint, now time.Time) string {
+	ttl := l.TTL
+	if ttl == 0 {
+		ttl = 14 * 24 * time.Hour
+	}
+	payload := fmt.Sprintf("%d.%d", deliveryID, now.Add(ttl).Unix())
+	return payload + "." + l.sign(payload)
+}
+
+// URL builds the link from BASE_URL, like the password reset link.
+func (l *RecipientLinks) URL(deliveryID uint) string {
+	return os.Getenv("BASE_URL") + "/api/recipient/" + l.Token(deliveryID, time.Now())
+}
+
+// Verify checks the signature and expiry and returns the delivery ID.
+func (l *RecipientLinks) Verify(token string, now time.Time) (uint, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, errInvalidRecipientToken
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(l.sign(parts[0]+"."+parts[1]))) {
+		return 0, errInvalidRecipientToken
+	}
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, errInvalidRecipientToken
+	}
+	exp, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || now.Unix() >= exp {
+		return 0, errInvalidRecipientToken
+	}
+	return uint(id), nil
+}
+
+type RecipientHandler struct {
+	Links          *RecipientLinks
+	Deliveries     repo.DeliveryRepository
+	Timeline       repo.TimelineRepository
+	Zones          repo.ZoneRepository
+	PickupPoints   repo.PickupPointRepository
+	Serviceability *serviceability.Checker // optional, skips the checks when nil
+	Geocoder       geo.Geocoder
+}
+
+// load resolves the token to a delivery the recipient may still change and
+// writes the error response otherwise.
+func (h *RecipientHandler) load(c *gin.Context, forChange bool) *model.Delivery {
+	id, err := h.Links.Verify(c.Param("token"), time.Now())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return nil
+	}
+	d, err := h.Deliveries.GetDelivery(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return nil
+	}
+	if forChange {
+		switch d.Status {
+		case "OUT_FOR_DELIVERY", "DELIVERED", "AT_PICKUP_POINT", "RETURN_TO_SENDER":
+			c.JSON(http.StatusConflict, gin.H{"error": "the delivery can no longer be changed"})
+			return nil
+		}
+	}
+	return d
+}
+
+// GET /api/recipient/:token
+// Shows the recipient what they may change, without internal details.
+func (h *RecipientHandler) GetDelivery(c *gin.Context) {
+	d := h.load(c, false)
+	if d == nil {
+		return
+	}
+	resp := gin.H{
+		"tracking_number":   d.TrackingNumber,
+		"status":            d.Status,
+		"to":                d.ToAddress,
+		"pickup_point_id":   d.PickupPointID,
+		"safe_place":        d.SafePlace,
+		"neighbour_name":    d.NeighbourName,
+		"neighbour_address": d.NeighbourAddress,
+	}
+	if !d.PromisedDate.IsZero() {
+		resp["promised_date"] = d.PromisedDate.Format("2006-01-02")
+	}
+	if !d.WindowStart.IsZero() {
+		resp["window_start"] = d.WindowStart
+		resp["window_end"] = d.WindowEnd
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// POST /api/recipient/:token/window
+// Body: {"date": "YYYY-MM-DD", "from": "HH:MM", "to": "HH:MM"}. The date must
+// be a working day of the destination hub no earlier than we can deliver.
+func (h *RecipientHandler) Reschedule(c *gin.Context) {
+	d := h.load(c, true)
+	if d == nil {
+		return
+	}
+	var req struct {
+		Date string `json:"date" binding:"required"`
+		From string `json:"from" binding:"required"`
+		To   string `json:"to" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	day, err := time.Parse("2006-01-02", req.Date)
+	from, fromErr := time.Parse("15:04", req.From)
+	to, toErr := time.Parse("15:04", req.To)
+	if err != nil || fromErr != nil || toErr != nil || !to.After(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date or window"})
+		return
+	}
+	if d.PickupPointID != 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "pickup point deliveries have no delivery window"})
+		return
+	}
+	earliest := d.PromisedDate
+	if h.Serviceability != nil {
+		res := h.Serviceability.Check(d.Origin, d.Destination)
+		if !res.Serviceable {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "not serviceable", "reason": res.Reason})
+			return
+		}
+		if opt, ok := res.Option(d.ServiceLevel); ok {
+			earliest, _ = time.Parse("2006-01-02", opt.EarliestDelivery)
+		}
+		if hub := h.destinationHub(d); hub != "" && !h.Serviceability.IsOpen(hub, day) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "no deliveries on " + req.Date})
+			return
+		}
+	}
+	if day.Before(earliest) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "earliest possible date is " + earliest.Format("2006-01-02")})
+		return
+	}
+	d.WindowStart = day.Add(time.Duration(from.Hour())*time.Hour + time.Duration(from.Minute())*time.Minute)
+	d.WindowEnd = day.Add(time.Duration(to.Hour())*time.Hour + time.Duration(to.Minute())*time.Minute)
+	if err := h.Deliveries.UpdateDelivery(d); err != nil {
+		updateFailed(c, err)
+		return
+	}
+	recordTimeline(h.Timeline, d.ID, 0, "recipient.rescheduled",
+		fmt.Sprintf("Recipient asked for delivery on %s between %s and %s", req.Date, req.From, req.To),
+		map[string]interface{}{"window_start": d.WindowStart, "window_end": d.WindowEnd})
+	c.JSON(http.StatusOK, gin.H{"window_start": d.WindowStart, "window_end": d.WindowEnd})
+}
+
+// destinationHub returns the hub of the zone the delivery is zoned into.
+func (h *RecipientHandler) destinationHub(d *model.Delivery) string {
+	if h.Zones == nil || d.ZoneID == 0 {
+		return ""
+	}
+	z, err := h.Zones.GetZone(d.ZoneID)
+	if err != nil {
+		return ""
+	}
+	return z.Hub
+}
+
+// POST /api/recipient/:token/pickup-point
+// Redirects the parcel to a pickup point served from the same origin.
+func (h *RecipientHandler) RedirectToPickupPoint(c *gin.Context) {
+	d := h.load(c, true)
+	if d == nil {
+		return
+	}
+	var req struct {
+		PickupPointID uint `json:"pickup_point_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	if d.CODAmount > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "cash on delivery is not available at pickup points"})
+		return
+	}
+	if d.RecipientEmail == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "pickup points need a recipient email for the collection PIN"})
+		return
+	}
+	var point *model.PickupPoint
+	if h.PickupPoints != nil {
+		point, _ = h.PickupPoints.GetPickupPoint(req.PickupPointID)
+	}
+	if point == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown pickup point"})
+		return
+	}
+	if point.Type == model.PickupPointLocker {
+		fits := false
+		for _, cm := range point.Compartments {
+			fits = fits || cm.Fits(d.LengthCm, d.WidthCm, d.HeightCm)
+		}
+		if !fits {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "the parcel does not fit in this locker"})
+			return
+		}
+	}
+	if h.Serviceability != nil {
+		if res := h.Serviceability.Check(d.Origin, point.Address); !res.Serviceable {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "not serviceable", "reason": res.Reason})
+			return
+		}
+	}
+	previous := d.ToAddress
+	d.PickupPointID = point.ID
+	d.Destination = point.Address
+	d.ToAddress = point.Address.String()
+	d.ZoneID = zoneFor(h.Zones, d.Destination)
+	d.WindowStart, d.WindowEnd = time.Time{}, time.Time{}
+	if err := h.Deliveries.UpdateDelivery(d); err != nil {
+		updateFailed(c, err)
+		return
+	}
+	recordTimeline(h.Timeline, d.ID, 0, "recipient.redirected", "Recipient redirected the parcel to "+point.Name,
+		map[string]interface{}{"pickup_point_id": point.ID, "previous_address": previous})
+	c.JSON(http.StatusOK, gin.H{"pickup_point_id": point.ID, "to": d.ToAddress})
+}
+
+// POST /api/recipient/:token/instructions
+// Safe-place instructions and/or a neighbour who may accept the parcel.
+// A neighbour at another address must be within our service area.
+func (h *RecipientHandler) SetInstructions(c *gin.Context) {
+	d := h.load(c, true)
+	if d == nil {
+		return
+	}
+	var req struct {
+		SafePlace        string `json:"safe_place" binding:"max=200"`
+		NeighbourName    string `json:"neighbour_name" binding:"max=100"`
+		NeighbourAddress string `json:"neighbour_address" binding:"max=200"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	if req.NeighbourAddress != "" && req.NeighbourName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "neighbour_name is required with neighbour_address"})
+		return
+	}
+	if req.NeighbourAddress != "" {
+		addr, err := geo.Resolve(h.Geocoder, geo.ParseAddress(req.NeighbourAddress))
+		if err != nil && !errors.Is(err, geo.ErrNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if h.Serviceability != nil {
+			if res := h.Serviceability.Check(d.Origin, addr); !res.Serviceable {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "neighbour address not serviceable", "reason": res.Reason})
+				return
+			}
+		}
+		req.NeighbourAddress = addr.String()
+	}
+	d.SafePlace = req.SafePlace
+	d.NeighbourName = req.NeighbourName
+	d.NeighbourAddress = req.NeighbourAddress
+	if err := h.Deliveries.UpdateDelivery(d); err != nil {
+		updateFailed(c, err)
+		return
+	}
+	recordTimeline(h.Timeline, d.ID, 0, "recipient.instructions", "Recipient updated delivery instructions",
+		map[string]interface{}{"safe_place": d.SafePlace, "neighbour_name": d.NeighbourName, "neighbour_address": d.NeighbourAddress})
+	c.JSON(http.StatusOK, gin.H{"safe_place": d.SafePlace, "neighbour_name": d.NeighbourName, "neighbour_address": d.NeighbourAddress})
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"deliverymanagement/internal/geo"
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"deliverymanagement/internal/serviceability"
+	"deliverymanagement/pkg/rabbitmq"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecipientLinkToken(t *testing.T) {
+	links := &RecipientLinks{Secret: []byte("k"), TTL: time.Hour}
+	now := time.Now()
+	token := links.Token(42, now)
+	id, err := links.Verify(token, now)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(42), id)
+
+	_, err = links.Verify(token, now.Add(2*time.Hour))
+	assert.Error(t, err)
+	_, err = links.Verify("43"+token[2:], now)
+	assert.Error(t, err)
+	_, err = (&RecipientLinks{Secret: []byte("other")}).Verify(token, now)
+	assert.Error(t, err)
+}
+
+func TestRecipientSelfService(t *testing.T) {
+	t.Setenv("BASE_URL", "https://dm.example.com")
+	gz, _ := geo.LoadGazetteer(strings.NewReader("KZ,050000,Almaty,43.2389,76.8897\nKZ,010000,Astana,51.1282,71.4307\n"))
+	zones := repo.NewInMemoryZoneRepo()
+	polys, _ := geo.ParseGeoJSON([]byte(`{"type":"Polygon","coordinates":[[[76.8,43.2],[77.0,43.2],[77.0,43.3],[76.8,43.3],[76.8,43.2]]]}`))
+	zones.CreateZone(&model.Zone{Name: "Almaty", Hub: "ALA", Polygons: polys})
+	checker := &serviceability.Checker{Zones: zones, Now: func() time.Time { return time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC) }}
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	timeline := repo.NewInMemoryTimelineRepo()
+	points := repo.NewInMemoryPickupPointRepo()
+	almatyLocker, _ := geo.Resolve(gz, geo.ParseAddress("Rozybakiev 247, Almaty, KZ"))
+	astanaLocker, _ := geo.Resolve(gz, geo.ParseAddress("Kenesary 2, Astana, KZ"))
+	points.CreatePickupPoint(&model.PickupPoint{Code: "ALA-1", Name: "Mega", Type: model.PickupPointCounter, Address: almatyLocker})
+	points.CreatePickupPoint(&model.PickupPoint{Code: "AST-1", Name: "Khan Shatyr", Type: model.PickupPointCounter, Address: astanaLocker})
+	links := &RecipientLinks{Secret: []byte("test")}
+	pub := &rabbitmq.FakePublisher{}
+	dh := &DeliveryHandler{Deliveries: deliveries, Geocoder: gz, Zones: zones, Serviceability: checker,
+		Timeline: timeline, Publisher: pub, RecipientLinks: links}
+	rh := &RecipientHandler{Links: links, Deliveries: deliveries, Timeline: timeline, Zones: zones,
+		PickupPoints: points, Serviceability: checker, Geocoder: gz}
+	r := gin.Default()
+	r.POST("/api/deliveries", JWTAuthMiddleware(testSecret), dh.CreateDelivery)
+	r.GET("/api/recipient/:token", rh.GetDelivery)
+	r.POST("/api/recipient/:token/window", rh.Reschedule)
+	r.POST("/api/recipient/:token/pickup-point", rh.RedirectToPickupPoint)
+	r.POST("/api/recipient/:token/instructions", rh.SetInstructions)
+	do := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		return serveJSON(r, method, path, makeJWT(1), body)
+	}
+
+	w := do("POST", "/api/deliveries", map[string]string{
+		"from_address": "Abay 1, Almaty, KZ", "to_address": "Tole Bi 5, Almaty, KZ", "recipient_email": "r@example.com"})
+	assert.Equal(t, 200, w.Code)
+	var d model.Delivery
+	json.Unmarshal(w.Body.Bytes(), &d)
+
+	// The recipient gets the link by email
+	msg := pub.Messages[0].Body.(map[string]interface{})
+	assert.Equal(t, "r@example.com", msg["to"])
+	link := msg["body"].(string)[strings.Index(msg["body"].(string), "https://"):]
+	path := strings.TrimPrefix(link, "https://dm.example.com")
+	assert.True(t, strings.HasPrefix(path, "/api/recipient/"))
+	assert.Equal(t, link, pub.Messages[1].Body.(map[string]interface{})["manage_url"])
+
+	assert.Equal(t, 200, do("GET", path, nil).Code)
+	assert.Equal(t, 401, do("GET", path+"0", nil).Code)
+
+	// STANDARD from Wednesday arrives Friday at the earliest
+	assert.Equal(t, 422, do("POST", path+"/window", map[string]string{"date": "2026-10-15", "from": "09:00", "to": "12:00"}).Code)
+	assert.Equal(t, 422, do("POST", path+"/window", map[string]string{"date": "2026-10-17", "from": "09:00", "to": "12:00"}).Code)
+	assert.Equal(t, 400, do("POST", path+"/window", map[string]string{"date": "2026-10-19", "from": "12:00", "to": "09:00"}).Code)
+	assert.Equal(t, 200, do("POST", path+"/window", map[string]string{"date": "2026-10-19", "from": "09:00", "to": "12:00"}).Code)
+	got, _ := deliveries.GetDelivery(d.ID)
+	assert.Equal(t, time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC), got.WindowStart)
+
+	// Neighbours and pickup points must be within the service area
+	assert.Equal(t, 422, do("POST", path+"/instructions", map[string]string{"neighbour_name": "Aigerim", "neighbour_address": "Kenesary 2, Astana, KZ"}).Code)
+	assert.Equal(t, 200, do("POST", path+"/instructions", map[string]string{"safe_place": "Behind the gate", "neighbour_name": "Aigerim", "neighbour_address": "Tole Bi 7, Almaty, KZ"}).Code)
+	assert.Equal(t, 422, do("POST", path+"/pickup-point", map[string]uint{"pickup_point_id": 2}).Code)
+	assert.Equal(t, 200, do("POST", path+"/pickup-point", map[string]uint{"pickup_point_id": 1}).Code)
+	got, _ = deliveries.GetDelivery(d.ID)
+	assert.Equal(t, uint(1), got.PickupPointID)
+	assert.Equal(t, "Behind the gate", got.SafePlace)
+	assert.True(t, got.WindowStart.IsZero())
+
+	events, _ := timeline.ListEvents(d.ID)
+	types := []string{}
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	assert.Equal(t, []string{"created", "recipient.rescheduled", "recipient.instructions", "recipient.redirected"}, types)
+
+	// No more changes once the parcel is on its way
+	got.Status = "OUT_FOR_DELIVERY"
+	deliveries.UpdateDelivery(got)
+	assert.Equal(t, 409, do("POST", path+"/instructions", map[string]string{"safe_place": "Porch"}).Code)
+}
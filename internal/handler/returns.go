@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"deliverymanagement/pkg/rabbitmq"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+type ReturnHandler struct {
+	Deliveries repo.DeliveryRepository
+	Returns    repo.ReturnRepository
+	Zones      repo.ZoneRepository
+	Timeline   repo.TimelineRepository
+	Publisher  rabbitmq.Publisher
+}
+
+var manualReturnReasons = map[string]bool{
+	model.ReturnReasonDamaged:   true,
+	model.ReturnReasonWrongItem: true,
+	model.ReturnReasonRefused:   true,
+}
+
+// POST /api/deliveries/:id/return
+// Clients may return their own deliveries; couriers and dispatchers any.
+func (h *ReturnHandler) RequestReturn(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+		Notes  string `json:"notes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	if !manualReturnReasons[req.Reason] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason must be DAMAGED, WRONG_ITEM or REFUSED"})
+		return
+	}
+	original := deliveryForUpdate(c, h.Deliveries, uint(id))
+	if original == nil {
+		return
+	}
+	userID := c.GetUint("user_id")
+	if role, _ := c.Get("role"); role == "client" && original.ClientID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return
+	}
+	ret, reverse, err := h.CreateReturnFor(original, req.Reason, req.Notes, userID)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"return": ret, "return_delivery": reverse})
+}
+
+// CreateReturnFor books the reverse delivery for original and links both
+// through a return request. requestedBy 0 marks a system-initiated return.
+func (h *ReturnHandler) CreateReturnFor(original *model.Delivery, reason, notes string, requestedBy uint) (*model.ReturnRequest, *model.Delivery, error) {
+	if original.ReturnOf != 0 {
+		return nil, nil, errors.New("cannot return a return delivery")
+	}
+	if original.Status == "CREATED" {
+		return nil, nil, errors.New("delivery has not been dispatched yet")
+	}
+	if _, err := h.Returns.FindReturnByOriginal(original.ID); err == nil {
+		return nil, nil, errors.New("return already exists for delivery")
+	}
+	// Stop the original first so a concurrent change fails the whole return.
+	if original.Status != "DELIVERED" {
+		original.Status = "RETURN_TO_SENDER"
+		if err := h.Deliveries.UpdateDelivery(original); err != nil {
+			return nil, nil, err
+		}
+	}
+	now := time.Now()
+	reverse := &model.Delivery{
+		ClientID:     original.ClientID,
+		FromAddress:  original.ToAddress,
+		ToAddress:    original.FromAddress,
+		Origin:       original.Destination,
+		Destination:  original.Origin,
+		Status:       "CREATED",
+		CreatedAt:    now,
+		ServiceLevel: "STANDARD",
+		ReturnOf:     original.ID,
+	}
+	reverse.ZoneID = zoneFor(h.Zones, reverse.Destination)
+	if err := h.Deliveries.CreateDelivery(reverse); err != nil {
+		return nil, nil, err
+	}
+	reverse.TrackingNumber = trackingNumber("RT", reverse.ID)
+	if err := h.Deliveries.UpdateDelivery(reverse); err != nil {
+		return nil, nil, err
+	}
+
+	ret := &model.ReturnRequest{
+		OriginalDeliveryID: original.ID,
+		ReturnDeliveryID:   reverse.ID,
+		ClientID:           original.ClientID,
+		Reason:             reason,
+		Notes:              notes,
+		Automatic:          requestedBy == 0,
+		RequestedBy:        requestedBy,
+		CreatedAt:          now,
+	}
+	if err := h.Returns.CreateReturn(ret); err != nil {
+		return nil, nil, err
+	}
+	data := map[string]interface{}{"return_id": ret.ID, "reason": reason, "return_delivery_id": reverse.ID}
+	recordTimeline(h.Timeline, original.ID, requestedBy, "return.created",
+		fmt.Sprintf("Return %s requested (%s)", reverse.TrackingNumber, reason), data)
+	recordTimeline(h.Timeline, reverse.ID, requestedBy, "created",
+		fmt.Sprintf("Reverse delivery for %s", original.TrackingNumber), data)
+	if h.Publisher != nil {
+		h.Publisher.Publish("email.queue", map[string]interface{}{
+			"event":              "return.created",
+			"delivery_id":        original.ID,
+			"return_delivery_id": reverse.ID,
+			"tracking_number":    reverse.TrackingNumber,
+			"reason":             reason,
+		})
+	}
+	return ret, reverse, nil
+}
+
+// ReturnView is a return request joined with the state of both deliveries.
+type ReturnView struct {
+	model.ReturnRequest
+	OriginalTracking string `json:"original_tracking"`
+	ReturnTracking   string `json:"return_tracking"`
+	Status           string `json:"status"` // status of the reverse delivery
+}
+
+// listReturns applies ?reason=, ?status=, ?from=/?to= (YYYY-MM-DD) and
+// restricts clients to their own returns.
+func (h *ReturnHandler) listReturns(c *gin.Context) []ReturnView {
+	returns, _ := h.Returns.ListReturns()
+	role, _ := c.Get("role")
+	userID := c.GetUint("user_id")
+	from, _ := time.Parse("2006-01-02", c.Query("from"))
+	to, toErr := time.Parse("2006-01-02", c.Query("to"))
+	out := []ReturnView{}
+	for _, r := range returns {
+		if role == "client" && r.ClientID != userID {
+			continue
+		}
+		if v := c.Query("reason"); v != "" && r.Reason != v {
+			continue
+		}
+		if r.CreatedAt.Before(from) || (toErr == nil && !r.CreatedAt.Before(to.AddDate(0, 0, 1))) {
+			continue
+		}
+		view := ReturnView{ReturnRequest: r}
+		if d, err := h.Deliveries.GetDelivery(r.OriginalDeliveryID); err == nil {
+			view.OriginalTracking = d.TrackingNumber
+		}
+		if d, err := h.Deliveries.GetDelivery(r.ReturnDeliveryID); err == nil {
+			view.ReturnTracking = d.TrackingNumber
+			view.Status = d.Status
+		}
+		if v := c.Query("status"); v != "" && view.Status != v {
+			continue
+		}
+		out = append(out, view)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// GET /api/returns
+// Returns dashboard: matching returns plus counts by reason and status.
+func (h *ReturnHandler) ListReturns(c *gin.Context) {
+	views := h.listReturns(c)
+	byReason := map[string]int{}
+	byStatus := map[string]int{}
+	for _, v := range views {
+		byReason[v.Reason]++
+		byStatus[v.Status]++
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"total":     len(views),
+		"by_reason": byReason,
+		"by_status": byStatus,
+		"returns":   views,
+	})
+}
+
+// GET /api/returns/export?format=csv|xlsx
+func (h *ReturnHandler) ExportReturns(c *gin.Context) {
+	views := h.listReturns(c)
+	header := []string{"ReturnID", "OriginalTracking", "ReturnTracking", "Reason", "Status", "Automatic", "CreatedAt"}
+	row := func(v ReturnView) []string {
+		return []string{
+			strconv.Itoa(int(v.ID)), v.OriginalTracking, v.ReturnTracking, v.Reason, v.Status,
+			strconv.FormatBool(v.Automatic), v.CreatedAt.Format(time.RFC3339),
+		}
+	}
+	switch c.DefaultQuery("format", "csv") {
+	case "csv":
+		c.Header("Content-Disposition", "attachment; filename=returns.csv")
+		c.Header("Content-Type", "text/csv")
+		w := csv.NewWriter(c.Writer)
+		w.Write(header)
+		for _, v := range views {
+			w.Write(row(v))
+		}
+		w.Flush()
+	case "xlsx":
+		f := excelize.NewFile()
+		f.SetSheetRow("Sheet1", "A1", &header)
+		for i, v := range views {
+			r := row(v)
+			f.SetSheetRow("Sheet1", fmt.Sprintf("A%d", i+2), &r)
+		}
+		c.Header("Content-Disposition", "attachment; filename=returns.xlsx")
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		f.Write(c.Writer)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid format"})
+	}
+}
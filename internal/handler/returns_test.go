@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackingNumberCheckDigit(t *testing.T) {
+	// Worked example from the UPU S10 standard
+	assert.Equal(t, "RR473124829KZ", trackingNumber("RR", 47312482))
+}
+
+func TestReturnsFlow(t *testing.T) {
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	timeline := repo.NewInMemoryTimelineRepo()
+	rh := &ReturnHandler{Deliveries: deliveries, Returns: repo.NewInMemoryReturnRepo(), Timeline: timeline}
+	dh := &DeliveryHandler{Deliveries: deliveries, Timeline: timeline, Returns: rh}
+	r := gin.Default()
+	api := r.Group("/api", JWTAuthMiddleware(testSecret))
+	api.POST("/deliveries", dh.CreateDelivery)
+	api.POST("/deliveries/:id/assign", DispatcherOnly(), dh.AssignDelivery)
+	api.POST("/deliveries/:id/deliver", CourierOnly(), dh.CompleteDelivery)
+	api.POST("/deliveries/:id/attempt-failed", CourierOnly(), dh.FailAttempt)
+	api.POST("/deliveries/:id/return", rh.RequestReturn)
+	api.GET("/deliveries/:id/timeline", dh.GetTimeline)
+	api.GET("/returns", rh.ListReturns)
+	api.GET("/returns/export", rh.ExportReturns)
+	do := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		return serveJSON(r, method, path, token, body)
+	}
+	var d1, d2 model.Delivery
+	json.Unmarshal(do("POST", "/api/deliveries", makeJWT(1), map[string]string{"from_address": "Sender 1", "to_address": "Recipient 2"}).Body.Bytes(), &d1)
+	json.Unmarshal(do("POST", "/api/deliveries", makeJWT(1), map[string]string{"from_address": "Sender 1", "to_address": "Recipient 3"}).Body.Bytes(), &d2)
+	assert.True(t, strings.HasPrefix(d1.TrackingNumber, "DM"))
+
+	// Not dispatched yet
+	returnPath := fmt.Sprintf("/api/deliveries/%d/return", d1.ID)
+	assert.Equal(t, 409, do("POST", returnPath, makeJWT(1), map[string]string{"reason": "DAMAGED"}).Code)
+
+	do("POST", fmt.Sprintf("/api/deliveries/%d/assign", d1.ID), makeDispatcherJWT(9), map[string]uint{"courier_id": 5})
+	do("POST", fmt.Sprintf("/api/deliveries/%d/deliver", d1.ID), makeCourierJWT(5), nil)
+	assert.Equal(t, 400, do("POST", returnPath, makeJWT(1), map[string]string{"reason": "CHANGED_MIND"}).Code)
+	assert.Equal(t, 403, do("POST", returnPath, makeJWT(2), map[string]string{"reason": "DAMAGED"}).Code)
+
+	w := do("POST", returnPath, makeJWT(1), map[string]string{"reason": "DAMAGED", "notes": "Box crushed"})
+	assert.Equal(t, 200, w.Code)
+	var resp struct {
+		Return         model.ReturnRequest `json:"return"`
+		ReturnDelivery model.Delivery      `json:"return_delivery"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, d1.ID, resp.Return.OriginalDeliveryID)
+	assert.Equal(t, "Recipient 2", resp.ReturnDelivery.FromAddress)
+	assert.Equal(t, "Sender 1", resp.ReturnDelivery.ToAddress)
+	assert.Equal(t, d1.ID, resp.ReturnDelivery.ReturnOf)
+	assert.True(t, strings.HasPrefix(resp.ReturnDelivery.TrackingNumber, "RT"))
+	assert.Equal(t, 409, do("POST", returnPath, makeJWT(1), map[string]string{"reason": "DAMAGED"}).Code)
+
+	// The reverse delivery goes through normal assignment
+	assert.Equal(t, 200, do("POST", fmt.Sprintf("/api/deliveries/%d/assign", resp.ReturnDelivery.ID), makeDispatcherJWT(9), map[string]uint{"courier_id": 5}).Code)
+
+	// Three failed attempts trigger an automatic return
+	failPath := fmt.Sprintf("/api/deliveries/%d/attempt-failed", d2.ID)
+	for i := 0; i < 2; i++ {
+		assert.NotContains(t, do("POST", failPath, makeCourierJWT(5), map[string]string{"reason": "nobody home"}).Body.String(), "return_delivery")
+	}
+	w = do("POST", failPath, makeCourierJWT(5), map[string]string{"reason": "nobody home"})
+	assert.Equal(t, 200, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Equal(t, model.ReturnReasonFailedAttempts, resp.Return.Reason)
+	assert.True(t, resp.Return.Automatic)
+	got, _ := deliveries.GetDelivery(d2.ID)
+	assert.Equal(t, "RETURN_TO_SENDER", got.Status)
+
+	// Timeline records attempts and the return
+	var events []model.TimelineEvent
+	json.Unmarshal(do("GET", fmt.Sprintf("/api/deliveries/%d/timeline", d2.ID), makeJWT(1), nil).Body.Bytes(), &events)
+	types := []string{}
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	assert.Equal(t, []string{"created", "attempt_failed", "attempt_failed", "attempt_failed", "return.created"}, types)
+
+	// Dashboard and export
+	var dash struct {
+		Total    int            `json:"total"`
+		ByReason map[string]int `json:"by_reason"`
+		ByStatus map[string]int `json:"by_status"`
+	}
+	json.Unmarshal(do("GET", "/api/returns", makeJWT(1), nil).Body.Bytes(), &dash)
+	assert.Equal(t, 2, dash.Total)
+	assert.Equal(t, 1, dash.ByReason["DAMAGED"])
+	assert.Equal(t, 1, dash.ByStatus["ASSIGNED"])
+	json.Unmarshal(do("GET", "/api/returns", makeJWT(2), nil).Body.Bytes(), &dash)
+	assert.Equal(t, 0, dash.Total)
+
+	w = do("GET", "/api/returns/export?format=csv&reason=DAMAGED", makeJWT(1), nil)
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "ReturnID,OriginalTracking,ReturnTracking,Reason")
+	assert.Equal(t, 2, strings.Count(w.Body.String(), "\n"))
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"context"
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"deliverymanagement/internal/scan"
+	"deliverymanagement/internal/storage"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FileScanner runs uploaded files through the malware scanner in the
+// background. Files are quarantined from the moment they are submitted
+// until the scanner calls them clean; FileHandler refuses to serve them
+// meanwhile.
+type FileScanner struct {
+	Scanner scan.Scanner
+	Blobs   storage.BlobStore
+	Scans   repo.FileScanRepository
+	// DamageReports are marked when one of their files is infected; optional.
+	DamageReports repo.DamageReportRepository
+	// Users and Notifications alert admins to infected files; optional.
+	Users         repo.UserRepository
+	Notifications *NotificationHandler
+
+	wg sync.WaitGroup
+}
+
+// Quarantine marks the files pending. Handlers call it after storing the
+// blobs but before the record that makes them readable, then Submit once
+// the record exists.
+func (s *FileScanner) Quarantine(keys ...string) {
+	if s == nil {
+		return
+	}
+	for _, key := range keys {
+		if s.verdict(key) == nil {
+			s.Scans.SaveScan(&model.FileScan{Key: key, Status: model.ScanPending})
+		}
+	}
+}
+
+// verdict is the final scan result of a file, or nil while there is none.
+func (s *FileScanner) verdict(key string) *model.FileScan {
+	if prev, err := s.Scans.GetScan(key); err == nil && (prev.Status == model.ScanClean || prev.Status == model.ScanInfected) {
+		return prev
+	}
+	return nil
+}
+
+// Submit quarantines the files and scans them in the background. Keys are
+// content hashes, so content uploaded again keeps its earlier verdict.
+func (s *FileScanner) Submit(keys ...string) {
+	if s == nil || len(keys) == 0 {
+		return
+	}
+	var todo []string
+	for _, key := range keys {
+		if prev := s.verdict(key); prev != nil {
+			if prev.Status == model.ScanInfected {
+				s.infected(prev)
+			}
+			continue
+		}
+		s.Scans.SaveScan(&model.FileScan{Key: key, Status: model.ScanPending})
+		todo = append(todo, key)
+	}
+	if len(todo) == 0 {
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for _, key := range todo {
+			s.scan(context.Background(), key)
+		}
+	}()
+}
+
+// Wait blocks until every submitted scan has finished.
+func (s *FileScanner) Wait() {
+	s.wg.Wait()
+}
+
+func (s *FileScanner) scan(ctx context.Context, key string) {
+	result := &model.FileScan{Key: key, ScannedAt: time.Now()}
+	blob, _, err := s.Blobs.Get(ctx, key)
+	var res scan.Result
+	if err == nil {
+		res, err = s.Scanner.Scan(ctx, blob)
+		blob.Close()
+	}
+	switch {
+	case err != nil:
+		log.Printf("malware scan of %s failed: %v", key, err)
+		result.Status, result.Error = model.ScanFailed, err.Error()
+	case res.Infected:
+		result.Status, result.Signature = model.ScanInfected, res.Signature
+	default:
+		result.Status = model.ScanClean
+	}
+	s.Scans.SaveScan(result)
+	if result.Status == model.ScanInfected {
+		s.infected(result)
+	}
+}
+
+// infected marks the reports holding the file and notifies every admin.
+func (s *FileScanner) infected(fs *model.FileScan) {
+	data := map[string]interface{}{"file": fs.Key, "signature": fs.Signature}
+	if s.DamageReports != nil {
+		var ids []uint
+		for _, report := range s.DamageReports.MarkFileInfected(fs.Key) {
+			ids = append(ids, report.ID)
+		}
+		if len(ids) > 0 {
+			data["damage_report_ids"] = ids
+		}
+	}
+	notifyRole(s.Users, s.Notifications, "admin", model.Notification{
+		Type:      "file.infected",
+		Message:   fmt.Sprintf("Malware (%s) found in uploaded file %s; it has been quarantined", fs.Signature, fs.Key),
+		Data:      data,
+		CreatedAt: time.Now(),
+	})
+}
+
+// status is the scan state of a file, or nil when it was stored before
+// scanning was enabled.
+func (s *FileScanner) status(key string) *model.FileScan {
+	if s == nil {
+		return nil
+	}
+	fs, err := s.Scans.GetScan(originalKey(key))
+	if err != nil {
+		return nil
+	}
+	return fs
+}
+
+// GET /api/admin/files/:filename/scan (admin only)
+func (s *FileScanner) GetScan(c *gin.Context) {
+	fs := s.status(c.Param("filename"))
+	if fs == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "file was not scanned"})
+		return
+	}
+	c.JSON(http.StatusOK, fs)
+}
+
+// POST /api/admin/files/:filename/scan (admin only)
+// Scans the file again, e.g. after a failed scan; the file is quarantined
+// until the new verdict.
+func (s *FileScanner) Rescan(c *gin.Context) {
+	key := c.Param("filename")
+	if _, err := s.Blobs.Stat(c.Request.Context(), key); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	s.Scans.SaveScan(&model.FileScan{Key: key, Status: model.ScanPending})
+	s.Submit(key)
+	c.JSON(http.StatusAccepted, gin.H{"key": key, "status": model.ScanPending})
+}
@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"deliverymanagement/internal/scan"
+	"deliverymanagement/internal/storage"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// gatedScanner holds every scan until release is closed.
+type gatedScanner struct {
+	scan.Fake
+	release chan struct{}
+}
+
+func (g *gatedScanner) Scan(ctx context.Context, r io.Reader) (scan.Result, error) {
+	<-g.release
+	return g.Fake.Scan(ctx, r)
+}
+
+func TestMalwareScanQuarantine(t *testing.T) {
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	deliveries.CreateDelivery(&model.Delivery{ClientID: 1, CourierID: 5, Status: "IN_TRANSIT"})
+	reports := repo.NewInMemoryDamageReportRepo()
+	users := repo.NewInMemoryUserRepo()
+	users.CreateUser(&model.User{Email: "admin@example.com", Role: "admin"})
+	admin, _ := users.FindUserByEmail("admin@example.com")
+	notifications := repo.NewInMemoryNotificationRepo()
+	blobs := storage.NewMemoryStore()
+	scanner := &gatedScanner{release: make(chan struct{})}
+	fs := &FileScanner{
+		Scanner:       scanner,
+		Blobs:         blobs,
+		Scans:         repo.NewInMemoryFileScanRepo(),
+		DamageReports: reports,
+		Users:         users,
+		Notifications: &NotificationHandler{Notifications: notifications},
+	}
+	dh := &DamageReportHandler{DamageReports: reports, Blobs: blobs, Deliveries: deliveries, Scanner: fs}
+	fh := &FileHandler{DamageReports: reports, Blobs: blobs, Deliveries: deliveries, Scanner: fs}
+	r := gin.Default()
+	r.POST("/api/damage-report", JWTAuthMiddleware(testSecret), dh.CreateDamageReport)
+	r.GET("/files/:filename", JWTAuthMiddleware(testSecret), fh.ServeFile)
+
+	upload := func(name string, data []byte) model.DamageReport {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		mw.WriteField("delivery_id", "1")
+		mw.WriteField("type", "box damaged")
+		fw, _ := mw.CreateFormFile("attachments", name)
+		fw.Write(data)
+		mw.Close()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/damage-report", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+makeCourierJWT(5))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var report model.DamageReport
+		json.Unmarshal(w.Body.Bytes(), &report)
+		return report
+	}
+	get := func(path string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/files/"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+makeJWT(1))
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// A valid PDF carrying the EICAR test string after its header.
+	eicarPDF := append(append([]byte(nil), testPDF[:9]...), append([]byte(scan.EICAR+"\n"), testPDF[9:]...)...)
+	clean := upload("photo.jpg", testJPEG())
+	infected := upload("invoice.pdf", eicarPDF)
+	assert.Equal(t, http.StatusLocked, get(clean.PhotoPath), "pending until scanned")
+	assert.Equal(t, http.StatusLocked, get(clean.PhotoPath+"?size=thumb"))
+
+	close(scanner.release)
+	fs.Wait()
+	assert.Equal(t, http.StatusOK, get(clean.PhotoPath))
+	assert.Equal(t, http.StatusOK, get(clean.PhotoPath+"?size=thumb"))
+	assert.Equal(t, http.StatusLocked, get(infected.PhotoPath))
+
+	got, _ := reports.GetDamageReport(infected.ID)
+	assert.True(t, got.Infected)
+	got, _ = reports.GetDamageReport(clean.ID)
+	assert.False(t, got.Infected)
+	list, _ := notifications.ListNotifications(uint64(admin.ID))
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, "file.infected", list[0].Type)
+		assert.Equal(t, []uint{infected.ID}, list[0].Data["damage_report_ids"])
+	}
+
+	// The same content uploaded again keeps its verdict without a rescan.
+	again := upload("copy.pdf", eicarPDF)
+	assert.Equal(t, infected.PhotoPath, again.PhotoPath)
+	got, _ = reports.GetDamageReport(again.ID)
+	assert.True(t, got.Infected)
+}
+
+// scanAtCreate records the scan status of a report's file the moment the
+// report becomes readable.
+type scanAtCreate struct {
+	*repo.InMemoryDamageReportRepo
+	scans  repo.FileScanRepository
+	status string
+}
+
+func (r *scanAtCreate) CreateDamageReport(report *model.DamageReport) error {
+	if fs, err := r.scans.GetScan(report.PhotoPath); err == nil {
+		r.status = fs.Status
+	}
+	return r.InMemoryDamageReportRepo.CreateDamageReport(report)
+}
+
+func TestMalwareScanQuarantinedBeforeReadable(t *testing.T) {
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	deliveries.CreateDelivery(&model.Delivery{ClientID: 1, CourierID: 5, Status: "IN_TRANSIT"})
+	scans := repo.NewInMemoryFileScanRepo()
+	reports := &scanAtCreate{InMemoryDamageReportRepo: repo.NewInMemoryDamageReportRepo(), scans: scans}
+	blobs := storage.NewMemoryStore()
+	scanner := &gatedScanner{release: make(chan struct{})}
+	fs := &FileScanner{Scanner: scanner, Blobs: blobs, Scans: scans, DamageReports: reports}
+	dh := &DamageReportHandler{DamageReports: reports, Blobs: blobs, Deliveries: deliveries, Scanner: fs}
+	r := gin.Default()
+	r.POST("/api/damage-report", JWTAuthMiddleware(testSecret), dh.CreateDamageReport)
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	mw.WriteField("delivery_id", "1")
+	mw.WriteField("type", "box damaged")
+	fw, _ := mw.CreateFormFile("attachments", "photo.jpg")
+	fw.Write(testJPEG())
+	mw.Close()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/damage-report", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+makeCourierJWT(5))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, model.ScanPending, reports.status)
+	close(scanner.release)
+	fs.Wait()
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"deliverymanagement/internal/geo"
+	"deliverymanagement/internal/serviceability"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ServiceabilityHandler struct {
+	Checker  *serviceability.Checker
+	Geocoder geo.Geocoder
+}
+
+// POST /api/serviceability
+func (h *ServiceabilityHandler) Check(c *gin.Context) {
+	var req struct {
+		OriginAddress      string        `json:"origin_address"`
+		DestinationAddress string        `json:"destination_address"`
+		Origin             *addressInput `json:"origin"`
+		Destination        *addressInput `json:"destination"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+	origin, err := geo.Resolve(h.Geocoder, req.Origin.toAddress(req.OriginAddress))
+	if err != nil && !errors.Is(err, geo.ErrNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field": "origin"})
+		return
+	}
+	dest, err := geo.Resolve(h.Geocoder, req.Destination.toAddress(req.DestinationAddress))
+	if err != nil && !errors.Is(err, geo.ErrNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "field": "destination"})
+		return
+	}
+	c.JSON(http.StatusOK, h.Checker.Check(origin, dest))
+}
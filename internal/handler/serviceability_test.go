@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"deliverymanagement/internal/geo"
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"deliverymanagement/internal/serviceability"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceabilityCheckAndBooking(t *testing.T) {
+	gz, _ := geo.LoadGazetteer(strings.NewReader("KZ,050000,Almaty,43.2389,76.8897\nKZ,010000,Astana,51.1282,71.4307\n"))
+	zones := repo.NewInMemoryZoneRepo()
+	polys, _ := geo.ParseGeoJSON([]byte(`{"type":"Polygon","coordinates":[[[76.8,43.2],[77.0,43.2],[77.0,43.3],[76.8,43.3],[76.8,43.2]]]}`))
+	zones.CreateZone(&model.Zone{Name: "Almaty", Hub: "ALA", ServiceLevels: []string{"STANDARD", "EXPRESS"}, Polygons: polys})
+	checker := &serviceability.Checker{
+		Zones: zones,
+		Now:   func() time.Time { return time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC) },
+	}
+	sh := &ServiceabilityHandler{Checker: checker, Geocoder: gz}
+	dh := &DeliveryHandler{Deliveries: repo.NewInMemoryDeliveryRepo(), Geocoder: gz, Zones: zones, Serviceability: checker}
+	r := gin.Default()
+	r.POST("/api/serviceability", sh.Check)
+	r.POST("/api/deliveries", JWTAuthMiddleware(testSecret), dh.CreateDelivery)
+	post := func(path string, body interface{}) *httptest.ResponseRecorder {
+		return serveJSON(r, "POST", path, makeJWT(1), body)
+	}
+
+	w := post("/api/serviceability", map[string]interface{}{
+		"origin_address": "Abay 1, Almaty, KZ",
+		"destination":    map[string]string{"street": "Tole Bi 5", "city": "Almaty", "country": "KZ"},
+	})
+	assert.Equal(t, 200, w.Code)
+	var res serviceability.Result
+	json.Unmarshal(w.Body.Bytes(), &res)
+	assert.True(t, res.Serviceable)
+	assert.Len(t, res.Options, 2)
+	assert.Equal(t, "2026-10-15", res.EarliestDelivery)
+
+	w = post("/api/serviceability", map[string]string{"origin_address": "Abay 1, Almaty, KZ", "destination_address": "Kenesary 2, Astana, KZ"})
+	json.Unmarshal(w.Body.Bytes(), &res)
+	assert.False(t, res.Serviceable)
+	assert.Equal(t, serviceability.ReasonDestNotCovered, res.Reason)
+
+	// Booking an unserviceable destination is refused
+	w = post("/api/deliveries", map[string]string{"from_address": "Abay 1, Almaty, KZ", "to_address": "Kenesary 2, Astana, KZ"})
+	assert.Equal(t, 422, w.Code)
+	assert.Contains(t, w.Body.String(), serviceability.ReasonDestNotCovered)
+
+	// Unavailable service level is refused
+	w = post("/api/deliveries", map[string]string{"from_address": "Abay 1, Almaty, KZ", "to_address": "Tole Bi 5, Almaty, KZ", "service_level": "SAME_DAY"})
+	assert.Equal(t, 422, w.Code)
+
+	// Serviceable booking carries the quoted level and date
+	w = post("/api/deliveries", map[string]string{"from_address": "Abay 1, Almaty, KZ", "to_address": "Tole Bi 5, Almaty, KZ", "service_level": "EXPRESS"})
+	assert.Equal(t, 200, w.Code)
+	var d model.Delivery
+	json.Unmarshal(w.Body.Bytes(), &d)
+	assert.Equal(t, "EXPRESS", d.ServiceLevel)
+	assert.Equal(t, "2026-10-15", d.PromisedDate.Format("2006-01-02"))
+}
@@ -0,0 +1,462 @@
+package handler
+
+import (
+	"context"
+	"deliverymanagement/internal/media"
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"deliverymanagement/internal/storage"
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// File types for retention and usage reporting.
+const (
+	FileTypeDamage  = "damage"  // damage report photos and documents
+	FileTypeComment = "comment" // comment attachments
+)
+
+// defaultOrphanGrace keeps fresh blobs whose record is still being saved.
+const defaultOrphanGrace = 24 * time.Hour
+
+// StorageHandler looks after the blob store: it enforces per-client quotas
+// on uploads, reports usage to admins and runs the janitor that removes
+// orphaned and expired files.
+type StorageHandler struct {
+	Blobs         storage.BlobStore
+	Deliveries    repo.DeliveryRepository
+	DamageReports repo.DamageReportRepository
+	Comments      repo.CommentRepository
+	// Claims decides when damage files start to age; optional. Without it
+	// they age from the report.
+	Claims repo.DamageClaimRepository
+	Quotas repo.StorageQuotaRepository
+	// DefaultQuota applies to clients without their own quota; 0 means
+	// unlimited.
+	DefaultQuota int64
+	// Retention is how long files of each type are kept. Damage files age
+	// from the closure of their claim, so files of open claims are kept;
+	// comment attachments age from the comment. Types without an entry
+	// are kept forever.
+	Retention map[string]time.Duration
+	// OrphanGrace is how old an unreferenced blob must be before it is
+	// removed; 24 hours when zero.
+	OrphanGrace time.Duration
+
+	// mu guards usage and pending.
+	mu sync.Mutex
+	// usage is each client's stored files by key, loaded from the records
+	// on a client's first upload after a sweep and kept up to date by
+	// admit.
+	usage map[uint]map[string]storedFile
+	// pending holds each client's admitted uploads whose record is not
+	// saved yet, so they count against the quota meanwhile.
+	pending map[uint][]storedUpload
+}
+
+// storedFile is a file referenced by a record.
+type storedFile struct {
+	Key      string
+	Type     string
+	ClientID uint
+	Size     int64
+	// Expires is when retention ends; zero while the file must be kept.
+	Expires time.Time
+}
+
+// expired reports whether the file's retention has ended at now.
+func (f storedFile) expired(now time.Time) bool {
+	return !f.Expires.IsZero() && !now.Before(f.Expires)
+}
+
+// ClientStorage is a client's storage usage, in bytes as stored.
+type ClientStorage struct {
+	ClientID uint                    `json:"client_id"`
+	Files    int                     `json:"files"`
+	Bytes    int64                   `json:"bytes"`
+	Quota    int64                   `json:"quota"` // 0: unlimited
+	ByType   map[string]StorageUsage `json:"by_type"`
+}
+
+type StorageUsage struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// SweepResult lists what a janitor run removed.
+type SweepResult struct {
+	Orphaned []string `json:"orphaned"`
+	Expired  []string `json:"expired"`
+	Freed    int64    `json:"freed_bytes"`
+}
+
+// files lists the files referenced by reports and comments, through the
+// deliveries they belong to.
+func (h *StorageHandler) files() []storedFile {
+	deliveries, _ := h.Deliveries.ListDeliveries()
+	var out []storedFile
+	for _, d := range deliveries {
+		for _, r := range h.DamageReports.ListDamageReports(d.ID) {
+			expires := h.expires(FileTypeDamage, h.damageAge(r))
+			seen := false
+			for _, a := range r.Attachments {
+				seen = seen || a.Path == r.PhotoPath
+				out = append(out, storedFile{Key: a.Path, Type: FileTypeDamage, ClientID: d.ClientID, Size: a.Size, Expires: expires})
+			}
+			if !seen && r.PhotoPath != "" {
+				out = append(out, storedFile{Key: r.PhotoPath, Type: FileTypeDamage, ClientID: d.ClientID, Size: r.PhotoSize, Expires: expires})
+			}
+		}
+		if h.Comments == nil {
+			continue
+		}
+		comments, _ := h.Comments.ListComments(d.ID)
+		for _, cm := range comments {
+			expires := h.expires(FileTypeComment, cm.CreatedAt)
+			for _, a := range cm.Attachments {
+				out = append(out, storedFile{Key: a.Path, Type: FileTypeComment, ClientID: d.ClientID, Size: a.Size, Expires: expires})
+			}
+		}
+	}
+	return out
+}
+
+// damageAge is when a report's files start to age: the closure of its
+// claim, or the report itself when it has none. Zero while the claim is
+// open.
+func (h *StorageHandler) damageAge(r *model.DamageReport) time.Time {
+	if r.ClaimID == 0 || h.Claims == nil {
+		return r.Timestamp
+	}
+	claim, err := h.Claims.GetClaim(r.ClaimID)
+	if err != nil {
+		return r.Timestamp
+	}
+	switch claim.Status {
+	case model.ClaimRejected:
+		return claim.DecidedAt
+	case model.ClaimPaid:
+		return claim.PaidAt
+	}
+	return time.Time{}
+}
+
+func (h *StorageHandler) expires(fileType string, from time.Time) time.Time {
+	keep, ok := h.Retention[fileType]
+	if !ok || keep <= 0 || from.IsZero() {
+		return time.Time{}
+	}
+	return from.Add(keep)
+}
+
+// referenced reports whether a record still points at the original key.
+// Reports are found directly, so ones whose delivery is gone still count.
+func (h *StorageHandler) referenced(key string) bool {
+	if len(h.DamageReports.FindDamageReportsByFile(key)) > 0 {
+		return true
+	}
+	return h.Comments != nil && len(h.Comments.FindCommentsByAttachment(key)) > 0
+}
+
+// Sweep removes orphaned blobs, whose upload has no record, and files past
+// their retention together with their variants. A blob shared by several
+// records is removed only when all of them have expired. Expired records
+// stay as history; their files answer 404.
+func (h *StorageHandler) Sweep(ctx context.Context, now time.Time) (SweepResult, error) {
+	var res SweepResult
+	blobs, err := h.Blobs.List(ctx, "")
+	if err != nil {
+		return res, err
+	}
+	// Files are about to go; usage is loaded again from the records.
+	defer func() {
+		h.mu.Lock()
+		h.usage = nil
+		h.mu.Unlock()
+	}()
+	expired, kept := make(map[string]bool), make(map[string]bool)
+	for _, f := range h.files() {
+		if f.expired(now) {
+			expired[f.Key] = true
+		} else {
+			kept[f.Key] = true
+		}
+	}
+	grace := h.OrphanGrace
+	if grace <= 0 {
+		grace = defaultOrphanGrace
+	}
+	for _, b := range blobs {
+		key := originalKey(b.Key)
+		var list *[]string
+		switch {
+		case expired[key] && !kept[key]:
+			list = &res.Expired
+		case !kept[key] && !expired[key] && now.Sub(b.ModTime) >= grace && !h.referenced(key):
+			list = &res.Orphaned
+		default:
+			continue
+		}
+		if err := h.Blobs.Delete(ctx, b.Key); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				continue
+			}
+			return res, err
+		}
+		*list = append(*list, b.Key)
+		res.Freed += b.Size
+	}
+	return res, nil
+}
+
+// originalKey maps a variant such as <sha256>_thumb.jpg to its upload.
+func originalKey(key string) string {
+	ext := filepath.Ext(key)
+	base := strings.TrimSuffix(key, ext)
+	for _, v := range media.Variants {
+		if strings.HasSuffix(base, "_"+v.Name) {
+			return strings.TrimSuffix(base, "_"+v.Name) + ext
+		}
+	}
+	return key
+}
+
+// StartJanitor runs Sweep every interval until the process exits.
+func (h *StorageHandler) StartJanitor(interval time.Duration) {
+	go func() {
+		for {
+			res, err := h.Sweep(context.Background(), time.Now())
+			if err != nil {
+				log.Printf("storage janitor: %v", err)
+			} else if len(res.Orphaned)+len(res.Expired) > 0 {
+				log.Printf("storage janitor: removed %d orphaned and %d expired blobs, %d bytes", len(res.Orphaned), len(res.Expired), res.Freed)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// Usage sums the files referenced per client and type. A file counts once
+// per client even when several records share it; expired files do not
+// count.
+func (h *StorageHandler) Usage() []ClientStorage {
+	now := time.Now()
+	byClient := make(map[uint]*ClientStorage)
+	seen := make(map[uint]map[string]bool)
+	for _, f := range h.files() {
+		if f.expired(now) {
+			continue
+		}
+		cs := byClient[f.ClientID]
+		if cs == nil {
+			cs = &ClientStorage{ClientID: f.ClientID, Quota: h.quota(f.ClientID), ByType: make(map[string]StorageUsage)}
+			byClient[f.ClientID] = cs
+			seen[f.ClientID] = make(map[string]bool)
+		}
+		if seen[f.ClientID][f.Key] {
+			continue
+		}
+		seen[f.ClientID][f.Key] = true
+		cs.Files++
+		cs.Bytes += f.Size
+		t := cs.ByType[f.Type]
+		t.Files++
+		t.Bytes += f.Size
+		cs.ByType[f.Type] = t
+	}
+	out := make([]ClientStorage, 0, len(byClient))
+	for _, cs := range byClient {
+		out = append(out, *cs)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ClientID < out[j].ClientID })
+	return out
+}
+
+func (h *StorageHandler) quota(clientID uint) int64 {
+	if h.Quotas != nil {
+		if q, ok := h.Quotas.GetQuota(clientID); ok {
+			return q
+		}
+	}
+	return h.DefaultQuota
+}
+
+// admission holds room for uploads until the record holding them is saved.
+// A nil admission, from a nil handler, does nothing.
+type admission struct {
+	h         *StorageHandler
+	clientID  uint
+	uploads   []storedUpload
+	committed bool
+}
+
+// commit counts the uploads towards the client's usage once their record
+// is saved.
+func (a *admission) commit() {
+	if a == nil || a.committed {
+		return
+	}
+	a.h.mu.Lock()
+	defer a.h.mu.Unlock()
+	used := a.h.clientUsage(a.clientID)
+	for _, u := range a.uploads {
+		used[u.Path] = storedFile{Key: u.Path, ClientID: a.clientID, Size: u.Size}
+	}
+	a.h.unreserve(a.clientID, a.uploads)
+	a.committed = true
+}
+
+// release ends the admission; uploads not committed give their room back.
+func (a *admission) release() {
+	if a == nil || a.committed {
+		return
+	}
+	a.h.mu.Lock()
+	defer a.h.mu.Unlock()
+	a.h.unreserve(a.clientID, a.uploads)
+	a.committed = true
+}
+
+// admit checks stored uploads against the quota of the delivery's client.
+// They are measured like Usage: by stored size, with a file the client
+// already has counted once. Admitted uploads hold their room until the
+// admission is released, so two uploads cannot both take the same room.
+// When they do not fit, 413 is written and false returned; the uploads are
+// left to the janitor. A nil handler admits everything.
+func (h *StorageHandler) admit(c *gin.Context, deliveryID uint, uploads []storedUpload) (*admission, bool) {
+	if h == nil {
+		return nil, true
+	}
+	d, err := h.Deliveries.GetDelivery(deliveryID)
+	if err != nil {
+		return nil, true
+	}
+	if used, quota, ok := h.reserve(d.ClientID, uploads); !ok {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "storage quota exceeded", "quota": quota, "used": used})
+		return nil, false
+	}
+	return &admission{h: h, clientID: d.ClientID, uploads: uploads}, true
+}
+
+// reserve holds room for the uploads when they fit the client's quota,
+// returning the client's usage and quota.
+func (h *StorageHandler) reserve(clientID uint, uploads []storedUpload) (used, quota int64, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	held := make(map[string]bool)
+	for key, f := range h.clientUsage(clientID) {
+		if !f.expired(now) {
+			held[key] = true
+			used += f.Size
+		}
+	}
+	for _, u := range h.pending[clientID] {
+		if !held[u.Path] {
+			held[u.Path] = true
+			used += u.Size
+		}
+	}
+	var incoming int64
+	for _, u := range uploads {
+		if !held[u.Path] {
+			held[u.Path] = true
+			incoming += u.Size
+		}
+	}
+	if quota = h.quota(clientID); quota > 0 && used+incoming > quota {
+		return used, quota, false
+	}
+	if h.pending == nil {
+		h.pending = make(map[uint][]storedUpload)
+	}
+	h.pending[clientID] = append(h.pending[clientID], uploads...)
+	return used, quota, true
+}
+
+// unreserve drops the uploads from the client's pending ones; callers hold
+// h.mu.
+func (h *StorageHandler) unreserve(clientID uint, uploads []storedUpload) {
+	pending := h.pending[clientID]
+	for _, u := range uploads {
+		for i, p := range pending {
+			if p == u {
+				pending = append(pending[:i], pending[i+1:]...)
+				break
+			}
+		}
+	}
+	if len(pending) == 0 {
+		delete(h.pending, clientID)
+	} else {
+		h.pending[clientID] = pending
+	}
+}
+
+// clientUsage returns the client's files by key, loading them from the
+// records the first time; callers hold h.mu.
+func (h *StorageHandler) clientUsage(clientID uint) map[string]storedFile {
+	if used, ok := h.usage[clientID]; ok {
+		return used
+	}
+	if h.usage == nil {
+		h.usage = make(map[uint]map[string]storedFile)
+	}
+	now := time.Now()
+	used := make(map[string]storedFile)
+	for _, f := range h.files() {
+		// A key shared by several records counts while any of them keeps it
+		if old, ok := used[f.Key]; f.ClientID == clientID && (!ok || old.expired(now)) {
+			used[f.Key] = f
+		}
+	}
+	h.usage[clientID] = used
+	return used
+}
+
+// GET /api/admin/storage/usage (admin only)
+func (h *StorageHandler) GetUsage(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"clients": h.Usage(), "default_quota": h.DefaultQuota})
+}
+
+// PUT /api/admin/storage/quotas/:client_id (admin only)
+// Body: {"bytes": 1073741824}; 0 lifts the limit.
+func (h *StorageHandler) SetQuota(c *gin.Context) {
+	clientID, err := strconv.ParseUint(c.Param("client_id"), 10, 64)
+	if err != nil || clientID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid client id"})
+		return
+	}
+	var req struct {
+		Bytes *int64 `json:"bytes" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	if err := h.Quotas.SetQuota(uint(clientID), *req.Bytes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"client_id": clientID, "quota": *req.Bytes})
+}
+
+// POST /api/admin/storage/sweep (admin only)
+// Runs the janitor now instead of waiting for its next run.
+func (h *StorageHandler) RunSweep(c *gin.Context) {
+	res, err := h.Sweep(c.Request.Context(), time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
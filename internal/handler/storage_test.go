@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"deliverymanagement/internal/media"
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"deliverymanagement/internal/storage"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStorageJanitor(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	deliveries.CreateDelivery(&model.Delivery{ClientID: 1, Status: "DELIVERED"})
+	reports := repo.NewInMemoryDamageReportRepo()
+	claims := repo.NewInMemoryDamageClaimRepo()
+	comments := repo.NewInMemoryCommentRepo()
+	blobs := storage.NewMemoryStore()
+	h := &StorageHandler{
+		Blobs:         blobs,
+		Deliveries:    deliveries,
+		DamageReports: reports,
+		Comments:      comments,
+		Claims:        claims,
+		Retention:     map[string]time.Duration{FileTypeDamage: 730 * 24 * time.Hour},
+	}
+	put := func(key string) {
+		blobs.Put(ctx, key, []byte("data-"+key), "image/jpeg")
+	}
+	attach := func(key string) []model.DamageAttachment {
+		return []model.DamageAttachment{{Path: key, Size: int64(len("data-" + key))}}
+	}
+
+	// Paid three years ago: expired, with its variant.
+	claims.CreateClaim(&model.DamageClaim{ReportID: 1, Status: model.ClaimPaid, PaidAt: now.AddDate(-3, 0, 0)})
+	reports.CreateDamageReport(&model.DamageReport{DeliveryID: 1, ClaimID: 1, PhotoPath: "old.jpg", Attachments: attach("old.jpg"), Timestamp: now.AddDate(-4, 0, 0)})
+	put("old.jpg")
+	put("old_thumb.jpg")
+	// Open claim from long ago: kept.
+	claims.CreateClaim(&model.DamageClaim{ReportID: 2, Status: model.ClaimUnderReview})
+	reports.CreateDamageReport(&model.DamageReport{DeliveryID: 1, ClaimID: 2, PhotoPath: "open.jpg", Attachments: attach("open.jpg"), Timestamp: now.AddDate(-4, 0, 0)})
+	put("open.jpg")
+	// Shared between an expired report and a live comment: kept.
+	reports.CreateDamageReport(&model.DamageReport{DeliveryID: 1, PhotoPath: "shared.jpg", Attachments: attach("shared.jpg"), Timestamp: now.AddDate(-3, 0, 0)})
+	comments.CreateComment(&model.Comment{DeliveryID: 1, Attachments: []model.CommentAttachment{{Path: "shared.jpg", Size: 15}}, CreatedAt: now})
+	put("shared.jpg")
+	// No record: removed once past the grace period.
+	put("orphan.jpg")
+	put("orphan_medium.jpg")
+
+	res, err := h.Sweep(ctx, now)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old.jpg", "old_thumb.jpg"}, res.Expired)
+	assert.Empty(t, res.Orphaned, "fresh blobs are within the grace period")
+
+	res, err = h.Sweep(ctx, now.Add(25*time.Hour))
+	assert.NoError(t, err)
+	assert.Empty(t, res.Expired)
+	assert.Equal(t, []string{"orphan.jpg", "orphan_medium.jpg"}, res.Orphaned)
+	assert.Equal(t, int64(len("data-orphan.jpg")+len("data-orphan_medium.jpg")), res.Freed)
+
+	left, _ := blobs.List(ctx, "")
+	var keys []string
+	for _, b := range left {
+		keys = append(keys, b.Key)
+	}
+	assert.Equal(t, []string{"open.jpg", "shared.jpg"}, keys)
+}
+
+func TestStorageQuotaAndUsage(t *testing.T) {
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	deliveries.CreateDelivery(&model.Delivery{ClientID: 1, CourierID: 5, Status: "IN_TRANSIT"})
+	reports := repo.NewInMemoryDamageReportRepo()
+	blobs := storage.NewMemoryStore()
+	sh := &StorageHandler{
+		Blobs:         blobs,
+		Deliveries:    deliveries,
+		DamageReports: reports,
+		Quotas:        repo.NewInMemoryStorageQuotaRepo(),
+	}
+	dh := &DamageReportHandler{DamageReports: reports, Blobs: blobs, Deliveries: deliveries, Storage: sh}
+	r := gin.Default()
+	r.POST("/api/damage-report", JWTAuthMiddleware(testSecret), dh.CreateDamageReport)
+	r.GET("/api/admin/storage/usage", JWTAuthMiddleware(testSecret), AdminOnly(), sh.GetUsage)
+	r.PUT("/api/admin/storage/quotas/:client_id", JWTAuthMiddleware(testSecret), AdminOnly(), sh.SetQuota)
+
+	report := func() int {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		mw.WriteField("delivery_id", "1")
+		mw.WriteField("type", "box damaged")
+		fw, _ := mw.CreateFormFile("photo", "photo.jpg")
+		fw.Write(testJPEG())
+		mw.Close()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/damage-report", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+makeCourierJWT(5))
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	admin := func(method, path, body string) *httptest.ResponseRecorder {
+		return serveJSON(r, method, path, makeAdminJWT(9), body, "Content-Type", "application/json")
+	}
+
+	assert.Equal(t, http.StatusOK, report())
+	w := admin("GET", "/api/admin/storage/usage", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var usage struct{ Clients []ClientStorage }
+	json.Unmarshal(w.Body.Bytes(), &usage)
+	if assert.Len(t, usage.Clients, 1) {
+		assert.Equal(t, uint(1), usage.Clients[0].ClientID)
+		assert.Equal(t, 1, usage.Clients[0].ByType[FileTypeDamage].Files)
+		assert.Greater(t, usage.Clients[0].Bytes, int64(0))
+	}
+
+	assert.Equal(t, http.StatusBadRequest, admin("PUT", "/api/admin/storage/quotas/1", `{"bytes": -1}`).Code)
+	assert.Equal(t, http.StatusOK, admin("PUT", "/api/admin/storage/quotas/1", `{"bytes": 100}`).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, report())
+	assert.Len(t, reports.ListDamageReports(1), 1)
+	assert.Equal(t, http.StatusOK, admin("PUT", "/api/admin/storage/quotas/1", `{"bytes": 0}`).Code)
+	assert.Equal(t, http.StatusOK, report())
+}
+
+func TestStorageQuota_StoredSizeAndConcurrency(t *testing.T) {
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	deliveries.CreateDelivery(&model.Delivery{ClientID: 1, CourierID: 5, Status: "IN_TRANSIT"})
+	reports := repo.NewInMemoryDamageReportRepo()
+	blobs := storage.NewMemoryStore()
+	quotas := repo.NewInMemoryStorageQuotaRepo()
+	sh := &StorageHandler{Blobs: blobs, Deliveries: deliveries, DamageReports: reports, Quotas: quotas}
+	dh := &DamageReportHandler{DamageReports: reports, Blobs: blobs, Deliveries: deliveries, Storage: sh}
+	r := gin.Default()
+	r.POST("/api/damage-report", JWTAuthMiddleware(testSecret), dh.CreateDamageReport)
+	report := func(name string, data []byte) int {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		mw.WriteField("delivery_id", "1")
+		mw.WriteField("type", "box damaged")
+		fw, _ := mw.CreateFormFile("photo", name)
+		fw.Write(data)
+		mw.Close()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/damage-report", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+makeCourierJWT(5))
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// The quota is measured in stored bytes, after re-encoding
+	stored, _ := media.Process(testJPEG())
+	quotas.SetQuota(1, int64(len(stored.Data)))
+	assert.Equal(t, http.StatusOK, report("photo.jpg", testJPEG()))
+	assert.Equal(t, http.StatusOK, report("again.jpg", testJPEG()), "the same file counts once")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, report("doc.pdf", testPDF))
+	// Refused uploads are left to the janitor, which removes them once past
+	// the grace period
+	res, err := sh.Sweep(context.Background(), time.Now().Add(25*time.Hour))
+	assert.NoError(t, err)
+	if assert.Len(t, res.Orphaned, 1) {
+		assert.Contains(t, res.Orphaned[0], ".pdf")
+	}
+
+	// Concurrent uploads cannot both take the room that is left
+	quotas.SetQuota(1, int64(len(stored.Data)+len(testPDF)+1))
+	var wg sync.WaitGroup
+	codes := make([]int, 5)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = report("doc.pdf", append(append([]byte(nil), testPDF...), byte('0'+i)))
+		}(i)
+	}
+	wg.Wait()
+	ok := 0
+	for _, code := range codes {
+		if code == http.StatusOK {
+			ok++
+		}
+	}
+	assert.Equal(t, 1, ok)
+	assert.Len(t, reports.ListDamageReports(1), 3)
+}
+
+func TestStorageQuota_ExpiredFilesFreeRoom(t *testing.T) {
+	ctx := context.Background()
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	deliveries.CreateDelivery(&model.Delivery{ClientID: 1, CourierID: 5, Status: "IN_TRANSIT"})
+	reports := repo.NewInMemoryDamageReportRepo()
+	blobs := storage.NewMemoryStore()
+	quotas := repo.NewInMemoryStorageQuotaRepo()
+	sh := &StorageHandler{
+		Blobs:         blobs,
+		Deliveries:    deliveries,
+		DamageReports: reports,
+		Quotas:        quotas,
+		Retention:     map[string]time.Duration{FileTypeDamage: time.Hour},
+	}
+	dh := &DamageReportHandler{DamageReports: reports, Blobs: blobs, Deliveries: deliveries, Storage: sh}
+	r := gin.Default()
+	r.POST("/api/damage-report", JWTAuthMiddleware(testSecret), dh.CreateDamageReport)
+	report := func() int {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		mw.WriteField("delivery_id", "1")
+		mw.WriteField("type", "box damaged")
+		fw, _ := mw.CreateFormFile("photo", "photo.jpg")
+		fw.Write(testJPEG())
+		mw.Close()
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/damage-report", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+makeCourierJWT(5))
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// An expired file no longer counts, before and after the janitor runs
+	stored, _ := media.Process(testJPEG())
+	quotas.SetQuota(1, int64(len(stored.Data)))
+	old := []model.DamageAttachment{{Path: "old.jpg", Size: int64(len(stored.Data))}}
+	reports.CreateDamageReport(&model.DamageReport{DeliveryID: 1, PhotoPath: "old.jpg", Attachments: old, Timestamp: time.Now().Add(-2 * time.Hour)})
+	blobs.Put(ctx, "old.jpg", stored.Data, "image/jpeg")
+	assert.Empty(t, sh.Usage())
+	assert.Equal(t, http.StatusOK, report())
+
+	res, err := sh.Sweep(ctx, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old.jpg"}, res.Expired)
+	assert.Nil(t, sh.usage, "the janitor drops the cached usage")
+	if usage := sh.Usage(); assert.Len(t, usage, 1) {
+		assert.Equal(t, int64(len(stored.Data)), usage[0].Bytes)
+	}
+}
@@ -0,0 +1,443 @@
+package handler
+
+import (
+	"deliverymanagement/internal/geo"
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"deliverymanagement/internal/serviceability"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TemplateHandler manages recurring delivery templates and materializes
+// their occurrences into deliveries HorizonDays ahead.
+type TemplateHandler struct {
+	Templates      repo.DeliveryTemplateRepository
+	Deliveries     repo.DeliveryRepository
+	Geocoder       geo.Geocoder
+	Zones          repo.ZoneRepository
+	Serviceability *serviceability.Checker // optional
+	Timeline       repo.TimelineRepository
+	HorizonDays    int // defaults to 14
+	Now            func() time.Time
+
+	mu sync.Mutex // serializes materialization with template changes
+}
+
+func (h *TemplateHandler) today() time.Time {
+	now := time.Now()
+	if h.Now != nil {
+		now = h.Now()
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+type templateRequest struct {
+	Name           string        `json:"name" binding:"required"`
+	FromAddress    string        `json:"from_address"`
+	ToAddress      string        `json:"to_address"`
+	From           *addressInput `json:"from"`
+	To             *addressInput `json:"to"`
+	ServiceLevel   string        `json:"service_level"`
+	LengthCm       float64       `json:"length_cm" binding:"gte=0"`
+	WidthCm        float64       `json:"width_cm" binding:"gte=0"`
+	HeightCm       float64       `json:"height_cm" binding:"gte=0"`
+	WeightKg       float64       `json:"weight_kg" binding:"gte=0"`
+	RecipientEmail string        `json:"recipient_email"`
+	Recurrence     struct {
+		Frequency string   `json:"frequency" binding:"required,oneof=DAILY WEEKLY MONTHLY"`
+		Interval  int      `json:"interval" binding:"gte=0"`
+		Weekdays  []string `json:"weekdays"` // "mon".."sun"
+		MonthDay  int      `json:"month_day" binding:"gte=0,lte=31"`
+		StartDate string   `json:"start_date" binding:"required"` // YYYY-MM-DD
+		EndDate   string   `json:"end_date"`
+	} `json:"recurrence"`
+}
+
+// apply validates the request and copies it onto t, resolving addresses and
+// checking that the route is serviceable.
+func (h *TemplateHandler) apply(req *templateRequest, t *model.DeliveryTemplate) error {
+	rec := model.Recurrence{Frequency: req.Recurrence.Frequency, Interval: req.Recurrence.Interval, MonthDay: req.Recurrence.MonthDay}
+	var err error
+	if rec.StartDate, err = time.Parse("2006-01-02", req.Recurrence.StartDate); err != nil {
+		return errors.New("invalid start_date")
+	}
+	if req.Recurrence.EndDate != "" {
+		if rec.EndDate, err = time.Parse("2006-01-02", req.Recurrence.EndDate); err != nil || rec.EndDate.Before(rec.StartDate) {
+			return errors.New("invalid end_date")
+		}
+	}
+	for _, d := range req.Recurrence.Weekdays {
+		wd, ok := parseWeekday(d)
+		if !ok {
+			return errors.New("invalid weekday " + d)
+		}
+		rec.Weekdays = append(rec.Weekdays, wd)
+	}
+	switch {
+	case rec.Frequency == model.RecurrenceWeekly && len(rec.Weekdays) == 0:
+		return errors.New("weekly recurrence needs weekdays")
+	case rec.Frequency == model.RecurrenceMonthly && rec.MonthDay == 0:
+		return errors.New("monthly recurrence needs month_day")
+	}
+
+	origin, err := geo.Resolve(h.Geocoder, req.From.toAddress(req.FromAddress))
+	if err != nil && !errors.Is(err, geo.ErrNotFound) {
+		return fmt.Errorf("from: %w", err)
+	}
+	dest, err := geo.Resolve(h.Geocoder, req.To.toAddress(req.ToAddress))
+	if err != nil && !errors.Is(err, geo.ErrNotFound) {
+		return fmt.Errorf("to: %w", err)
+	}
+	level := req.ServiceLevel
+	if h.Serviceability != nil {
+		res := h.Serviceability.Check(origin, dest)
+		if !res.Serviceable {
+			return errors.New("not serviceable: " + res.Reason)
+		}
+		if level == "" {
+			level = res.Options[0].Level
+		}
+		if _, ok := res.Option(level); !ok {
+			return errors.New("service level not available")
+		}
+	}
+	t.Name = req.Name
+	t.Origin = origin
+	t.Destination = dest
+	t.ServiceLevel = level
+	t.LengthCm, t.WidthCm, t.HeightCm, t.WeightKg = req.LengthCm, req.WidthCm, req.HeightCm, req.WeightKg
+	t.RecipientEmail = req.RecipientEmail
+	t.Recurrence = rec
+	return nil
+}
+
+// template loads the template in :id if the caller may manage it.
+func (h *TemplateHandler) template(c *gin.Context) *model.DeliveryTemplate {
+	id, _ := strconv.Atoi(c.Param("id"))
+	t, err := h.Templates.GetTemplate(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return nil
+	}
+	if role, _ := c.Get("role"); role == "client" && t.ClientID != c.GetUint("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return nil
+	}
+	return t
+}
+
+// POST /api/templates
+func (h *TemplateHandler) CreateTemplate(c *gin.Context) {
+	var req templateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	t := &model.DeliveryTemplate{ClientID: c.GetUint("user_id"), CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := h.apply(&req, t); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.Templates.CreateTemplate(t); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.Materialize()
+	c.JSON(http.StatusOK, t)
+}
+
+// GET /api/templates
+// Clients see their own templates, staff see all.
+func (h *TemplateHandler) ListTemplates(c *gin.Context) {
+	list, _ := h.Templates.ListTemplates()
+	role, _ := c.Get("role")
+	out := []model.DeliveryTemplate{}
+	for _, t := range list {
+		if role == "client" && t.ClientID != c.GetUint("user_id") {
+			continue
+		}
+		out = append(out, t)
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// GET /api/templates/:id
+func (h *TemplateHandler) GetTemplate(c *gin.Context) {
+	if t := h.template(c); t != nil {
+		c.JSON(http.StatusOK, t)
+	}
+}
+
+// PUT /api/templates/:id
+// Changes apply to future occurrences: deliveries generated for today or
+// later that were not dispatched yet are cancelled and generated again.
+func (h *TemplateHandler) UpdateTemplate(c *gin.Context) {
+	t := h.template(c)
+	if t == nil {
+		return
+	}
+	var req templateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	updated := *t
+	if err := h.apply(&req, &updated); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	h.mu.Lock()
+	h.cancelOccurrences(&updated, h.today(), time.Time{}, c.GetUint("user_id"), "template changed")
+	updated.GeneratedThrough = time.Time{}
+	updated.UpdatedAt = time.Now()
+	err := h.Templates.UpdateTemplate(&updated)
+	h.mu.Unlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.Materialize()
+	c.JSON(http.StatusOK, updated)
+}
+
+// POST /api/templates/:id/pause
+// Stops generation and cancels future occurrences not dispatched yet.
+func (h *TemplateHandler) PauseTemplate(c *gin.Context) {
+	t := h.template(c)
+	if t == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	updated := *t
+	updated.Paused = true
+	updated.UpdatedAt = time.Now()
+	h.cancelOccurrences(&updated, h.today(), time.Time{}, c.GetUint("user_id"), "template paused")
+	h.Templates.UpdateTemplate(&updated)
+	c.JSON(http.StatusOK, updated)
+}
+
+// POST /api/templates/:id/resume
+func (h *TemplateHandler) ResumeTemplate(c *gin.Context) {
+	t := h.template(c)
+	if t == nil {
+		return
+	}
+	h.mu.Lock()
+	updated := *t
+	updated.Paused = false
+	updated.GeneratedThrough = time.Time{}
+	updated.UpdatedAt = time.Now()
+	h.Templates.UpdateTemplate(&updated)
+	h.mu.Unlock()
+	h.Materialize()
+	c.JSON(http.StatusOK, updated)
+}
+
+// POST /api/templates/:id/skip
+// Body: {"date": "YYYY-MM-DD"}. Skips one occurrence, cancelling its
+// delivery if it was already generated but not dispatched.
+func (h *TemplateHandler) SkipOccurrence(c *gin.Context) {
+	t := h.template(c)
+	if t == nil {
+		return
+	}
+	var req struct {
+		Date string `json:"date" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	day, err := time.Parse("2006-01-02", req.Date)
+	if err != nil || !t.Recurrence.Occurs(day) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no occurrence on " + req.Date})
+		return
+	}
+	if day.Before(h.today()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot skip a past occurrence"})
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, d := range h.generated(t.ID)[req.Date] {
+		if d.Status != "CREATED" {
+			c.JSON(http.StatusConflict, gin.H{"error": "the delivery for this date is already " + d.Status})
+			return
+		}
+	}
+	updated := *t
+	if !updated.IsSkipped(day) {
+		updated.Skipped = append(append([]string(nil), t.Skipped...), req.Date)
+	}
+	updated.UpdatedAt = time.Now()
+	h.cancelOccurrences(&updated, day, day, c.GetUint("user_id"), "occurrence skipped")
+	h.Templates.UpdateTemplate(&updated)
+	c.JSON(http.StatusOK, updated)
+}
+
+// GET /api/templates/:id/occurrences?days=30
+// Upcoming occurrence dates with the deliveries generated for them.
+func (h *TemplateHandler) ListOccurrences(c *gin.Context) {
+	t := h.template(c)
+	if t == nil {
+		return
+	}
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 || days > 366 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 366"})
+		return
+	}
+	generated := h.generated(t.ID)
+	out := []gin.H{}
+	today := h.today()
+	for day := today; day.Before(today.AddDate(0, 0, days)); day = day.AddDate(0, 0, 1) {
+		if !t.Recurrence.Occurs(day) {
+			continue
+		}
+		date := day.Format("2006-01-02")
+		occ := gin.H{"date": date, "skipped": t.IsSkipped(day)}
+		for _, d := range generated[date] {
+			if d.Status != "CANCELLED" {
+				occ["delivery_id"] = d.ID
+				occ["status"] = d.Status
+			}
+		}
+		out = append(out, occ)
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// generated returns the template's deliveries by occurrence date.
+func (h *TemplateHandler) generated(templateID uint) map[string][]model.Delivery {
+	out := map[string][]model.Delivery{}
+	list, _ := h.Deliveries.ListDeliveries()
+	for _, d := range list {
+		if d.TemplateID == templateID {
+			date := d.ScheduledDate.Format("2006-01-02")
+			out[date] = append(out[date], d)
+		}
+	}
+	return out
+}
+
+// cancelOccurrences cancels the template's undispatched deliveries scheduled
+// from `from` on, or only up to `to` when it is set.
+func (h *TemplateHandler) cancelOccurrences(t *model.DeliveryTemplate, from, to time.Time, actorID uint, why string) {
+	list, _ := h.Deliveries.ListDeliveries()
+	for _, d := range list {
+		if d.TemplateID != t.ID || d.Status != "CREATED" || d.ScheduledDate.Before(from) {
+			continue
+		}
+		if !to.IsZero() && d.ScheduledDate.After(to) {
+			continue
+		}
+		stored, err := h.Deliveries.GetDelivery(d.ID)
+		if err != nil {
+			continue
+		}
+		stored.Status = "CANCELLED"
+		if err := h.Deliveries.UpdateDelivery(stored); err != nil {
+			// Changed meanwhile, e.g. dispatched; leave it be.
+			log.Printf("template %d: cancelling delivery %d: %v", t.ID, d.ID, err)
+			continue
+		}
+		recordTimeline(h.Timeline, d.ID, actorID, "cancelled", "Cancelled: "+why, nil)
+	}
+}
+
+// Materialize creates the deliveries for every active template's
+// occurrences between today and HorizonDays ahead. It is idempotent and
+// returns the number of deliveries created.
+func (h *TemplateHandler) Materialize() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	horizonDays := h.HorizonDays
+	if horizonDays == 0 {
+		horizonDays = 14
+	}
+	today := h.today()
+	horizon := today.AddDate(0, 0, horizonDays)
+	templates, _ := h.Templates.ListTemplates()
+	created := 0
+	for _, t := range templates {
+		if t.Paused || !t.GeneratedThrough.Before(horizon) {
+			continue
+		}
+		from := today
+		if next := t.GeneratedThrough.AddDate(0, 0, 1); next.After(from) {
+			from = next
+		}
+		generated := h.generated(t.ID)
+		for day := from; !day.After(horizon); day = day.AddDate(0, 0, 1) {
+			if !t.Recurrence.Occurs(day) || t.IsSkipped(day) {
+				continue
+			}
+			exists := false
+			for _, d := range generated[day.Format("2006-01-02")] {
+				exists = exists || d.Status != "CANCELLED"
+			}
+			if exists {
+				continue
+			}
+			if err := h.createOccurrence(&t, day); err == nil {
+				created++
+			}
+		}
+		t.GeneratedThrough = horizon
+		h.Templates.UpdateTemplate(&t)
+	}
+	return created
+}
+
+func (h *TemplateHandler) createOccurrence(t *model.DeliveryTemplate, day time.Time) error {
+	d := &model.Delivery{
+		ClientID:          t.ClientID,
+		Origin:            t.Origin,
+		Destination:       t.Destination,
+		FromAddress:       t.Origin.String(),
+		ToAddress:         t.Destination.String(),
+		AddressUnresolved: !t.Origin.Geocoded || !t.Destination.Geocoded,
+		ServiceLevel:      t.ServiceLevel,
+		PromisedDate:      day,
+		Status:            "CREATED",
+		CreatedAt:         time.Now(),
+		LengthCm:          t.LengthCm,
+		WidthCm:           t.WidthCm,
+		HeightCm:          t.HeightCm,
+		WeightKg:          t.WeightKg,
+		RecipientEmail:    t.RecipientEmail,
+		TemplateID:        t.ID,
+		ScheduledDate:     day,
+	}
+	d.ZoneID = zoneFor(h.Zones, d.Destination)
+	if err := h.Deliveries.CreateDelivery(d); err != nil {
+		return err
+	}
+	d.TrackingNumber = trackingNumber("DM", d.ID)
+	if err := h.Deliveries.UpdateDelivery(d); err != nil {
+		log.Printf("template %d: setting tracking number of delivery %d: %v", t.ID, d.ID, err)
+	}
+	recordTimeline(h.Timeline, d.ID, 0, "created",
+		fmt.Sprintf("Generated from template %q for %s", t.Name, day.Format("2006-01-02")),
+		map[string]interface{}{"template_id": t.ID})
+	return nil
+}
+
+// StartScheduler runs Materialize every interval until the process exits.
+func (h *TemplateHandler) StartScheduler(interval time.Duration) {
+	go func() {
+		h.Materialize()
+		for range time.Tick(interval) {
+			h.Materialize()
+		}
+	}()
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"encoding/json"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestRecurrenceOccurs(t *testing.T) {
+	weekly := model.Recurrence{Frequency: model.RecurrenceWeekly, Interval: 2,
+		Weekdays: []time.Weekday{time.Tuesday, time.Thursday}, StartDate: date("2026-10-14")} // Wednesday
+	assert.False(t, weekly.Occurs(date("2026-10-13"))) // before start
+	assert.True(t, weekly.Occurs(date("2026-10-15")))
+	assert.False(t, weekly.Occurs(date("2026-10-20"))) // odd week
+	assert.True(t, weekly.Occurs(date("2026-10-27")))
+
+	monthly := model.Recurrence{Frequency: model.RecurrenceMonthly, MonthDay: 31, StartDate: date("2026-01-01"), EndDate: date("2026-06-30")}
+	assert.True(t, monthly.Occurs(date("2026-02-28")))
+	assert.True(t, monthly.Occurs(date("2026-03-31")))
+	assert.False(t, monthly.Occurs(date("2026-03-30")))
+	assert.False(t, monthly.Occurs(date("2026-07-31")))
+
+	daily := model.Recurrence{Frequency: model.RecurrenceDaily, Interval: 3, StartDate: date("2026-10-01")}
+	assert.True(t, daily.Occurs(date("2026-10-04")))
+	assert.False(t, daily.Occurs(date("2026-10-05")))
+}
+
+func TestDeliveryTemplates(t *testing.T) {
+	now := date("2026-10-14")
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	h := &TemplateHandler{Templates: repo.NewInMemoryDeliveryTemplateRepo(), Deliveries: deliveries,
+		Timeline: repo.NewInMemoryTimelineRepo(), HorizonDays: 14, Now: func() time.Time { return now }}
+	r := gin.Default()
+	api := r.Group("/api", JWTAuthMiddleware(testSecret))
+	api.POST("/templates", h.CreateTemplate)
+	api.PUT("/templates/:id", h.UpdateTemplate)
+	api.POST("/templates/:id/pause", h.PauseTemplate)
+	api.POST("/templates/:id/resume", h.ResumeTemplate)
+	api.POST("/templates/:id/skip", h.SkipOccurrence)
+	api.GET("/templates/:id/occurrences", h.ListOccurrences)
+	do := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		return serveJSON(r, method, path, token, body)
+	}
+	active := func() []model.Delivery {
+		list, _ := deliveries.ListDeliveries()
+		out := []model.Delivery{}
+		for _, d := range list {
+			if d.Status != "CANCELLED" {
+				out = append(out, d)
+			}
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].ScheduledDate.Before(out[j].ScheduledDate) })
+		return out
+	}
+	body := map[string]interface{}{
+		"name": "Weekly restock", "from_address": "Warehouse 1", "to_address": "Shop 2", "weight_kg": 12,
+		"recurrence": map[string]interface{}{"frequency": "WEEKLY", "weekdays": []string{"mon", "Thursday"}, "start_date": "2026-10-14"},
+	}
+	assert.Equal(t, 422, do("POST", "/api/templates", makeJWT(1), map[string]interface{}{
+		"name": "x", "from_address": "A", "to_address": "B",
+		"recurrence": map[string]interface{}{"frequency": "WEEKLY", "start_date": "2026-10-14"}}).Code)
+	for _, day := range []string{"monkey", "sunset", "mo"} {
+		assert.Equal(t, 422, do("POST", "/api/templates", makeJWT(1), map[string]interface{}{
+			"name": "x", "from_address": "A", "to_address": "B",
+			"recurrence": map[string]interface{}{"frequency": "WEEKLY", "weekdays": []string{day}, "start_date": "2026-10-14"}}).Code, day)
+	}
+	w := do("POST", "/api/templates", makeJWT(1), body)
+	assert.Equal(t, 200, w.Code)
+
+	// Thu 15, Mon 19, Thu 22, Mon 26 within 14 days
+	list := active()
+	assert.Len(t, list, 4)
+	assert.Equal(t, uint(1), list[0].TemplateID)
+	assert.Equal(t, date("2026-10-15"), list[0].ScheduledDate)
+	assert.Equal(t, 12.0, list[0].WeightKg)
+	assert.Equal(t, 0, h.Materialize())
+
+	// The scheduler keeps generating ahead as time moves on
+	now = date("2026-10-20")
+	assert.Equal(t, 2, h.Materialize()) // Thu 29, Mon 2
+	assert.Len(t, active(), 6)
+
+	assert.Equal(t, 403, do("POST", "/api/templates/1/skip", makeJWT(2), map[string]string{"date": "2026-10-22"}).Code)
+	assert.Equal(t, 400, do("POST", "/api/templates/1/skip", makeJWT(1), map[string]string{"date": "2026-10-21"}).Code)
+	assert.Equal(t, 200, do("POST", "/api/templates/1/skip", makeJWT(1), map[string]string{"date": "2026-10-22"}).Code)
+	assert.Len(t, active(), 5)
+	h.Materialize()
+	assert.Len(t, active(), 5)
+
+	// Pausing cancels upcoming deliveries, resuming brings back all but the skipped one
+	do("POST", "/api/templates/1/pause", makeJWT(1), nil)
+	assert.Len(t, active(), 2) // the 15th and 19th are in the past
+	assert.Equal(t, 0, h.Materialize())
+	do("POST", "/api/templates/1/resume", makeJWT(1), nil)
+	assert.Len(t, active(), 5)
+
+	// Editing moves future occurrences to Wednesdays; past ones are kept
+	body["recurrence"] = map[string]interface{}{"frequency": "WEEKLY", "weekdays": []string{"wed"}, "start_date": "2026-10-14"}
+	body["weight_kg"] = 20
+	assert.Equal(t, 200, do("PUT", "/api/templates/1", makeJWT(1), body).Code)
+	list = active()
+	assert.Len(t, list, 4) // 15 and 19 plus Wednesdays 21 and 28
+	for _, d := range list[2:] {
+		assert.Equal(t, time.Wednesday, d.ScheduledDate.Weekday())
+		assert.Equal(t, 20.0, d.WeightKg)
+	}
+
+	var occ []map[string]interface{}
+	json.Unmarshal(do("GET", "/api/templates/1/occurrences?days=14", makeJWT(1), nil).Body.Bytes(), &occ)
+	assert.Len(t, occ, 2)
+	assert.Equal(t, "2026-10-21", occ[0]["date"])
+	assert.NotNil(t, occ[0]["delivery_id"])
+}
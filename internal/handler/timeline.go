@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordTimeline appends an event to the delivery's timeline. It is a no-op
+// when no timeline repository is configured.
+func recordTimeline(tl repo.TimelineRepository, deliveryID, actorID uint, typ, msg string, data map[string]interface{}) {
+	if tl == nil {
+		return
+	}
+	tl.AddEvent(&model.TimelineEvent{
+		DeliveryID: deliveryID,
+		Type:       typ,
+		Message:    msg,
+		ActorID:    actorID,
+		Data:       data,
+		CreatedAt:  time.Now(),
+	})
+}
+
+// GET /api/deliveries/:id/timeline
+func (h *DeliveryHandler) GetTimeline(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if _, err := h.Deliveries.GetDelivery(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	events := []model.TimelineEvent{}
+	if h.Timeline != nil {
+		events, _ = h.Timeline.ListEvents(uint(id))
+	}
+	c.JSON(http.StatusOK, events)
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"context"
+	"deliverymanagement/internal/media"
+	"deliverymanagement/internal/storage"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// storedUpload is an uploaded file after verification, as kept in the blob
+// store. Images are stored re-encoded without metadata, next to their
+// variants.
+type storedUpload struct {
+	Path string // content-addressed blob key
+	Name string
+	Size int64
+	Mime string // sniffed from the content
+	GPS  *media.GPS
+}
+
+// saveUpload verifies an uploaded file and stores it with its variants.
+// Content that is not a valid JPEG, PNG or PDF fails with media.ErrInvalid.
+// Identical content shares its blobs with other uploads, so an abandoned
+// upload is never removed here; the janitor removes it once no record
+// refers to it.
+func saveUpload(ctx context.Context, blobs storage.BlobStore, fh *multipart.FileHeader) (storedUpload, error) {
+	u := storedUpload{Name: fh.Filename}
+	src, err := fh.Open()
+	if err != nil {
+		return u, err
+	}
+	defer src.Close()
+	data, err := io.ReadAll(io.LimitReader(src, maxAttachmentSize+1))
+	if err != nil {
+		return u, err
+	}
+	if len(data) > maxAttachmentSize {
+		return u, fmt.Errorf("%w: %s is too large (max 5MB)", media.ErrInvalid, fh.Filename)
+	}
+	f, err := media.Process(data)
+	if err != nil {
+		return u, err
+	}
+	u.Size, u.Mime, u.GPS = int64(len(f.Data)), f.Mime, f.GPS
+	if u.Path, _, err = storage.PutContent(ctx, blobs, f.Data, f.Ext, f.Mime); err != nil {
+		return u, err
+	}
+	for name, data := range f.Variants {
+		if err := blobs.Put(ctx, variantPath(u.Path, name), data, f.Mime); err != nil {
+			return u, err
+		}
+	}
+	return u, nil
+}
+
+// saveUploads stores every file, or none: when one is refused or cannot be
+// saved, 400 or 500 is written and false returned. The files already
+// stored are left to the janitor.
+func saveUploads(c *gin.Context, blobs storage.BlobStore, files []*multipart.FileHeader) ([]storedUpload, bool) {
+	ctx := c.Request.Context()
+	out := make([]storedUpload, 0, len(files))
+	for _, fh := range files {
+		u, err := saveUpload(ctx, blobs, fh)
+		if err != nil {
+			uploadFailed(c, fh, err)
+			return nil, false
+		}
+		out = append(out, u)
+	}
+	return out, true
+}
+
+// variantPath names the stored variant of an upload, e.g. <sha256>_thumb.jpg.
+func variantPath(path, variant string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "_" + variant + ext
+}
+
+// uploadFailed writes 400 for files that failed verification and 500 when
+// they could not be stored.
+func uploadFailed(c *gin.Context, fh *multipart.FileHeader, err error) {
+	if errors.Is(err, media.ErrInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fh.Filename + ": " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "could not save file"})
+}
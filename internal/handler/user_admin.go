@@ -5,6 +5,7 @@ import (
 	"deliverymanagement/internal/repo"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
@@ -12,6 +13,8 @@ import (
 
 type UserAdminHandler struct {
 	Users repo.UserRepository
+	// Tokens revokes the tokens of disabled and deleted users; optional.
+	Tokens repo.TokenRepository
 }
 
 // GET /api/admin/users
@@ -25,7 +28,7 @@ func (h *UserAdminHandler) CreateUser(c *gin.Context) {
 	var req struct {
 		Email    string `json:"email" binding:"required,email"`
 		Name     string `json:"name" binding:"required"`
-		Role     string `json:"role" binding:"required,oneof=admin dispatcher reporter"`
+		Role     string `json:"role" binding:"required,oneof=admin dispatcher reporter courier warehouse"`
 		Password string `json:"password" binding:"required,min=8"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -64,9 +67,10 @@ func (h *UserAdminHandler) GetUser(c *gin.Context) {
 func (h *UserAdminHandler) UpdateUser(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var req struct {
-		Email *string `json:"email" binding:"omitempty,email"`
-		Name  *string `json:"name" binding:"omitempty"`
-		Role  *string `json:"role" binding:"omitempty,oneof=admin dispatcher reporter"`
+		Email    *string `json:"email" binding:"omitempty,email"`
+		Name     *string `json:"name" binding:"omitempty"`
+		Role     *string `json:"role" binding:"omitempty,oneof=admin dispatcher reporter courier warehouse"`
+		Disabled *bool   `json:"disabled"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		handleValidationError(c, err)
@@ -84,10 +88,16 @@ func (h *UserAdminHandler) UpdateUser(c *gin.Context) {
 			if req.Role != nil {
 				u.Role = *req.Role
 			}
+			if req.Disabled != nil {
+				u.Disabled = *req.Disabled
+			}
 			if err := h.Users.UpdateUser(u); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
+			if u.Disabled {
+				h.revokeTokens(u.ID)
+			}
 			c.JSON(http.StatusOK, u)
 			return
 		}
@@ -102,6 +112,7 @@ func (h *UserAdminHandler) DeleteUser(c *gin.Context) {
 	for _, u := range users {
 		if int(u.ID) == id {
 			h.Users.DeleteUser(u.Email)
+			h.revokeTokens(u.ID)
 			c.Status(http.StatusNoContent)
 			return
 		}
@@ -109,6 +120,13 @@ func (h *UserAdminHandler) DeleteUser(c *gin.Context) {
 	c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 }
 
+// revokeTokens logs the user out everywhere at once.
+func (h *UserAdminHandler) revokeTokens(userID uint) {
+	if h.Tokens != nil {
+		h.Tokens.RevokeUser(userID, time.Now())
+	}
+}
+
 // handleValidationError centralizes validation error formatting
 func handleValidationError(c *gin.Context, err error) {
 	if ve, ok := err.(validator.ValidationErrors); ok {
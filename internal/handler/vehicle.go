@@ -0,0 +1,373 @@
+package handler
+
+import (
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type VehicleHandler struct {
+	Vehicles   repo.VehicleRepository
+	Deliveries repo.DeliveryRepository
+	// Users and Notifications receive maintenance and document reminders.
+	Users         repo.UserRepository
+	Notifications *NotificationHandler
+	// Timeline records manifest sealing on each delivery; optional.
+	Timeline   repo.TimelineRepository
+	NoticeDays int // how far ahead to warn, defaults to 14
+	Now        func() time.Time
+
+	mu       sync.Mutex
+	notified map[string]bool // reminders already sent, by vehicle, item and date
+}
+
+type vehicleRequest struct {
+	Plate          string  `json:"plate" binding:"required"`
+	Type           string  `json:"type" binding:"required"`
+	MaxWeightKg    float64 `json:"max_weight_kg" binding:"gt=0"`
+	MaxVolumeM3    float64 `json:"max_volume_m3" binding:"gt=0"`
+	Refrigerated   bool    `json:"refrigerated"`
+	MaintenanceDue string  `json:"maintenance_due"` // YYYY-MM-DD
+	Documents      []struct {
+		Type      string `json:"type" binding:"required"`
+		Number    string `json:"number"`
+		ExpiresAt string `json:"expires_at" binding:"required"` // YYYY-MM-DD
+	} `json:"documents" binding:"dive"`
+}
+
+// apply copies the request onto v after validating the dates.
+func (req *vehicleRequest) apply(v *model.Vehicle) error {
+	v.Plate = req.Plate
+	v.Type = req.Type
+	v.MaxWeightKg = req.MaxWeightKg
+	v.MaxVolumeM3 = req.MaxVolumeM3
+	v.Refrigerated = req.Refrigerated
+	v.MaintenanceDue = time.Time{}
+	if req.MaintenanceDue != "" {
+		due, err := time.Parse("2006-01-02", req.MaintenanceDue)
+		if err != nil {
+			return fmt.Errorf("invalid maintenance_due %q", req.MaintenanceDue)
+		}
+		v.MaintenanceDue = due
+	}
+	v.Documents = nil
+	for _, doc := range req.Documents {
+		exp, err := time.Parse("2006-01-02", doc.ExpiresAt)
+		if err != nil {
+			return fmt.Errorf("invalid expires_at %q for %s", doc.ExpiresAt, doc.Type)
+		}
+		v.Documents = append(v.Documents, model.VehicleDocument{Type: doc.Type, Number: doc.Number, ExpiresAt: exp})
+	}
+	return nil
+}
+
+// POST /api/vehicles (dispatcher only)
+func (h *VehicleHandler) CreateVehicle(c *gin.Context) {
+	var req vehicleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	v := &model.Vehicle{CreatedAt: time.Now()}
+	if err := req.apply(v); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.Vehicles.CreateVehicle(v); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, v)
+}
+
+// PUT /api/vehicles/:id (dispatcher only)
+func (h *VehicleHandler) UpdateVehicle(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	existing, err := h.Vehicles.GetVehicle(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	var req vehicleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	updated := *existing
+	if err := req.apply(&updated); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.Vehicles.UpdateVehicle(&updated); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// GET /api/vehicles
+func (h *VehicleHandler) ListVehicles(c *gin.Context) {
+	vehicles, _ := h.Vehicles.ListVehicles()
+	c.JSON(http.StatusOK, vehicles)
+}
+
+// VehicleLoad is what is currently on board compared with the capacity.
+type VehicleLoad struct {
+	Deliveries int     `json:"deliveries"`
+	WeightKg   float64 `json:"weight_kg"`
+	VolumeM3   float64 `json:"volume_m3"`
+}
+
+// GET /api/vehicles/:id
+func (h *VehicleHandler) GetVehicle(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	v, err := h.Vehicles.GetVehicle(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"vehicle": v, "load": vehicleLoad(h.Deliveries, v.ID)})
+}
+
+// POST /api/vehicles/:id/assignments (dispatcher only)
+// Hands the vehicle to a courier for one shift.
+func (h *VehicleHandler) AssignCourier(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req struct {
+		CourierID uint      `json:"courier_id" binding:"required"`
+		StartsAt  time.Time `json:"starts_at" binding:"required"`
+		EndsAt    time.Time `json:"ends_at" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	if !req.EndsAt.After(req.StartsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be after starts_at"})
+		return
+	}
+	if _, err := h.Vehicles.GetVehicle(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	a := &model.VehicleAssignment{
+		VehicleID: uint(id),
+		CourierID: req.CourierID,
+		StartsAt:  req.StartsAt,
+		EndsAt:    req.EndsAt,
+		CreatedBy: c.GetUint("user_id"),
+	}
+	if err := h.Vehicles.CreateAssignment(a); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, a)
+}
+
+// GET /api/vehicles/:id/assignments
+func (h *VehicleHandler) ListAssignments(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	list, _ := h.Vehicles.ListAssignments(uint(id))
+	c.JSON(http.StatusOK, list)
+}
+
+// vehicleLoad sums the parcels on board a vehicle, leaving out skip.
+// Parcels that were delivered, dropped at a pickup point or sent back are
+// no longer on board.
+func vehicleLoad(deliveries repo.DeliveryRepository, vehicleID uint, skip ...uint) VehicleLoad {
+	var load VehicleLoad
+	list, _ := deliveries.ListDeliveries()
+	for _, d := range list {
+		if d.VehicleID != vehicleID || slices.Contains(skip, d.ID) {
+			continue
+		}
+		if !onBoard(d.Status) {
+			continue
+		}
+		load.Deliveries++
+		load.WeightKg += d.WeightKg
+		load.VolumeM3 += d.VolumeM3()
+	}
+	return load
+}
+
+// onBoard reports whether a parcel in the status still takes up room on
+// its vehicle.
+func onBoard(status string) bool {
+	switch status {
+	case "DELIVERED", "AT_PICKUP_POINT", "RETURN_TO_SENDER", "CANCELLED":
+		return false
+	}
+	return true
+}
+
+var errVehicleCapacity = errors.New("vehicle cannot take the delivery")
+
+// vehicleLoads is held from a capacity check until the load it allowed is
+// stored, so concurrent assignments cannot overload a vehicle together.
+var vehicleLoads sync.Mutex
+
+// checkVehicleCapacity reports why ds cannot be loaded onto v together with
+// what is already on board, if they cannot.
+func checkVehicleCapacity(deliveries repo.DeliveryRepository, v *model.Vehicle, ds ...*model.Delivery) error {
+	skip := make([]uint, 0, len(ds))
+	for _, d := range ds {
+		if d.Refrigerated && !v.Refrigerated {
+			return fmt.Errorf("%w: delivery %d needs a refrigerated vehicle, %s is not", errVehicleCapacity, d.ID, v.Plate)
+		}
+		skip = append(skip, d.ID)
+	}
+	load := vehicleLoad(deliveries, v.ID, skip...)
+	for _, d := range ds {
+		load.WeightKg += d.WeightKg
+		load.VolumeM3 += d.VolumeM3()
+	}
+	if load.WeightKg > v.MaxWeightKg {
+		return fmt.Errorf("%w: %s would carry %.1f kg, capacity is %.1f kg", errVehicleCapacity, v.Plate, load.WeightKg, v.MaxWeightKg)
+	}
+	if load.VolumeM3 > v.MaxVolumeM3 {
+		return fmt.Errorf("%w: %s would carry %.2f m³, capacity is %.2f m³", errVehicleCapacity, v.Plate, load.VolumeM3, v.MaxVolumeM3)
+	}
+	return nil
+}
+
+// POST /api/vehicles/:id/manifests (dispatcher only)
+// Seals the listed deliveries onto the vehicle. Their combined weight and
+// volume, together with what is already on board, must fit the vehicle;
+// otherwise nothing is loaded and 422 is returned.
+func (h *VehicleHandler) SealManifest(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req struct {
+		DeliveryIDs []uint `json:"delivery_ids" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	v, err := h.Vehicles.GetVehicle(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	vehicleLoads.Lock()
+	defer vehicleLoads.Unlock()
+	ds := make([]*model.Delivery, 0, len(req.DeliveryIDs))
+	for _, did := range req.DeliveryIDs {
+		d, err := h.Deliveries.GetDelivery(did)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("delivery %d not found", did)})
+			return
+		}
+		if slices.ContainsFunc(ds, func(x *model.Delivery) bool { return x.ID == d.ID }) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("delivery %d is listed twice", did)})
+			return
+		}
+		if !onBoard(d.Status) || d.Status == "CANCELLED" {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("delivery %d is %s", did, d.Status)})
+			return
+		}
+		if d.VehicleID != 0 && d.VehicleID != v.ID {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("delivery %d is on vehicle %d", did, d.VehicleID)})
+			return
+		}
+		ds = append(ds, d)
+	}
+	if err := checkVehicleCapacity(h.Deliveries, v, ds...); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	m := &model.VehicleManifest{VehicleID: v.ID, SealedBy: c.GetUint("user_id"), SealedAt: time.Now()}
+	for _, d := range ds {
+		if d.VehicleID != v.ID {
+			d.VehicleID = v.ID
+			if err := h.Deliveries.UpdateDelivery(d); err != nil {
+				updateFailed(c, err)
+				return
+			}
+		}
+		m.DeliveryIDs = append(m.DeliveryIDs, d.ID)
+		m.WeightKg += d.WeightKg
+		m.VolumeM3 += d.VolumeM3()
+	}
+	if err := h.Vehicles.CreateManifest(m); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, d := range ds {
+		recordTimeline(h.Timeline, d.ID, m.SealedBy, "manifest.sealed",
+			fmt.Sprintf("Loaded onto %s", v.Plate), map[string]interface{}{"vehicle_id": v.ID, "manifest_id": m.ID})
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+// GET /api/vehicles/:id/manifests
+func (h *VehicleHandler) ListManifests(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	list, _ := h.Vehicles.ListManifests(uint(id))
+	c.JSON(http.StatusOK, list)
+}
+
+// CheckExpiries notifies dispatchers and admins about maintenance and
+// documents falling due within NoticeDays. Each reminder is sent once.
+// It returns the number of reminders sent.
+func (h *VehicleHandler) CheckExpiries() int {
+	now := time.Now()
+	if h.Now != nil {
+		now = h.Now()
+	}
+	days := h.NoticeDays
+	if days == 0 {
+		days = 14
+	}
+	horizon := now.AddDate(0, 0, days)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.notified == nil {
+		h.notified = map[string]bool{}
+	}
+	sent := 0
+	remind := func(v model.Vehicle, typ, item string, due time.Time) {
+		key := fmt.Sprintf("%d:%s:%s", v.ID, item, due.Format("2006-01-02"))
+		if due.IsZero() || due.After(horizon) || h.notified[key] {
+			return
+		}
+		h.notified[key] = true
+		sent++
+		verb := "is due on"
+		if due.Before(now) {
+			verb = "was due on"
+		}
+		n := model.Notification{
+			Type:    typ,
+			Message: fmt.Sprintf("Vehicle %s: %s %s %s", v.Plate, item, verb, due.Format("2006-01-02")),
+			Data:    map[string]interface{}{"vehicle_id": v.ID, "item": item, "due": due.Format("2006-01-02")},
+		}
+		notifyRole(h.Users, h.Notifications, "dispatcher", n)
+		notifyRole(h.Users, h.Notifications, "admin", n)
+	}
+	vehicles, _ := h.Vehicles.ListVehicles()
+	for _, v := range vehicles {
+		remind(v, "vehicle.maintenance_due", "maintenance", v.MaintenanceDue)
+		for _, doc := range v.Documents {
+			remind(v, "vehicle.document_expiring", doc.Type, doc.ExpiresAt)
+		}
+	}
+	return sent
+}
+
+// StartExpiryChecks runs CheckExpiries every interval until the process exits.
+func (h *VehicleHandler) StartExpiryChecks(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			h.CheckExpiries()
+		}
+	}()
+}
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVehicleCapacityOnAssignment(t *testing.T) {
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	vehicles := repo.NewInMemoryVehicleRepo()
+	vh := &VehicleHandler{Vehicles: vehicles, Deliveries: deliveries}
+	dh := &DeliveryHandler{Deliveries: deliveries, Vehicles: vehicles}
+	r := gin.Default()
+	api := r.Group("/api", JWTAuthMiddleware(testSecret), DispatcherOnly())
+	api.POST("/vehicles", vh.CreateVehicle)
+	api.GET("/vehicles/:id", vh.GetVehicle)
+	api.POST("/vehicles/:id/assignments", vh.AssignCourier)
+	api.POST("/deliveries/:id/assign", dh.AssignDelivery)
+	do := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		return serveJSON(r, method, path, makeDispatcherJWT(9), body)
+	}
+	assert.Equal(t, 200, do("POST", "/api/vehicles", map[string]interface{}{
+		"plate": "123ABC02", "type": "VAN", "max_weight_kg": 100, "max_volume_m3": 1}).Code)
+	assert.Equal(t, 409, do("POST", "/api/vehicles", map[string]interface{}{
+		"plate": "123ABC02", "type": "CAR", "max_weight_kg": 10, "max_volume_m3": 1}).Code)
+
+	shift := map[string]interface{}{"courier_id": 5, "starts_at": time.Now().Add(-time.Hour), "ends_at": time.Now().Add(8 * time.Hour)}
+	assert.Equal(t, 200, do("POST", "/api/vehicles/1/assignments", shift).Code)
+	shift["courier_id"] = 6
+	assert.Equal(t, 409, do("POST", "/api/vehicles/1/assignments", shift).Code)
+
+	for _, d := range []model.Delivery{
+		{WeightKg: 60, LengthCm: 50, WidthCm: 50, HeightCm: 50},
+		{WeightKg: 30, LengthCm: 100, WidthCm: 100, HeightCm: 50},
+		{WeightKg: 30},
+		{WeightKg: 1, Refrigerated: true},
+	} {
+		d.Status = "CREATED"
+		deliveries.CreateDelivery(&d)
+	}
+	assign := func(id int) *httptest.ResponseRecorder {
+		return do("POST", fmt.Sprintf("/api/deliveries/%d/assign", id), map[string]uint{"courier_id": 5})
+	}
+	assert.Equal(t, 200, assign(1).Code)
+	w := assign(2) // 0.125 + 0.5 m³ fits, 90 kg fits
+	assert.Equal(t, 200, w.Code)
+	w = assign(3) // 120 kg does not
+	assert.Equal(t, 422, w.Code)
+	assert.Contains(t, w.Body.String(), "120.0 kg")
+	w = assign(4)
+	assert.Equal(t, 422, w.Code)
+	assert.Contains(t, w.Body.String(), "refrigerated")
+
+	// Reassigning an already loaded delivery does not count it twice
+	assert.Equal(t, 200, assign(2).Code)
+	d, _ := deliveries.GetDelivery(2)
+	assert.Equal(t, uint(1), d.VehicleID)
+
+	var resp struct {
+		Load VehicleLoad `json:"load"`
+	}
+	json.Unmarshal(do("GET", "/api/vehicles/1", nil).Body.Bytes(), &resp)
+	assert.Equal(t, 2, resp.Load.Deliveries)
+	assert.InDelta(t, 90, resp.Load.WeightKg, 0.001)
+	assert.InDelta(t, 0.625, resp.Load.VolumeM3, 0.001)
+
+	// A cancelled delivery gives its room back
+	d, _ = deliveries.GetDelivery(1)
+	d.Status = "CANCELLED"
+	deliveries.UpdateDelivery(d)
+	assert.Equal(t, 200, assign(3).Code)
+}
+
+func TestVehicleExpiryReminders(t *testing.T) {
+	now := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	users := repo.NewInMemoryUserRepo()
+	users.CreateUser(&model.User{Email: "d@example.com", Role: "dispatcher"})
+	users.CreateUser(&model.User{Email: "c@example.com", Role: "courier"})
+	notifications := repo.NewInMemoryNotificationRepo()
+	vehicles := repo.NewInMemoryVehicleRepo()
+	vehicles.CreateVehicle(&model.Vehicle{
+		Plate:          "777AAA01",
+		MaintenanceDue: now.AddDate(0, 0, 10),
+		Documents: []model.VehicleDocument{
+			{Type: "INSURANCE", ExpiresAt: now.AddDate(0, 0, -1)},
+			{Type: "REGISTRATION", ExpiresAt: now.AddDate(1, 0, 0)},
+		},
+	})
+	h := &VehicleHandler{Vehicles: vehicles, Users: users,
+		Notifications: &NotificationHandler{Notifications: notifications}, Now: func() time.Time { return now }}
+	assert.Equal(t, 2, h.CheckExpiries())
+	assert.Equal(t, 0, h.CheckExpiries())
+	list, _ := users.ListUsers()
+	var dispatcherID uint
+	for _, u := range list {
+		if u.Role == "dispatcher" {
+			dispatcherID = u.ID
+		}
+	}
+	ns, _ := notifications.ListNotifications(uint64(dispatcherID))
+	assert.Len(t, ns, 2)
+}
+
+// slowListing widens the window between reading a vehicle's load and
+// storing a new one.
+type slowListing struct{ *repo.InMemoryDeliveryRepo }
+
+func (r slowListing) ListDeliveries() ([]model.Delivery, error) {
+	list, err := r.InMemoryDeliveryRepo.ListDeliveries()
+	time.Sleep(5 * time.Millisecond)
+	return list, err
+}
+
+func TestVehicleCapacityConcurrentAssignments(t *testing.T) {
+	deliveries := slowListing{repo.NewInMemoryDeliveryRepo()}
+	vehicles := repo.NewInMemoryVehicleRepo()
+	vehicles.CreateVehicle(&model.Vehicle{Plate: "1", MaxWeightKg: 100, MaxVolumeM3: 10})
+	dh := &DeliveryHandler{Deliveries: deliveries, Vehicles: vehicles}
+	for i := 0; i < 10; i++ {
+		deliveries.CreateDelivery(&model.Delivery{Status: "CREATED", WeightKg: 30})
+	}
+	var wg sync.WaitGroup
+	for id := uint(1); id <= 10; id++ {
+		wg.Add(1)
+		go func(id uint) {
+			defer wg.Done()
+			d, _ := deliveries.GetDelivery(id)
+			dh.assign(d, 5, 1, 9)
+		}(id)
+	}
+	wg.Wait()
+	assert.Equal(t, 3, vehicleLoad(deliveries, 1).Deliveries)
+}
+
+func TestVehicleManifestSealing(t *testing.T) {
+	deliveries := repo.NewInMemoryDeliveryRepo()
+	vehicles := repo.NewInMemoryVehicleRepo()
+	timeline := repo.NewInMemoryTimelineRepo()
+	vehicles.CreateVehicle(&model.Vehicle{Plate: "123ABC02", MaxWeightKg: 100, MaxVolumeM3: 1})
+	vehicles.CreateVehicle(&model.Vehicle{Plate: "456DEF02", MaxWeightKg: 100, MaxVolumeM3: 1})
+	vh := &VehicleHandler{Vehicles: vehicles, Deliveries: deliveries, Timeline: timeline}
+	r := gin.Default()
+	api := r.Group("/api", JWTAuthMiddleware(testSecret), DispatcherOnly())
+	api.POST("/vehicles/:id/manifests", vh.SealManifest)
+	api.GET("/vehicles/:id/manifests", vh.ListManifests)
+	seal := func(vehicleID int, ids ...uint) *httptest.ResponseRecorder {
+		return serveJSON(r, "POST", fmt.Sprintf("/api/vehicles/%d/manifests", vehicleID), makeDispatcherJWT(9), map[string][]uint{"delivery_ids": ids})
+	}
+	for _, d := range []model.Delivery{
+		{Status: "ASSIGNED", WeightKg: 40, VehicleID: 1},
+		{Status: "ASSIGNED", WeightKg: 40},
+		{Status: "ASSIGNED", WeightKg: 30},
+		{Status: "DELIVERED", WeightKg: 1},
+		{Status: "ASSIGNED", WeightKg: 1, Refrigerated: true},
+	} {
+		deliveries.CreateDelivery(&d)
+	}
+
+	// 40 kg on board plus 40 and 30 is over capacity; nothing is loaded
+	w := seal(1, 2, 3)
+	assert.Equal(t, 422, w.Code)
+	assert.Contains(t, w.Body.String(), "110.0 kg")
+	d, _ := deliveries.GetDelivery(2)
+	assert.Equal(t, uint(0), d.VehicleID)
+
+	// Re-sealing a parcel already on board does not count it twice
+	w = seal(1, 1, 2)
+	assert.Equal(t, 200, w.Code)
+	var m model.VehicleManifest
+	json.Unmarshal(w.Body.Bytes(), &m)
+	assert.Equal(t, []uint{1, 2}, m.DeliveryIDs)
+	assert.InDelta(t, 80, m.WeightKg, 0.001)
+	d, _ = deliveries.GetDelivery(2)
+	assert.Equal(t, uint(1), d.VehicleID)
+	events, _ := timeline.ListEvents(2)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "manifest.sealed", events[0].Type)
+	}
+
+	assert.Equal(t, 409, seal(2, 2).Code, "already on another vehicle")
+	assert.Equal(t, 409, seal(2, 4).Code, "delivered")
+	assert.Equal(t, 422, seal(2, 5).Code, "needs refrigeration")
+	assert.Equal(t, 400, seal(2, 99).Code)
+	assert.Equal(t, 404, seal(3, 3).Code)
+
+	var list []model.VehicleManifest
+	json.Unmarshal(serveJSON(r, "GET", "/api/vehicles/1/manifests", makeDispatcherJWT(9), nil).Body.Bytes(), &list)
+	assert.Len(t, list, 1)
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"deliverymanagement/internal/geo"
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"deliverymanagement/internal/serviceability"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ZoneHandler struct {
+	Zones repo.ZoneRepository
+}
+
+type zoneRequest struct {
+	Name          string          `json:"name" binding:"required"`
+	Hub           string          `json:"hub"`
+	CourierPool   []uint          `json:"courier_pool"`
+	ServiceLevels []string        `json:"service_levels"`
+	Geometry      json.RawMessage `json:"geometry" binding:"required"`
+}
+
+// parse validates the service levels and geometry of the request.
+func (req *zoneRequest) parse() ([]model.Polygon, error) {
+	for _, code := range req.ServiceLevels {
+		known := false
+		for _, l := range serviceability.Levels {
+			known = known || l.Code == code
+		}
+		if !known {
+			return nil, errors.New("unknown service level " + code)
+		}
+	}
+	return geo.ParseGeoJSON(req.Geometry)
+}
+
+// POST /api/admin/zones
+func (h *ZoneHandler) CreateZone(c *gin.Context) {
+	var req zoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	polys, err := req.parse()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	zone := &model.Zone{
+		Name:          req.Name,
+		Hub:           req.Hub,
+		CourierPool:   req.CourierPool,
+		ServiceLevels: req.ServiceLevels,
+		Polygons:      polys,
+		CreatedAt:     time.Now(),
+	}
+	if err := h.Zones.CreateZone(zone); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, zone)
+}
+
+// GET /api/admin/zones
+func (h *ZoneHandler) ListZones(c *gin.Context) {
+	zones, _ := h.Zones.ListZones()
+	c.JSON(http.StatusOK, zones)
+}
+
+// GET /api/admin/zones/:id
+func (h *ZoneHandler) GetZone(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	zone, err := h.Zones.GetZone(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.JSON(http.StatusOK, zone)
+}
+
+// PUT /api/admin/zones/:id
+func (h *ZoneHandler) UpdateZone(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	zone, err := h.Zones.GetZone(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	var req zoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		handleValidationError(c, err)
+		return
+	}
+	polys, err := req.parse()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	updated := *zone
+	updated.Name = req.Name
+	updated.Hub = req.Hub
+	updated.CourierPool = req.CourierPool
+	updated.ServiceLevels = req.ServiceLevels
+	updated.Polygons = polys
+	if err := h.Zones.UpdateZone(&updated); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// DELETE /api/admin/zones/:id
+func (h *ZoneHandler) DeleteZone(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := h.Zones.DeleteZone(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"bytes"
+	"deliverymanagement/internal/geo"
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const almatyZone = `{"name":"Almaty Center","hub":"ALA-3","courier_pool":[7,8],"geometry":{"type":"Polygon","coordinates":[[[76.8,43.2],[77.0,43.2],[77.0,43.3],[76.8,43.3],[76.8,43.2]]]}}`
+
+func TestZonesAndAutoZoning(t *testing.T) {
+	gz, _ := geo.LoadGazetteer(strings.NewReader("KZ,050000,Almaty,43.2389,76.8897\nKZ,010000,Astana,51.1282,71.4307\n"))
+	zones := repo.NewInMemoryZoneRepo()
+	users := repo.NewInMemoryUserRepo()
+	users.CreateUser(&model.User{Email: "d@x.com", Role: "dispatcher"})
+	notifications := repo.NewInMemoryNotificationRepo()
+	dh := &DeliveryHandler{
+		Deliveries:    repo.NewInMemoryDeliveryRepo(),
+		Geocoder:      gz,
+		Zones:         zones,
+		Users:         users,
+		Notifications: &NotificationHandler{Notifications: notifications},
+	}
+	zh := &ZoneHandler{Zones: zones}
+	r := gin.Default()
+	r.POST("/api/admin/zones", zh.CreateZone)
+	r.GET("/api/admin/zones", zh.ListZones)
+	r.POST("/api/deliveries", JWTAuthMiddleware(testSecret), dh.CreateDelivery)
+	r.GET("/api/deliveries", JWTAuthMiddleware(testSecret), dh.ListDeliveries)
+	r.GET("/export", dh.ExportDeliveries)
+
+	// Invalid geometry is rejected
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/admin/zones", bytes.NewBufferString(`{"name":"bad","geometry":{"type":"Point","coordinates":[1,2]}}`))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 400, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/admin/zones", bytes.NewBufferString(almatyZone))
+	r.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	var zone model.Zone
+	json.Unmarshal(w.Body.Bytes(), &zone)
+	assert.Equal(t, "ALA-3", zone.Hub)
+	assert.Equal(t, []uint{7, 8}, zone.CourierPool)
+
+	create := func(to string) model.Delivery {
+		b, _ := json.Marshal(map[string]string{"from_address": "Abay 1, Almaty, KZ", "to_address": to})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/deliveries", bytes.NewReader(b))
+		req.Header.Set("Authorization", "Bearer "+makeJWT(1))
+		r.ServeHTTP(w, req)
+		assert.Equal(t, 200, w.Code)
+		var d model.Delivery
+		json.Unmarshal(w.Body.Bytes(), &d)
+		return d
+	}
+	inside := create("Tole Bi 5, Almaty, 050000, KZ")
+	outside := create("Kenesary 2, Astana, 010000, KZ")
+	assert.Equal(t, zone.ID, inside.ZoneID)
+	assert.Equal(t, uint(0), outside.ZoneID)
+
+	// Dispatcher is told about the unzoned delivery only
+	ns, _ := notifications.ListNotifications(1)
+	assert.Len(t, ns, 1)
+	assert.Equal(t, "delivery.unzoned", ns[0].Type)
+
+	// Listing filters by zone
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/deliveries?zone_id=0", nil)
+	req.Header.Set("Authorization", "Bearer "+makeJWT(1))
+	r.ServeHTTP(w, req)
+	var listed []model.Delivery
+	json.Unmarshal(w.Body.Bytes(), &listed)
+	assert.Len(t, listed, 1)
+	assert.Equal(t, outside.ID, listed[0].ID)
+
+	// Export filters by zone and includes the column
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/export?format=csv&zone_id=1", nil)
+	r.ServeHTTP(w, req)
+	assert.Contains(t, w.Body.String(), "Status,ZoneID")
+	assert.Equal(t, 2, strings.Count(strings.TrimSpace(w.Body.String()), "\n")+1)
+}
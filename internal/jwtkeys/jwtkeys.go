@@ -0,0 +1,285 @@
+// Package jwtkeys signs and verifies the API's JWTs. Keys carry a kid, so
+// several can verify at once while the signing key is rotated, and every
+// key is bound to one algorithm.
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+// minSecret is the shortest HS256 secret accepted from configuration.
+const minSecret = 32
+
+// Config describes the keys, usually loaded from a JSON file:
+//
+//	{
+//	  "issuer": "deliverymanagement",
+//	  "audience": "deliverymanagement-api",
+//	  "signing_key": "2024-10",
+//	  "keys": [
+//	    {"kid": "2024-10", "alg": "EdDSA", "private_key_file": "/etc/jwt/2024-10.pem"},
+//	    {"kid": "2024-04", "alg": "RS256", "public_key_file": "/etc/jwt/2024-04.pub.pem"}
+//	  ]
+//	}
+type Config struct {
+	// Issuer and Audience are set on new tokens and required on verified
+	// ones; empty values are neither set nor checked.
+	Issuer   string `json:"issuer"`
+	Audience string `json:"audience"`
+	// SigningKey is the kid new tokens are signed with; the first key
+	// when empty.
+	SigningKey string      `json:"signing_key"`
+	Keys       []KeyConfig `json:"keys"`
+}
+
+// KeyConfig is one key. HS256 keys take a shared secret. RS256 and EdDSA
+// keys take a PEM private key, which signs and verifies, or only a public
+// key, which verifies tokens signed before a rotation. Key material is
+// given inline or as a file.
+type KeyConfig struct {
+	ID             string `json:"kid"`
+	Alg            string `json:"alg"`
+	Secret         string `json:"secret"`
+	SecretFile     string `json:"secret_file"`
+	PrivateKey     string `json:"private_key"`
+	PrivateKeyFile string `json:"private_key_file"`
+	PublicKey      string `json:"public_key"`
+	PublicKeyFile  string `json:"public_key_file"`
+}
+
+type key struct {
+	id     string
+	method jwt.SigningMethod
+	sign   interface{} // nil for verification-only keys
+	verify interface{}
+}
+
+// Manager holds the signing key and every key accepted for verification.
+type Manager struct {
+	issuer   string
+	audience string
+	signing  *key
+	keys     map[string]*key
+	methods  []string
+}
+
+// LoadFile reads a JSON Config from path.
+func LoadFile(path string) (*Manager, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("jwt keys %s: %w", path, err)
+	}
+	return New(cfg)
+}
+
+func New(cfg Config) (*Manager, error) {
+	if len(cfg.Keys) == 0 {
+		return nil, errors.New("jwt keys: no keys configured")
+	}
+	m := &Manager{issuer: cfg.Issuer, audience: cfg.Audience, keys: make(map[string]*key)}
+	seenAlg := make(map[string]bool)
+	for _, kc := range cfg.Keys {
+		k, err := loadKey(kc)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %w", kc.ID, err)
+		}
+		if _, dup := m.keys[k.id]; dup {
+			return nil, fmt.Errorf("jwt key %q: duplicate kid", k.id)
+		}
+		m.keys[k.id] = k
+		if !seenAlg[kc.Alg] {
+			seenAlg[kc.Alg] = true
+			m.methods = append(m.methods, kc.Alg)
+		}
+	}
+	signing := cfg.SigningKey
+	if signing == "" {
+		signing = cfg.Keys[0].ID
+	}
+	m.signing = m.keys[signing]
+	if m.signing == nil {
+		return nil, fmt.Errorf("jwt keys: signing key %q not configured", signing)
+	}
+	if m.signing.sign == nil {
+		return nil, fmt.Errorf("jwt keys: signing key %q has no private key", signing)
+	}
+	return m, nil
+}
+
+// NewHS256 is a manager with a single HS256 key and no kid, issuer or
+// audience, for tests and tools that share a plain secret.
+func NewHS256(secret []byte) *Manager {
+	k := &key{method: jwt.SigningMethodHS256, sign: secret, verify: secret}
+	return &Manager{signing: k, keys: map[string]*key{"": k}, methods: []string{HS256}}
+}
+
+func loadKey(kc KeyConfig) (*key, error) {
+	if kc.ID == "" {
+		return nil, errors.New("kid is required")
+	}
+	k := &key{id: kc.ID}
+	switch kc.Alg {
+	case HS256:
+		secret, err := material(kc.Secret, kc.SecretFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(secret) < minSecret {
+			return nil, fmt.Errorf("HS256 secret must be at least %d bytes", minSecret)
+		}
+		k.method, k.sign, k.verify = jwt.SigningMethodHS256, secret, secret
+	case RS256:
+		k.method = jwt.SigningMethodRS256
+		priv, pub, err := pemPair(kc)
+		if err != nil {
+			return nil, err
+		}
+		if priv != nil {
+			rk, err := jwt.ParseRSAPrivateKeyFromPEM(priv)
+			if err != nil {
+				return nil, err
+			}
+			k.sign, k.verify = rk, &rk.PublicKey
+		} else if k.verify, err = jwt.ParseRSAPublicKeyFromPEM(pub); err != nil {
+			return nil, err
+		}
+	case EdDSA:
+		k.method = jwt.SigningMethodEdDSA
+		priv, pub, err := pemPair(kc)
+		if err != nil {
+			return nil, err
+		}
+		if priv != nil {
+			ek, err := jwt.ParseEdPrivateKeyFromPEM(priv)
+			if err != nil {
+				return nil, err
+			}
+			k.sign, k.verify = ek, ek.(ed25519.PrivateKey).Public()
+		} else if k.verify, err = jwt.ParseEdPublicKeyFromPEM(pub); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported alg %q", kc.Alg)
+	}
+	return k, nil
+}
+
+// pemPair returns the private key PEM, or else the public key PEM.
+func pemPair(kc KeyConfig) (priv, pub []byte, err error) {
+	if kc.PrivateKey != "" || kc.PrivateKeyFile != "" {
+		priv, err = material(kc.PrivateKey, kc.PrivateKeyFile)
+		return priv, nil, err
+	}
+	pub, err = material(kc.PublicKey, kc.PublicKeyFile)
+	return nil, pub, err
+}
+
+func material(inline, file string) ([]byte, error) {
+	if inline != "" {
+		return []byte(inline), nil
+	}
+	if file == "" {
+		return nil, errors.New("no key material")
+	}
+	return os.ReadFile(file)
+}
+
+// Sign signs claims with the signing key, adding its kid and the issuer
+// and audience.
+func (m *Manager) Sign(claims jwt.MapClaims) (string, error) {
+	if m.issuer != "" {
+		claims["iss"] = m.issuer
+	}
+	if m.audience != "" {
+		claims["aud"] = m.audience
+	}
+	t := jwt.NewWithClaims(m.signing.method, claims)
+	if m.signing.id != "" {
+		t.Header["kid"] = m.signing.id
+	}
+	return t.SignedString(m.signing.sign)
+}
+
+// Parse verifies a token and returns its claims. The token's kid picks the
+// key and must use that key's algorithm; expiry is required, and the
+// issuer and audience are checked when configured.
+func (m *Manager) Parse(token string) (jwt.MapClaims, error) {
+	opts := []jwt.ParserOption{jwt.WithValidMethods(m.methods), jwt.WithExpirationRequired()}
+	if m.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(m.issuer))
+	}
+	if m.audience != "" {
+		opts = append(opts, jwt.WithAudience(m.audience))
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, m.keyFor, opts...); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (m *Manager) keyFor(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	k := m.keys[kid]
+	if k == nil {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if t.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("kid %q does not use %s", kid, t.Method.Alg())
+	}
+	return k.verify, nil
+}
+
+// JWK is a public key in JSON Web Key form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public keys, for other services verifying our tokens.
+// HS256 secrets are never published.
+func (m *Manager) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	b64 := base64.RawURLEncoding.EncodeToString
+	for _, k := range m.keys {
+		switch pub := k.verify.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{Kty: "RSA", Kid: k.id, Use: "sig", Alg: RS256,
+				N: b64(pub.N.Bytes()), E: b64(big.NewInt(int64(pub.E)).Bytes())})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{Kty: "OKP", Kid: k.id, Use: "sig", Alg: EdDSA, Crv: "Ed25519", X: b64(pub)})
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
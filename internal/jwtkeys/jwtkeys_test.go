@@ -0,0 +1,207 @@
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+var hsSecret = strings.Repeat("s", 32)
+
+func rsaPEM(t *testing.T) (priv, pub string) {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, _ := x509.MarshalPKIXPublicKey(&k.PublicKey)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+}
+
+func edPEM(t *testing.T) (priv, pub string) {
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skDER, _ := x509.MarshalPKCS8PrivateKey(sk)
+	pkDER, _ := x509.MarshalPKIXPublicKey(pk)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: skDER})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkDER}))
+}
+
+func claims() jwt.MapClaims {
+	return jwt.MapClaims{"user_id": 1, "exp": time.Now().Add(time.Minute).Unix()}
+}
+
+func TestSignAndParse(t *testing.T) {
+	rsaPriv, _ := rsaPEM(t)
+	edPriv, _ := edPEM(t)
+	for _, kc := range []KeyConfig{
+		{ID: "h", Alg: HS256, Secret: hsSecret},
+		{ID: "r", Alg: RS256, PrivateKey: rsaPriv},
+		{ID: "e", Alg: EdDSA, PrivateKey: edPriv},
+	} {
+		m, err := New(Config{Issuer: "dm", Audience: "api", Keys: []KeyConfig{kc}})
+		if !assert.NoError(t, err, kc.Alg) {
+			continue
+		}
+		token, err := m.Sign(claims())
+		assert.NoError(t, err)
+		parsed, _, _ := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+		assert.Equal(t, kc.ID, parsed.Header["kid"])
+		assert.Equal(t, kc.Alg, parsed.Method.Alg())
+		got, err := m.Parse(token)
+		if !assert.NoError(t, err, kc.Alg) {
+			continue
+		}
+		assert.Equal(t, "dm", got["iss"])
+		assert.Equal(t, float64(1), got["user_id"])
+	}
+}
+
+func TestRotation(t *testing.T) {
+	oldPriv, oldPub := rsaPEM(t)
+	newPriv, _ := edPEM(t)
+	old, err := New(Config{Keys: []KeyConfig{{ID: "2024-04", Alg: RS256, PrivateKey: oldPriv}}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	oldToken, _ := old.Sign(claims())
+
+	// The new key signs; the old one only verifies what is still out there.
+	m, err := New(Config{SigningKey: "2024-10", Keys: []KeyConfig{
+		{ID: "2024-10", Alg: EdDSA, PrivateKey: newPriv},
+		{ID: "2024-04", Alg: RS256, PublicKey: oldPub},
+	}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = m.Parse(oldToken)
+	assert.NoError(t, err)
+	newToken, _ := m.Sign(claims())
+	parsed, _, _ := jwt.NewParser().ParseUnverified(newToken, jwt.MapClaims{})
+	assert.Equal(t, "2024-10", parsed.Header["kid"])
+	_, err = m.Parse(newToken)
+	assert.NoError(t, err)
+
+	_, err = New(Config{SigningKey: "2024-04", Keys: []KeyConfig{{ID: "2024-04", Alg: RS256, PublicKey: oldPub}}})
+	assert.Error(t, err, "a public key cannot sign")
+}
+
+func TestParseRejects(t *testing.T) {
+	rsaPriv, rsaPub := rsaPEM(t)
+	m, err := New(Config{Issuer: "dm", Audience: "api", Keys: []KeyConfig{
+		{ID: "r", Alg: RS256, PrivateKey: rsaPriv},
+		{ID: "h", Alg: HS256, Secret: hsSecret},
+	}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	sign := func(method jwt.SigningMethod, kid string, key interface{}, c jwt.MapClaims) string {
+		tok := jwt.NewWithClaims(method, c)
+		if kid != "" {
+			tok.Header["kid"] = kid
+		}
+		s, err := tok.SignedString(key)
+		assert.NoError(t, err)
+		return s
+	}
+	withIssAud := func(iss, aud string) jwt.MapClaims {
+		c := claims()
+		c["iss"], c["aud"] = iss, aud
+		return c
+	}
+
+	valid := sign(jwt.SigningMethodHS256, "h", []byte(hsSecret), withIssAud("dm", "api"))
+	_, err = m.Parse(valid)
+	assert.NoError(t, err)
+
+	cases := map[string]string{
+		// The RSA public key used as an HMAC secret under the RSA kid.
+		"alg confusion": sign(jwt.SigningMethodHS256, "r", []byte(rsaPub), withIssAud("dm", "api")),
+		"none":          sign(jwt.SigningMethodNone, "h", jwt.UnsafeAllowNoneSignatureType, withIssAud("dm", "api")),
+		"unknown kid":   sign(jwt.SigningMethodHS256, "x", []byte(hsSecret), withIssAud("dm", "api")),
+		"no kid":        sign(jwt.SigningMethodHS256, "", []byte(hsSecret), withIssAud("dm", "api")),
+		"wrong issuer":  sign(jwt.SigningMethodHS256, "h", []byte(hsSecret), withIssAud("other", "api")),
+		"wrong aud":     sign(jwt.SigningMethodHS256, "h", []byte(hsSecret), withIssAud("dm", "other")),
+		"no exp":        sign(jwt.SigningMethodHS256, "h", []byte(hsSecret), jwt.MapClaims{"iss": "dm", "aud": "api"}),
+		"wrong secret":  sign(jwt.SigningMethodHS256, "h", []byte(strings.Repeat("x", 32)), withIssAud("dm", "api")),
+	}
+	for name, token := range cases {
+		_, err := m.Parse(token)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	for name, cfg := range map[string]Config{
+		"no keys":        {},
+		"short secret":   {Keys: []KeyConfig{{ID: "h", Alg: HS256, Secret: "supersecret"}}},
+		"no kid":         {Keys: []KeyConfig{{Alg: HS256, Secret: hsSecret}}},
+		"bad alg":        {Keys: []KeyConfig{{ID: "h", Alg: "HS512", Secret: hsSecret}}},
+		"duplicate kid":  {Keys: []KeyConfig{{ID: "h", Alg: HS256, Secret: hsSecret}, {ID: "h", Alg: HS256, Secret: hsSecret}}},
+		"missing pem":    {Keys: []KeyConfig{{ID: "r", Alg: RS256}}},
+		"unknown signer": {SigningKey: "x", Keys: []KeyConfig{{ID: "h", Alg: HS256, Secret: hsSecret}}},
+	} {
+		_, err := New(cfg)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestLoadFileAndJWKS(t *testing.T) {
+	dir := t.TempDir()
+	rsaPriv, _ := rsaPEM(t)
+	edPriv, edPub := edPEM(t)
+	os.WriteFile(filepath.Join(dir, "r.pem"), []byte(rsaPriv), 0o600)
+	os.WriteFile(filepath.Join(dir, "e.pub.pem"), []byte(edPub), 0o600)
+	os.WriteFile(filepath.Join(dir, "h.secret"), []byte(hsSecret), 0o600)
+	cfg := `{"issuer": "dm", "signing_key": "r", "keys": [
+		{"kid": "r", "alg": "RS256", "private_key_file": "` + filepath.Join(dir, "r.pem") + `"},
+		{"kid": "e", "alg": "EdDSA", "public_key_file": "` + filepath.Join(dir, "e.pub.pem") + `"},
+		{"kid": "h", "alg": "HS256", "secret_file": "` + filepath.Join(dir, "h.secret") + `"}
+	]}`
+	path := filepath.Join(dir, "keys.json")
+	os.WriteFile(path, []byte(cfg), 0o600)
+
+	m, err := LoadFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	token, err := m.Sign(claims())
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = m.Parse(token)
+	assert.NoError(t, err)
+
+	set := m.JWKS()
+	if !assert.Len(t, set.Keys, 2, "HS256 secrets are not published") {
+		return
+	}
+	assert.Equal(t, JWK{Kty: "OKP", Kid: "e", Use: "sig", Alg: EdDSA, Crv: "Ed25519", X: set.Keys[0].X}, set.Keys[0])
+	assert.Equal(t, "RSA", set.Keys[1].Kty)
+	assert.Equal(t, "AQAB", set.Keys[1].E)
+	assert.NotEmpty(t, set.Keys[1].N)
+
+	// The published EdDSA key verifies tokens signed by its private half.
+	signer, err := New(Config{Issuer: "dm", Keys: []KeyConfig{{ID: "e", Alg: EdDSA, PrivateKey: edPriv}}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	token, _ = signer.Sign(claims())
+	_, err = m.Parse(token)
+	assert.NoError(t, err)
+
+	_, err = LoadFile(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,175 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// EXIF tags needed to find the GPS position and orientation.
+const (
+	tagOrientation   = 0x0112
+	tagGPSIFD        = 0x8825
+	tagGPSLatRef     = 1
+	tagGPSLat        = 2
+	tagGPSLonRef     = 3
+	tagGPSLon        = 4
+	exifTypeASCII    = 2
+	exifTypeShort    = 3
+	exifTypeRational = 5
+)
+
+// exifPayload returns the TIFF-structured EXIF block of a JPEG or PNG.
+func exifPayload(data []byte, format string) []byte {
+	switch format {
+	case "jpeg":
+		return jpegExif(data)
+	case "png":
+		return pngExif(data)
+	}
+	return nil
+}
+
+// extractGPS reads the GPS position from the EXIF block of a JPEG or PNG.
+// Anything it cannot parse is treated as no position.
+func extractGPS(data []byte, format string) *GPS {
+	tiff := exifPayload(data, format)
+	if tiff == nil {
+		return nil
+	}
+	return parseGPS(tiff)
+}
+
+// extractOrientation reads the EXIF Orientation tag, 1 to 8, of a JPEG or
+// PNG. Images without a valid one are upright, 1.
+func extractOrientation(data []byte, format string) int {
+	t := exifPayload(data, format)
+	bo := tiffByteOrder(t)
+	if bo == nil {
+		return 1
+	}
+	e, ok := readIFD(t, bo, bo.Uint32(t[4:]))[tagOrientation]
+	if !ok || e.typ != exifTypeShort || e.count != 1 {
+		return 1
+	}
+	if o := int(bo.Uint16(e.value)); o >= 1 && o <= 8 {
+		return o
+	}
+	return 1
+}
+
+// tiffByteOrder reads the byte order of a TIFF header, nil when t is not one.
+func tiffByteOrder(t []byte) binary.ByteOrder {
+	if len(t) < 8 {
+		return nil
+	}
+	switch string(t[:2]) {
+	case "II":
+		return binary.LittleEndian
+	case "MM":
+		return binary.BigEndian
+	}
+	return nil
+}
+
+// jpegExif returns the TIFF payload of the APP1 Exif segment.
+func jpegExif(data []byte) []byte {
+	for i := 2; i+4 <= len(data); {
+		marker := data[i+1]
+		if data[i] != 0xFF || marker == 0xDA || marker == 0xD9 {
+			return nil // image data starts, no metadata after this
+		}
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		if n < 2 || i+2+n > len(data) {
+			return nil
+		}
+		seg := data[i+4 : i+2+n]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return seg[6:]
+		}
+		i += 2 + n
+	}
+	return nil
+}
+
+// pngExif returns the payload of the eXIf chunk.
+func pngExif(data []byte) []byte {
+	for i := 8; i+12 <= len(data); {
+		n := int(binary.BigEndian.Uint32(data[i:]))
+		if n < 0 || i+12+n > len(data) {
+			return nil
+		}
+		if string(data[i+4:i+8]) == "eXIf" {
+			return data[i+8 : i+8+n]
+		}
+		i += 12 + n
+	}
+	return nil
+}
+
+type ifdEntry struct {
+	typ   uint16
+	count uint32
+	value []byte // the 4-byte value or offset field
+}
+
+func parseGPS(t []byte) *GPS {
+	bo := tiffByteOrder(t)
+	if bo == nil {
+		return nil
+	}
+	ifd0 := readIFD(t, bo, bo.Uint32(t[4:]))
+	ptr, ok := ifd0[tagGPSIFD]
+	if !ok {
+		return nil
+	}
+	gps := readIFD(t, bo, bo.Uint32(ptr.value))
+	lat, okLat := degrees(t, bo, gps[tagGPSLat])
+	lon, okLon := degrees(t, bo, gps[tagGPSLon])
+	if !okLat || !okLon {
+		return nil
+	}
+	if ref := gps[tagGPSLatRef]; ref.typ == exifTypeASCII && ref.value[0] == 'S' {
+		lat = -lat
+	}
+	if ref := gps[tagGPSLonRef]; ref.typ == exifTypeASCII && ref.value[0] == 'W' {
+		lon = -lon
+	}
+	return &GPS{Lat: lat, Lon: lon}
+}
+
+func readIFD(t []byte, bo binary.ByteOrder, off uint32) map[uint16]ifdEntry {
+	if uint64(off)+2 > uint64(len(t)) {
+		return nil
+	}
+	n := int(bo.Uint16(t[off:]))
+	entries := make(map[uint16]ifdEntry, n)
+	for i := 0; i < n; i++ {
+		p := uint64(off) + 2 + uint64(i)*12
+		if p+12 > uint64(len(t)) {
+			break
+		}
+		e := t[p : p+12]
+		entries[bo.Uint16(e)] = ifdEntry{typ: bo.Uint16(e[2:]), count: bo.Uint32(e[4:]), value: e[8:12]}
+	}
+	return entries
+}
+
+// degrees converts a degrees/minutes/seconds triple of rationals.
+func degrees(t []byte, bo binary.ByteOrder, e ifdEntry) (float64, bool) {
+	if e.typ != exifTypeRational || e.count != 3 {
+		return 0, false
+	}
+	off := uint64(bo.Uint32(e.value))
+	if off+24 > uint64(len(t)) {
+		return 0, false
+	}
+	var parts [3]float64
+	for i := range parts {
+		num, den := bo.Uint32(t[off+uint64(i)*8:]), bo.Uint32(t[off+uint64(i)*8+4:])
+		if den == 0 {
+			return 0, false
+		}
+		parts[i] = float64(num) / float64(den)
+	}
+	return parts[0] + parts[1]/60 + parts[2]/3600, true
+}
@@ -0,0 +1,123 @@
+// Package media verifies uploaded files and prepares them for storage.
+// Images are decoded in full, turned upright, stripped of their metadata by
+// re-encoding and scaled down into preview variants.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+)
+
+// MaxPixels bounds the decoded size of an image, so a small file cannot
+// expand into gigabytes of pixels.
+const MaxPixels = 40_000_000
+
+// ErrInvalid wraps every reason an upload is refused.
+var ErrInvalid = errors.New("invalid file")
+
+// Variant is a scaled-down copy of an image, at most Max pixels on its
+// longer side.
+type Variant struct {
+	Name string
+	Max  int
+}
+
+// Variants are generated for every image, in addition to the original.
+var Variants = []Variant{{"thumb", 200}, {"medium", 1024}}
+
+// GPS is the position recorded in a photo's EXIF metadata.
+type GPS struct {
+	Lat float64
+	Lon float64
+}
+
+// File is a verified upload, ready to be stored.
+type File struct {
+	Mime string
+	Ext  string
+	// Data is the re-encoded image without metadata, or the PDF as uploaded.
+	Data []byte
+	// Variants holds the encoded variants by name; empty for documents.
+	Variants map[string][]byte
+	// GPS is the position the photo was taken at, if it recorded one.
+	GPS *GPS
+}
+
+// Process checks that data is a JPEG, PNG or PDF by its content rather than
+// its name and prepares it for storage.
+func Process(data []byte) (*File, error) {
+	switch mime := http.DetectContentType(data); mime {
+	case "image/jpeg", "image/png":
+		return processImage(data, mime)
+	case "application/pdf":
+		return processPDF(data)
+	default:
+		return nil, fmt.Errorf("%w: unsupported content type %s", ErrInvalid, mime)
+	}
+}
+
+func processImage(data []byte, mime string) (*File, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if "image/"+format != mime {
+		return nil, fmt.Errorf("%w: %s content in a %s file", ErrInvalid, format, mime)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+		return nil, fmt.Errorf("%w: image is %dx%d pixels", ErrInvalid, cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	// Re-encoding drops the Orientation tag, so apply it to the pixels.
+	img = orient(img, extractOrientation(data, format))
+	f := &File{Mime: mime, Variants: make(map[string][]byte, len(Variants)), GPS: extractGPS(data, format)}
+	encode := encodeJPEG
+	f.Ext = ".jpg"
+	if format == "png" {
+		encode = png.Encode
+		f.Ext = ".png"
+	}
+	if f.Data, err = encodeBytes(encode, img); err != nil {
+		return nil, err
+	}
+	for _, v := range Variants {
+		if f.Variants[v.Name], err = encodeBytes(encode, fit(img, v.Max)); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// processPDF checks the header and trailer of a PDF. Documents are stored as
+// uploaded.
+func processPDF(data []byte) (*File, error) {
+	tail := data
+	if len(tail) > 1024 {
+		tail = tail[len(tail)-1024:]
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-")) || !bytes.Contains(tail, []byte("%%EOF")) {
+		return nil, fmt.Errorf("%w: truncated or malformed PDF", ErrInvalid)
+	}
+	return &File{Mime: "application/pdf", Ext: ".pdf", Data: data}, nil
+}
+
+func encodeJPEG(w io.Writer, img image.Image) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: 90})
+}
+
+func encodeBytes(encode func(io.Writer, image.Image) error, img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
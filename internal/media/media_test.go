@@ -0,0 +1,160 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	return img
+}
+
+// withGPS inserts an Exif segment placing the photo at 43°15'N 76°54'E.
+func withGPS(jpg []byte) []byte {
+	bo := binary.BigEndian
+	var t bytes.Buffer
+	t.WriteString("MM\x00\x2a")
+	binary.Write(&t, bo, uint32(8))
+	// IFD0 at 8: one entry pointing at the GPS IFD at 26
+	binary.Write(&t, bo, uint16(1))
+	binary.Write(&t, bo, []uint16{tagGPSIFD, 4})
+	binary.Write(&t, bo, []uint32{1, 26})
+	binary.Write(&t, bo, uint32(0))
+	// GPS IFD at 26: four entries, rationals follow at 26+2+48+4 = 80
+	binary.Write(&t, bo, uint16(4))
+	binary.Write(&t, bo, []uint16{tagGPSLatRef, exifTypeASCII})
+	binary.Write(&t, bo, uint32(2))
+	t.WriteString("N\x00\x00\x00")
+	binary.Write(&t, bo, []uint16{tagGPSLat, exifTypeRational})
+	binary.Write(&t, bo, []uint32{3, 80})
+	binary.Write(&t, bo, []uint16{tagGPSLonRef, exifTypeASCII})
+	binary.Write(&t, bo, uint32(2))
+	t.WriteString("E\x00\x00\x00")
+	binary.Write(&t, bo, []uint16{tagGPSLon, exifTypeRational})
+	binary.Write(&t, bo, []uint32{3, 104})
+	binary.Write(&t, bo, uint32(0))
+	binary.Write(&t, bo, []uint32{43, 1, 15, 1, 0, 1})
+	binary.Write(&t, bo, []uint32{76, 1, 54, 1, 0, 1})
+	return withExif(jpg, t.Bytes())
+}
+
+// withOrientation inserts an Exif segment holding only the Orientation tag.
+func withOrientation(jpg []byte, o uint16) []byte {
+	bo := binary.LittleEndian
+	var t bytes.Buffer
+	t.WriteString("II\x2a\x00")
+	binary.Write(&t, bo, uint32(8))
+	binary.Write(&t, bo, uint16(1))
+	binary.Write(&t, bo, []uint16{tagOrientation, exifTypeShort})
+	binary.Write(&t, bo, uint32(1))
+	binary.Write(&t, bo, []uint16{o, 0})
+	binary.Write(&t, bo, uint32(0))
+	return withExif(jpg, t.Bytes())
+}
+
+// withExif inserts an APP1 Exif segment right after the JPEG SOI marker.
+func withExif(jpg, tiff []byte) []byte {
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	var out bytes.Buffer
+	out.Write(jpg[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(seg)+2))
+	out.Write(seg)
+	out.Write(jpg[2:])
+	return out.Bytes()
+}
+
+func TestProcessJPEGStripsGPSAndBuildsVariants(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, testImage(1600, 800), nil)
+	data := withGPS(buf.Bytes())
+	assert.True(t, bytes.Contains(data, []byte("Exif")))
+
+	f, err := Process(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "image/jpeg", f.Mime)
+	assert.Equal(t, ".jpg", f.Ext)
+	if assert.NotNil(t, f.GPS) {
+		assert.InDelta(t, 43.25, f.GPS.Lat, 1e-9)
+		assert.InDelta(t, 76.9, f.GPS.Lon, 1e-9)
+	}
+	assert.False(t, bytes.Contains(f.Data, []byte("Exif")))
+	clean, err := Process(f.Data)
+	assert.NoError(t, err)
+	assert.Nil(t, clean.GPS)
+
+	for name, want := range map[string]image.Point{"thumb": {200, 100}, "medium": {1024, 512}} {
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(f.Variants[name]))
+		assert.NoError(t, err)
+		assert.Equal(t, want, image.Point{cfg.Width, cfg.Height}, name)
+	}
+}
+
+func TestProcessJPEGAppliesOrientation(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, testImage(40, 20), &jpeg.Options{Quality: 100})
+	for o, want := range map[uint16]struct {
+		size      image.Point
+		topLeftAt image.Point // source pixel that ends up top left
+	}{
+		1: {image.Point{40, 20}, image.Point{0, 0}},
+		3: {image.Point{40, 20}, image.Point{39, 19}},
+		6: {image.Point{20, 40}, image.Point{0, 19}},
+		8: {image.Point{20, 40}, image.Point{39, 0}},
+	} {
+		f, err := Process(withOrientation(buf.Bytes(), o))
+		if !assert.NoError(t, err) {
+			continue
+		}
+		img, _ := jpeg.Decode(bytes.NewReader(f.Data))
+		assert.Equal(t, want.size, img.Bounds().Size(), "orientation %d", o)
+		r, g, _, _ := img.At(0, 0).RGBA()
+		assert.InDelta(t, want.topLeftAt.X, int(r>>8), 4, "orientation %d", o)
+		assert.InDelta(t, want.topLeftAt.Y, int(g>>8), 4, "orientation %d", o)
+	}
+}
+
+func TestProcessPNGKeepsSmallImages(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, testImage(50, 120))
+	f, err := Process(buf.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, ".png", f.Ext)
+	cfg, _ := png.DecodeConfig(bytes.NewReader(f.Variants["thumb"]))
+	assert.Equal(t, 50, cfg.Width)
+	assert.Nil(t, f.GPS)
+}
+
+func TestProcessRejectsInvalidContent(t *testing.T) {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, testImage(64, 64), nil)
+	valid := buf.Bytes()
+
+	for name, data := range map[string][]byte{
+		"text":           []byte("just some text"),
+		"truncated jpeg": valid[:len(valid)/2],
+		"html":           []byte("<html><body>hi</body></html>"),
+		"truncated pdf":  []byte("%PDF-1.4\n1 0 obj\n"),
+	} {
+		_, err := Process(data)
+		assert.ErrorIs(t, err, ErrInvalid, name)
+	}
+
+	f, err := Process([]byte("%PDF-1.4\n1 0 obj\n<<>>\nendobj\ntrailer\n<<>>\n%%EOF\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "application/pdf", f.Mime)
+	assert.Empty(t, f.Variants)
+}
@@ -0,0 +1,94 @@
+package media
+
+import (
+	"image"
+	"image/draw"
+)
+
+// fit scales img down so neither side exceeds max, averaging the source
+// pixels under each target pixel. Smaller images are returned as they are.
+func fit(img image.Image, max int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= max && h <= max {
+		return img
+	}
+	nw, nh := max, h*max/w
+	if h > w {
+		nw, nh = w*max/h, max
+	}
+	nw, nh = atLeast(nw, 1), atLeast(nh, 1)
+
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, nw, nh))
+	for y := 0; y < nh; y++ {
+		y0, y1 := y*h/nh, atLeast((y+1)*h/nh, y*h/nh+1)
+		for x := 0; x < nw; x++ {
+			x0, x1 := x*w/nw, atLeast((x+1)*w/nw, x*w/nw+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			o := y*dst.Stride + x*4
+			for i := range sum {
+				dst.Pix[o+i] = uint8(sum[i] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// orient turns img upright according to its EXIF Orientation, which
+// cameras set instead of rotating the pixels.
+func orient(img image.Image, o int) image.Image {
+	if o <= 1 || o > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w // the rotated orientations swap the sides
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch o {
+			case 2: // mirror horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotate 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirror vertically
+				sx, sy = x, h-1-y
+			case 5: // transpose
+				sx, sy = y, x
+			case 6: // rotate 90° clockwise
+				sx, sy = y, h-1-x
+			case 7: // transverse
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotate 90° counter-clockwise
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], src.Pix[sy*src.Stride+sx*4:])
+		}
+	}
+	return dst
+}
+
+func atLeast(v, min int) int {
+	if v < min {
+		return min
+	}
+	return v
+}
@@ -0,0 +1,26 @@
+package model
+
+import "strings"
+
+type Address struct {
+	Street     string
+	Building   string
+	City       string
+	PostalCode string
+	Country    string // ISO 3166-1 alpha-2
+	Lat        float64
+	Lng        float64
+	Geocoded   bool // coordinates were resolved by a geocoder
+}
+
+// String formats the address on a single line, e.g. "Abay Ave 10, Almaty, 050000, KZ".
+func (a Address) String() string {
+	street := strings.TrimSpace(a.Street + " " + a.Building)
+	parts := make([]string, 0, 4)
+	for _, p := range []string{street, a.City, a.PostalCode, a.Country} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
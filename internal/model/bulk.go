@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// BulkItemResult is the outcome of a bulk operation for one delivery.
+type BulkItemResult struct {
+	DeliveryID uint   `json:"delivery_id"`
+	OK         bool   `json:"ok"`
+	Error      string `json:"error,omitempty"`
+}
+
+// BulkJob tracks a bulk operation that runs in the background.
+type BulkJob struct {
+	ID         string           `json:"job_id"`
+	Action     string           `json:"action"`
+	Status     string           `json:"status"` // RUNNING or DONE
+	Total      int              `json:"total"`
+	Succeeded  int              `json:"succeeded"`
+	Failed     int              `json:"failed"`
+	Results    []BulkItemResult `json:"results"`
+	CreatedBy  uint             `json:"created_by"`
+	CreatedAt  time.Time        `json:"created_at"`
+	FinishedAt time.Time        `json:"finished_at"`
+}
@@ -0,0 +1,54 @@
+package model
+
+import "time"
+
+const (
+	ClaimSubmitted   = "SUBMITTED"
+	ClaimUnderReview = "UNDER_REVIEW"
+	ClaimApproved    = "APPROVED"
+	ClaimRejected    = "REJECTED"
+	ClaimPaid        = "PAID"
+)
+
+// EvidenceRequest asks the reporter for more information on a claim.
+type EvidenceRequest struct {
+	Message     string
+	RequestedBy uint
+	RequestedAt time.Time
+	Response    string
+	RespondedAt time.Time
+}
+
+// DamageClaim is the compensation claim raised with a damage report.
+// Amounts are in minor units of Currency.
+type DamageClaim struct {
+	ID               uint
+	ReportID         uint
+	DeliveryID       uint
+	ClientID         uint
+	ReporterID       uint
+	Status           string
+	ClaimedAmount    int64 // never more than the declared value
+	ApprovedAmount   int64
+	Currency         string
+	ReviewerID       uint
+	DecisionNotes    string
+	EvidenceRequests []EvidenceRequest
+	PaymentReference string
+	SubmittedAt      time.Time
+	DecidedAt        time.Time
+	PaidAt           time.Time
+	// Version is advanced on every update; see DamageClaimRepository.
+	Version int
+}
+
+// OpenEvidenceRequest returns the index of the request still waiting for an
+// answer, or -1.
+func (c DamageClaim) OpenEvidenceRequest() int {
+	for i, r := range c.EvidenceRequests {
+		if r.RespondedAt.IsZero() {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// CODCollection is the money a courier took from the recipient at handover.
+type CODCollection struct {
+	ID            uint
+	DeliveryID    uint
+	ClientID      uint
+	CourierID     uint
+	Amount        int64 // minor units
+	Currency      string
+	PaymentMethod string // "CASH" or "CARD"
+	CollectedAt   time.Time
+}
+
+// CODRemittance is cash a courier handed over to the hub.
+type CODRemittance struct {
+	ID         uint
+	CourierID  uint
+	Amount     int64 // minor units
+	Currency   string
+	RecordedBy uint
+	RemittedAt time.Time
+}
@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+const (
+	CommentInternal = "internal" // staff only
+	CommentClient   = "client"   // also shown to the delivery's client
+)
+
+// CommentAttachment is a file uploaded with a comment, stored like damage
+// report photos.
+type CommentAttachment struct {
+	Path string // blob key
+	Name string // original file name
+	Size int64
+	Mime string
+}
+
+type Comment struct {
+	ID          uint
+	DeliveryID  uint
+	AuthorID    uint
+	AuthorRole  string
+	Body        string
+	Visibility  string
+	Mentions    []uint // users notified through @mentions
+	Attachments []CommentAttachment
+	CreatedAt   time.Time
+}
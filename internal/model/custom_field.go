@@ -0,0 +1,67 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CustomFieldString = "string"
+	CustomFieldNumber = "number"
+	CustomFieldEnum   = "enum"
+	CustomFieldDate   = "date"
+)
+
+// CustomFieldDefinition is a typed field a client attaches to its deliveries,
+// such as an order number or cost center.
+type CustomFieldDefinition struct {
+	ID        uint
+	ClientID  uint
+	Key       string
+	Label     string
+	Type      string
+	Options   []string // allowed values of an enum field
+	Required  bool
+	CreatedAt time.Time
+}
+
+// Normalize checks a submitted value against the definition and returns it
+// in its stored text form.
+func (f CustomFieldDefinition) Normalize(v interface{}) (string, error) {
+	switch f.Type {
+	case CustomFieldNumber:
+		switch n := v.(type) {
+		case float64:
+			return strconv.FormatFloat(n, 'f', -1, 64), nil
+		case string:
+			if x, err := strconv.ParseFloat(strings.TrimSpace(n), 64); err == nil {
+				return strconv.FormatFloat(x, 'f', -1, 64), nil
+			}
+		}
+		return "", fmt.Errorf("%s must be a number", f.Key)
+	case CustomFieldDate:
+		if s, ok := v.(string); ok {
+			if _, err := time.Parse("2006-01-02", s); err == nil {
+				return s, nil
+			}
+		}
+		return "", fmt.Errorf("%s must be a date in YYYY-MM-DD format", f.Key)
+	case CustomFieldEnum:
+		if s, ok := v.(string); ok {
+			for _, o := range f.Options {
+				if o == s {
+					return s, nil
+				}
+			}
+		}
+		return "", fmt.Errorf("%s must be one of %s", f.Key, strings.Join(f.Options, ", "))
+	default:
+		s, ok := v.(string)
+		if !ok {
+			return "", fmt.Errorf("%s must be a string", f.Key)
+		}
+		return s, nil
+	}
+}
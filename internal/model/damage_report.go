@@ -7,8 +7,56 @@ type DamageReport struct {
 	DeliveryID  uint
 	Type        string
 	Description string
+	// PhotoPath, PhotoSize and PhotoMime describe the first attachment and
+	// are kept for older clients; Attachments lists all of them.
 	PhotoPath   string // relative path to uploaded photo
 	PhotoSize   int64  // file size in bytes
 	PhotoMime   string // mime type
-	Timestamp   time.Time
+	Attachments []DamageAttachment
+	ReporterID  uint
+	ClaimID     uint // damage claim opened with the report, if any
+	// Infected is set when the malware scan flagged one of the files.
+	Infected  bool
+	Timestamp time.Time
+}
+
+// DamageAttachment is a photo or PDF document attached to a damage report.
+type DamageAttachment struct {
+	Path       string // blob key
+	Name       string // original file name
+	Size       int64
+	Mime       string // sniffed from the content
+	UploadedBy uint
+	UploadedAt time.Time
+	// GPS is where the photo was taken, when kept; never sent to clients.
+	GPS *Coordinates `json:"-"`
+}
+
+// Coordinates is a position read from photo metadata.
+type Coordinates struct {
+	Lat float64
+	Lon float64
+}
+
+// HasAttachment reports whether path is one of the report's files.
+func (r *DamageReport) HasAttachment(path string) bool {
+	if r.PhotoPath == path {
+		return true
+	}
+	for _, a := range r.Attachments {
+		if a.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// AttachmentName returns the name the file at path was uploaded under.
+func (r *DamageReport) AttachmentName(path string) string {
+	for _, a := range r.Attachments {
+		if a.Path == path {
+			return a.Name
+		}
+	}
+	return ""
 }
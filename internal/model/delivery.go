@@ -3,11 +3,55 @@ package model
 import "time"
 
 type Delivery struct {
-	ID          uint
-	FromAddress string
-	ToAddress   string
-	Status      string
-	CreatedAt   time.Time
-	DeliveredAt time.Time
-	CourierID   uint
+	ID                uint
+	TrackingNumber    string
+	ClientID          uint // user who booked the delivery
+	FromAddress       string
+	ToAddress         string
+	Origin            Address
+	Destination       Address
+	AddressUnresolved bool // origin or destination could not be geocoded
+	ZoneID            uint // 0 when the destination is outside every zone
+	ServiceLevel      string
+	PromisedDate      time.Time // earliest delivery date quoted at booking
+	Status            string
+	CreatedAt         time.Time
+	DeliveredAt       time.Time
+	CourierID         uint
+	CODAmount         int64 // cash on delivery in minor units, 0 when prepaid
+	CODCurrency       string
+	DeclaredValue     int64 // insured value in minor units of DeclaredCurrency, caps damage claims
+	DeclaredCurrency  string
+	FailedAttempts    int
+	ReturnOf          uint // original delivery when this is a reverse delivery
+	// Package dimensions in centimetres and weight in kilograms; 0 when unknown.
+	LengthCm       float64
+	WidthCm        float64
+	HeightCm       float64
+	WeightKg       float64
+	PickupPointID  uint // recipient collects at this pickup point or locker
+	RecipientEmail string
+	RequireOTP     bool // completion needs the recipient's handover code
+	Refrigerated   bool // must travel in a refrigerated vehicle
+	VehicleID      uint // vehicle carrying the parcel once assigned
+	// Set by the recipient through the self-service link.
+	WindowStart      time.Time // requested delivery window, zero when none
+	WindowEnd        time.Time
+	SafePlace        string
+	NeighbourName    string // neighbour authorized to accept the parcel
+	NeighbourAddress string
+	TemplateID       uint      // recurring template that generated the delivery
+	ScheduledDate    time.Time // occurrence date for generated deliveries
+	Tags             []string
+	// CustomFields holds the client's own values keyed by field definition
+	// key, normalized to text: numbers as decimals, dates as YYYY-MM-DD.
+	CustomFields map[string]string
+	// Version is advanced by every update and backs the ETag; updates made
+	// from an older version are rejected.
+	Version int
+}
+
+// VolumeM3 is the package volume in cubic metres, 0 when dimensions are unknown.
+func (d Delivery) VolumeM3() float64 {
+	return d.LengthCm * d.WidthCm * d.HeightCm / 1e6
 }
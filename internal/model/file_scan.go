@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+const (
+	ScanPending  = "pending"  // queued or being scanned
+	ScanClean    = "clean"    // servable
+	ScanInfected = "infected" // quarantined for good
+	ScanFailed   = "failed"   // no verdict; quarantined until rescanned
+)
+
+// FileScan is the malware scan state of a stored file. Variants share the
+// state of their original.
+type FileScan struct {
+	Key       string
+	Status    string
+	Signature string // what the scanner found, when infected
+	Error     string // why the scan failed
+	ScannedAt time.Time
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// HandoverCode is the one-time code a recipient gives the courier to confirm
+// they received the parcel. Only a hash of the code is kept.
+type HandoverCode struct {
+	DeliveryID uint
+	CodeHash   string `json:"-"`
+	Attempts   int    // wrong codes submitted
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	UsedAt     time.Time
+	// OverriddenBy is the dispatcher who allowed completion without the code.
+	OverriddenBy   uint
+	OverrideReason string
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// Hub is a sorting/dispatch site. Its calendar drives cut-off and
+// delivery date calculations for the zones it owns.
+type Hub struct {
+	Code        string // referenced by Zone.Hub
+	Name        string
+	Timezone    string         // IANA name, defaults to UTC
+	WorkingDays []time.Weekday // defaults to Monday–Friday
+	Cutoff      string         // "HH:MM" local time for same-day dispatch, defaults to 17:00
+	Holidays    []string       // "YYYY-MM-DD" dates the hub is closed
+}
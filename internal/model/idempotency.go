@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// IdempotencyRecord is the stored outcome of a request sent with an
+// Idempotency-Key. Until Done is set the first request is still running.
+type IdempotencyRecord struct {
+	Fingerprint string    `json:"fingerprint"` // hash of the request the key was first used with
+	Done        bool      `json:"done"`
+	Status      int       `json:"status"`
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"body"`
+	CreatedAt   time.Time `json:"created_at"`
+}
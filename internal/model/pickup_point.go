@@ -0,0 +1,72 @@
+package model
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	PickupPointLocker  = "LOCKER"  // unattended, parcels go into compartments
+	PickupPointCounter = "COUNTER" // staffed pickup point, no compartments
+)
+
+// Compartment is one locker door. DeliveryID is 0 while the compartment is free.
+type Compartment struct {
+	Code       string // label on the door, e.g. "A12"
+	Size       string // S, M, L, ... for display only; fitting uses the dimensions
+	LengthCm   float64
+	WidthCm    float64
+	HeightCm   float64
+	DeliveryID uint
+}
+
+// Fits reports whether a package of the given dimensions fits in any
+// orientation. Unknown (zero) dimensions always fit.
+func (c Compartment) Fits(length, width, height float64) bool {
+	pkg := []float64{length, width, height}
+	box := []float64{c.LengthCm, c.WidthCm, c.HeightCm}
+	sort.Float64s(pkg)
+	sort.Float64s(box)
+	for i := range pkg {
+		if pkg[i] > box[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Volume is used to prefer the smallest compartment that fits.
+func (c Compartment) Volume() float64 {
+	return c.LengthCm * c.WidthCm * c.HeightCm
+}
+
+type PickupPoint struct {
+	ID           uint
+	Code         string
+	Name         string
+	Type         string // PickupPointLocker or PickupPointCounter
+	Address      Address
+	Compartments []Compartment
+	HoldDays     int // days a parcel waits for collection, 0 uses the default
+	CreatedAt    time.Time
+}
+
+const (
+	PickupParcelStored    = "STORED"
+	PickupParcelCollected = "COLLECTED"
+	PickupParcelExpired   = "EXPIRED"
+)
+
+// PickupParcel is a delivery waiting at a pickup point for its recipient.
+type PickupParcel struct {
+	ID                uint
+	DeliveryID        uint
+	PickupPointID     uint
+	Compartment       string // empty at counters
+	PINHash           string `json:"-"`
+	FailedPINAttempts int
+	Status            string
+	StoredAt          time.Time
+	ExpiresAt         time.Time
+	CollectedAt       time.Time
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// RefreshToken is a refresh token kept server-side; only the SHA-256 of
+// the token itself is stored. Tokens rotate on every use, and all tokens
+// descending from one login share a FamilyID, so a stolen token that is
+// replayed revokes the whole chain.
+type RefreshToken struct {
+	Hash       string
+	UserID     uint
+	FamilyID   string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	UsedAt     time.Time // when it was rotated; presenting it again is reuse
+	ReplacedBy string    // hash of its successor
+	RevokedAt  time.Time
+}
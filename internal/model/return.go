@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+const (
+	ReturnReasonDamaged        = "DAMAGED"
+	ReturnReasonWrongItem      = "WRONG_ITEM"
+	ReturnReasonRefused        = "REFUSED"
+	ReturnReasonFailedAttempts = "FAILED_ATTEMPTS"
+	ReturnReasonUncollected    = "UNCOLLECTED" // left at a pickup point past the hold period
+)
+
+// ReturnRequest links an original delivery to the reverse delivery that
+// brings the parcel back to the sender.
+type ReturnRequest struct {
+	ID                 uint
+	OriginalDeliveryID uint
+	ReturnDeliveryID   uint
+	ClientID           uint
+	Reason             string
+	Notes              string
+	Automatic          bool // raised by the system rather than a user
+	RequestedBy        uint
+	CreatedAt          time.Time
+}
@@ -0,0 +1,92 @@
+package model
+
+import "time"
+
+const (
+	RecurrenceDaily   = "DAILY"
+	RecurrenceWeekly  = "WEEKLY"
+	RecurrenceMonthly = "MONTHLY"
+)
+
+// Recurrence says on which dates a template produces a delivery. Dates are
+// calendar days in UTC.
+type Recurrence struct {
+	Frequency string         // RecurrenceDaily, RecurrenceWeekly or RecurrenceMonthly
+	Interval  int            // every N days, weeks or months; 0 means 1
+	Weekdays  []time.Weekday // weekly only
+	MonthDay  int            // monthly only; clamped to the last day of short months
+	StartDate time.Time
+	EndDate   time.Time // zero for no end
+}
+
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Occurs reports whether the recurrence produces a delivery on day.
+func (r Recurrence) Occurs(day time.Time) bool {
+	day = dateOnly(day)
+	start := dateOnly(r.StartDate)
+	if day.Before(start) || (!r.EndDate.IsZero() && day.After(dateOnly(r.EndDate))) {
+		return false
+	}
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+	switch r.Frequency {
+	case RecurrenceDaily:
+		return int(day.Sub(start).Hours()/24)%interval == 0
+	case RecurrenceWeekly:
+		match := false
+		for _, wd := range r.Weekdays {
+			match = match || wd == day.Weekday()
+		}
+		// Weeks are counted from the Monday of the start week.
+		startWeek := start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+		weeks := int(day.Sub(startWeek).Hours() / 24 / 7)
+		return match && weeks%interval == 0
+	case RecurrenceMonthly:
+		months := (day.Year()-start.Year())*12 + int(day.Month()-start.Month())
+		target := r.MonthDay
+		if last := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day(); target > last {
+			target = last
+		}
+		return day.Day() == target && months%interval == 0
+	}
+	return false
+}
+
+// DeliveryTemplate is a route a client ships repeatedly. The scheduler turns
+// each occurrence into a regular delivery linked back through TemplateID.
+type DeliveryTemplate struct {
+	ID             uint
+	ClientID       uint
+	Name           string
+	Origin         Address
+	Destination    Address
+	ServiceLevel   string
+	LengthCm       float64
+	WidthCm        float64
+	HeightCm       float64
+	WeightKg       float64
+	RecipientEmail string
+	Recurrence     Recurrence
+	Paused         bool
+	Skipped        []string // YYYY-MM-DD occurrences the client cancelled
+	// GeneratedThrough is the last date deliveries were materialized for.
+	GeneratedThrough time.Time
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// IsSkipped reports whether the occurrence on day was skipped.
+func (t DeliveryTemplate) IsSkipped(day time.Time) bool {
+	d := day.Format("2006-01-02")
+	for _, s := range t.Skipped {
+		if s == d {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// TimelineEvent is one entry in a delivery's history as shown to staff and clients.
+type TimelineEvent struct {
+	ID         uint
+	DeliveryID uint
+	Type       string // e.g. "created", "assigned", "scan", "return.created"
+	Message    string
+	ActorID    uint // 0 for system events
+	Data       map[string]interface{}
+	CreatedAt  time.Time
+}
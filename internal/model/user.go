@@ -12,4 +12,6 @@ type User struct {
 	VerificationToken string
 	ResetToken        string
 	ResetTokenExpiry  time.Time
+	// Disabled users cannot log in; their tokens are revoked.
+	Disabled bool
 }
@@ -0,0 +1,55 @@
+package model
+
+import "time"
+
+// VehicleDocument is a registration, insurance or inspection certificate
+// that has to be renewed before it expires.
+type VehicleDocument struct {
+	Type      string // e.g. "REGISTRATION", "INSURANCE", "INSPECTION"
+	Number    string
+	ExpiresAt time.Time
+}
+
+type Vehicle struct {
+	ID             uint
+	Plate          string
+	Type           string // e.g. "VAN", "CAR", "BIKE", "TRUCK"
+	MaxWeightKg    float64
+	MaxVolumeM3    float64
+	Refrigerated   bool
+	MaintenanceDue time.Time // zero when no service is scheduled
+	Documents      []VehicleDocument
+	CreatedAt      time.Time
+}
+
+// VehicleAssignment gives a courier a vehicle for one shift.
+type VehicleAssignment struct {
+	ID        uint
+	VehicleID uint
+	CourierID uint
+	StartsAt  time.Time
+	EndsAt    time.Time
+	CreatedBy uint
+}
+
+// Covers reports whether the shift is running at t.
+func (a VehicleAssignment) Covers(t time.Time) bool {
+	return !t.Before(a.StartsAt) && t.Before(a.EndsAt)
+}
+
+// Overlaps reports whether two shifts share any time.
+func (a VehicleAssignment) Overlaps(b VehicleAssignment) bool {
+	return a.StartsAt.Before(b.EndsAt) && b.StartsAt.Before(a.EndsAt)
+}
+
+// VehicleManifest is a sealed list of the parcels loaded onto a vehicle,
+// with their combined weight and volume at the time of sealing.
+type VehicleManifest struct {
+	ID          uint
+	VehicleID   uint
+	DeliveryIDs []uint
+	WeightKg    float64
+	VolumeM3    float64
+	SealedBy    uint
+	SealedAt    time.Time
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// Polygon holds GeoJSON polygon coordinates: the outer ring followed by any
+// holes, each ring a list of [lng, lat] positions.
+type Polygon [][][2]float64
+
+type Zone struct {
+	ID          uint
+	Name        string
+	Hub         string // code of the owning hub, e.g. "ALA-3"
+	CourierPool []uint // couriers offered first for deliveries in the zone
+	// ServiceLevels offered for destinations in the zone; empty means STANDARD only.
+	ServiceLevels []string
+	Polygons      []Polygon
+	CreatedAt     time.Time
+}
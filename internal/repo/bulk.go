@@ -0,0 +1,42 @@
+package repo
+
+import (
+	"deliverymanagement/internal/model"
+	"errors"
+	"sync"
+)
+
+type BulkJobRepository interface {
+	SaveJob(job *model.BulkJob) error
+	GetJob(id string) (*model.BulkJob, error)
+}
+
+// InMemoryBulkJobRepo stores snapshots so a running job can be read while
+// its worker keeps updating it.
+type InMemoryBulkJobRepo struct {
+	mu   sync.RWMutex
+	jobs map[string]model.BulkJob
+}
+
+func NewInMemoryBulkJobRepo() *InMemoryBulkJobRepo {
+	return &InMemoryBulkJobRepo{jobs: make(map[string]model.BulkJob)}
+}
+
+func (r *InMemoryBulkJobRepo) SaveJob(job *model.BulkJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	snapshot := *job
+	snapshot.Results = append([]model.BulkItemResult(nil), job.Results...)
+	r.jobs[job.ID] = snapshot
+	return nil
+}
+
+func (r *InMemoryBulkJobRepo) GetJob(id string) (*model.BulkJob, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	job, ok := r.jobs[id]
+	if !ok {
+		return nil, errors.New("job not found")
+	}
+	return &job, nil
+}
@@ -0,0 +1,88 @@
+package repo
+
+import (
+	"deliverymanagement/internal/model"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ErrClaimConflict is returned by UpdateClaim when the claim was changed
+// since the caller read it.
+var ErrClaimConflict = errors.New("claim was modified by someone else")
+
+type DamageClaimRepository interface {
+	CreateClaim(c *model.DamageClaim) error
+	GetClaim(id uint) (*model.DamageClaim, error)
+	// UpdateClaim stores c if its Version is still the stored one, so two
+	// reviewers cannot both act on the same state, and advances the version.
+	UpdateClaim(c *model.DamageClaim) error
+	ListClaims() ([]model.DamageClaim, error)
+}
+
+type InMemoryDamageClaimRepo struct {
+	mu     sync.RWMutex
+	claims map[uint]model.DamageClaim
+	nextID uint
+}
+
+func NewInMemoryDamageClaimRepo() *InMemoryDamageClaimRepo {
+	return &InMemoryDamageClaimRepo{claims: make(map[uint]model.DamageClaim), nextID: 1}
+}
+
+// copyClaim detaches the evidence requests from the stored claim.
+func copyClaim(c model.DamageClaim) *model.DamageClaim {
+	c.EvidenceRequests = append([]model.EvidenceRequest(nil), c.EvidenceRequests...)
+	return &c
+}
+
+func (r *InMemoryDamageClaimRepo) CreateClaim(c *model.DamageClaim) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.claims {
+		if existing.ReportID == c.ReportID {
+			return errors.New("claim already exists for damage report")
+		}
+	}
+	c.ID = r.nextID
+	c.Version = 1
+	r.nextID++
+	r.claims[c.ID] = *copyClaim(*c)
+	return nil
+}
+
+func (r *InMemoryDamageClaimRepo) GetClaim(id uint) (*model.DamageClaim, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.claims[id]
+	if !ok {
+		return nil, errors.New("claim not found")
+	}
+	return copyClaim(c), nil
+}
+
+func (r *InMemoryDamageClaimRepo) UpdateClaim(c *model.DamageClaim) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.claims[c.ID]
+	if !ok {
+		return errors.New("claim not found")
+	}
+	if stored.Version != c.Version {
+		return ErrClaimConflict
+	}
+	c.Version++
+	r.claims[c.ID] = *copyClaim(*c)
+	return nil
+}
+
+func (r *InMemoryDamageClaimRepo) ListClaims() ([]model.DamageClaim, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]model.DamageClaim, 0, len(r.claims))
+	for _, c := range r.claims {
+		out = append(out, *copyClaim(c))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
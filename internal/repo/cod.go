@@ -0,0 +1,84 @@
+package repo
+
+import (
+	"deliverymanagement/internal/model"
+	"errors"
+	"sync"
+	"time"
+)
+
+type CODRepository interface {
+	CreateCollection(c *model.CODCollection) error
+	GetCollectionByDelivery(deliveryID uint) (*model.CODCollection, error)
+	// ListCollections returns collections with CollectedAt in [from, to).
+	ListCollections(from, to time.Time) ([]model.CODCollection, error)
+	CreateRemittance(r *model.CODRemittance) error
+	// ListRemittances returns remittances with RemittedAt in [from, to).
+	ListRemittances(from, to time.Time) ([]model.CODRemittance, error)
+}
+
+type InMemoryCODRepo struct {
+	mu          sync.RWMutex
+	collections []*model.CODCollection
+	remittances []*model.CODRemittance
+}
+
+func NewInMemoryCODRepo() *InMemoryCODRepo {
+	return &InMemoryCODRepo{}
+}
+
+func (r *InMemoryCODRepo) CreateCollection(c *model.CODCollection) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.collections {
+		if existing.DeliveryID == c.DeliveryID {
+			return errors.New("cod already collected for delivery")
+		}
+	}
+	c.ID = uint(len(r.collections) + 1)
+	r.collections = append(r.collections, c)
+	return nil
+}
+
+func (r *InMemoryCODRepo) GetCollectionByDelivery(deliveryID uint) (*model.CODCollection, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, c := range r.collections {
+		if c.DeliveryID == deliveryID {
+			return c, nil
+		}
+	}
+	return nil, errors.New("collection not found")
+}
+
+func (r *InMemoryCODRepo) ListCollections(from, to time.Time) ([]model.CODCollection, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []model.CODCollection
+	for _, c := range r.collections {
+		if !c.CollectedAt.Before(from) && c.CollectedAt.Before(to) {
+			out = append(out, *c)
+		}
+	}
+	return out, nil
+}
+
+func (r *InMemoryCODRepo) CreateRemittance(rem *model.CODRemittance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rem.ID = uint(len(r.remittances) + 1)
+	r.remittances = append(r.remittances, rem)
+	return nil
+}
+
+func (r *InMemoryCODRepo) ListRemittances(from, to time.Time) ([]model.CODRemittance, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []model.CODRemittance
+	for _, rem := range r.remittances {
+		if !rem.RemittedAt.Before(from) && rem.RemittedAt.Before(to) {
+			out = append(out, *rem)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,59 @@
+package repo
+
+import (
+	"deliverymanagement/internal/model"
+	"sync"
+)
+
+type CommentRepository interface {
+	CreateComment(c *model.Comment) error
+	// ListComments returns the thread of a delivery, oldest first.
+	ListComments(deliveryID uint) ([]model.Comment, error)
+	// FindCommentsByAttachment returns every comment holding the stored
+	// file; identical uploads share one path.
+	FindCommentsByAttachment(path string) []model.Comment
+}
+
+type InMemoryCommentRepo struct {
+	mu       sync.RWMutex
+	comments []model.Comment
+}
+
+func NewInMemoryCommentRepo() *InMemoryCommentRepo {
+	return &InMemoryCommentRepo{}
+}
+
+func (r *InMemoryCommentRepo) CreateComment(c *model.Comment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c.ID = uint(len(r.comments) + 1)
+	r.comments = append(r.comments, *c)
+	return nil
+}
+
+func (r *InMemoryCommentRepo) ListComments(deliveryID uint) ([]model.Comment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := []model.Comment{}
+	for _, c := range r.comments {
+		if c.DeliveryID == deliveryID {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func (r *InMemoryCommentRepo) FindCommentsByAttachment(path string) []model.Comment {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []model.Comment
+	for _, c := range r.comments {
+		for _, a := range c.Attachments {
+			if a.Path == path {
+				out = append(out, c)
+				break
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package repo
+
+import (
+	"deliverymanagement/internal/model"
+	"errors"
+	"sort"
+	"sync"
+)
+
+type CustomFieldRepository interface {
+	// CreateField rejects a key the client already uses.
+	CreateField(f *model.CustomFieldDefinition) error
+	ListFields(clientID uint) ([]model.CustomFieldDefinition, error)
+	DeleteField(clientID uint, key string) error
+}
+
+type InMemoryCustomFieldRepo struct {
+	mu     sync.RWMutex
+	fields []model.CustomFieldDefinition
+	nextID uint
+}
+
+func NewInMemoryCustomFieldRepo() *InMemoryCustomFieldRepo {
+	return &InMemoryCustomFieldRepo{nextID: 1}
+}
+
+func (r *InMemoryCustomFieldRepo) CreateField(f *model.CustomFieldDefinition) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.fields {
+		if existing.ClientID == f.ClientID && existing.Key == f.Key {
+			return errors.New("custom field with this key already exists")
+		}
+	}
+	f.ID = r.nextID
+	r.nextID++
+	r.fields = append(r.fields, *f)
+	return nil
+}
+
+func (r *InMemoryCustomFieldRepo) ListFields(clientID uint) ([]model.CustomFieldDefinition, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := []model.CustomFieldDefinition{}
+	for _, f := range r.fields {
+		if f.ClientID == clientID {
+			out = append(out, f)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+func (r *InMemoryCustomFieldRepo) DeleteField(clientID uint, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, f := range r.fields {
+		if f.ClientID == clientID && f.Key == key {
+			r.fields = append(r.fields[:i], r.fields[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("custom field not found")
+}
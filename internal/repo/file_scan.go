@@ -0,0 +1,38 @@
+package repo
+
+import (
+	"deliverymanagement/internal/model"
+	"errors"
+	"sync"
+)
+
+type FileScanRepository interface {
+	SaveScan(s *model.FileScan) error
+	GetScan(key string) (*model.FileScan, error)
+}
+
+type InMemoryFileScanRepo struct {
+	mu    sync.RWMutex
+	scans map[string]model.FileScan
+}
+
+func NewInMemoryFileScanRepo() *InMemoryFileScanRepo {
+	return &InMemoryFileScanRepo{scans: make(map[string]model.FileScan)}
+}
+
+func (r *InMemoryFileScanRepo) SaveScan(s *model.FileScan) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scans[s.Key] = *s
+	return nil
+}
+
+func (r *InMemoryFileScanRepo) GetScan(key string) (*model.FileScan, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.scans[key]
+	if !ok {
+		return nil, errors.New("file scan not found")
+	}
+	return &s, nil
+}
@@ -0,0 +1,55 @@
+package repo
+
+import (
+	"deliverymanagement/internal/model"
+	"errors"
+	"sync"
+)
+
+type HandoverCodeRepository interface {
+	// SaveCode stores the current code of a delivery, replacing any earlier one.
+	SaveCode(code *model.HandoverCode) error
+	GetCode(deliveryID uint) (*model.HandoverCode, error)
+	// RecordFailedAttempt counts an attempt against the delivery's code and
+	// returns the attempts so far, all under one lock.
+	RecordFailedAttempt(deliveryID uint) (int, error)
+}
+
+type InMemoryHandoverCodeRepo struct {
+	mu    sync.RWMutex
+	codes map[uint]*model.HandoverCode
+}
+
+func NewInMemoryHandoverCodeRepo() *InMemoryHandoverCodeRepo {
+	return &InMemoryHandoverCodeRepo{codes: make(map[uint]*model.HandoverCode)}
+}
+
+func (r *InMemoryHandoverCodeRepo) SaveCode(code *model.HandoverCode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := *code
+	r.codes[code.DeliveryID] = &stored
+	return nil
+}
+
+func (r *InMemoryHandoverCodeRepo) GetCode(deliveryID uint) (*model.HandoverCode, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	code, ok := r.codes[deliveryID]
+	if !ok {
+		return nil, errors.New("handover code not found")
+	}
+	found := *code
+	return &found, nil
+}
+
+func (r *InMemoryHandoverCodeRepo) RecordFailedAttempt(deliveryID uint) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	code, ok := r.codes[deliveryID]
+	if !ok {
+		return 0, errors.New("handover code not found")
+	}
+	code.Attempts++
+	return code.Attempts, nil
+}
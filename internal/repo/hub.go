@@ -0,0 +1,55 @@
+package repo
+
+import (
+	"deliverymanagement/internal/model"
+	"errors"
+	"sort"
+	"sync"
+)
+
+type HubRepository interface {
+	SaveHub(hub *model.Hub) error
+	GetHub(code string) (*model.Hub, error)
+	ListHubs() ([]model.Hub, error)
+}
+
+type InMemoryHubRepo struct {
+	mu   sync.RWMutex
+	hubs map[string]*model.Hub // key: code
+}
+
+func NewInMemoryHubRepo() *InMemoryHubRepo {
+	return &InMemoryHubRepo{hubs: make(map[string]*model.Hub)}
+}
+
+// SaveHub creates the hub or replaces the one with the same code.
+func (r *InMemoryHubRepo) SaveHub(hub *model.Hub) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if hub.Code == "" {
+		return errors.New("hub code required")
+	}
+	r.hubs[hub.Code] = hub
+	return nil
+}
+
+func (r *InMemoryHubRepo) GetHub(code string) (*model.Hub, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	hub, ok := r.hubs[code]
+	if !ok {
+		return nil, errors.New("hub not found")
+	}
+	return hub, nil
+}
+
+func (r *InMemoryHubRepo) ListHubs() ([]model.Hub, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]model.Hub, 0, len(r.hubs))
+	for _, h := range r.hubs {
+		out = append(out, *h)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Code < out[j].Code })
+	return out, nil
+}
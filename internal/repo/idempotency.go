@@ -0,0 +1,64 @@
+package repo
+
+import (
+	"deliverymanagement/internal/model"
+	"sync"
+	"time"
+)
+
+type IdempotencyStore interface {
+	// Begin claims key for a new request. When the key is already known the
+	// stored record is returned with claimed false.
+	Begin(key string, rec *model.IdempotencyRecord, ttl time.Duration) (existing *model.IdempotencyRecord, claimed bool, err error)
+	// Complete stores the finished response under a claimed key.
+	Complete(key string, rec *model.IdempotencyRecord, ttl time.Duration) error
+	// Release forgets a claimed key so the request can be retried.
+	Release(key string) error
+}
+
+type idempotencyEntry struct {
+	rec     model.IdempotencyRecord
+	expires time.Time
+}
+
+type InMemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]idempotencyEntry
+	now     func() time.Time
+}
+
+func NewInMemoryIdempotencyStore() *InMemoryIdempotencyStore {
+	return &InMemoryIdempotencyStore{entries: make(map[string]idempotencyEntry), now: time.Now}
+}
+
+func (s *InMemoryIdempotencyStore) Begin(key string, rec *model.IdempotencyRecord, ttl time.Duration) (*model.IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		existing := e.rec
+		return &existing, false, nil
+	}
+	// Drop expired keys while we hold the lock.
+	for k, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+	s.entries[key] = idempotencyEntry{rec: *rec, expires: now.Add(ttl)}
+	return nil, true, nil
+}
+
+func (s *InMemoryIdempotencyStore) Complete(key string, rec *model.IdempotencyRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = idempotencyEntry{rec: *rec, expires: s.now().Add(ttl)}
+	return nil
+}
+
+func (s *InMemoryIdempotencyStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
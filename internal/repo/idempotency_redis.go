@@ -0,0 +1,58 @@
+package repo
+
+import (
+	"context"
+	"deliverymanagement/internal/model"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisIdempotencyStore shares idempotency keys between API instances.
+// Records are stored as JSON under "idempotency:<key>" and expire with the TTL.
+type RedisIdempotencyStore struct {
+	Redis *redis.Client
+}
+
+func NewRedisIdempotencyStore(client *redis.Client) *RedisIdempotencyStore {
+	return &RedisIdempotencyStore{Redis: client}
+}
+
+func (s *RedisIdempotencyStore) Begin(key string, rec *model.IdempotencyRecord, ttl time.Duration) (*model.IdempotencyRecord, bool, error) {
+	ctx := context.Background()
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return nil, false, err
+	}
+	claimed, err := s.Redis.SetNX(ctx, "idempotency:"+key, b, ttl).Result()
+	if err != nil || claimed {
+		return nil, claimed, err
+	}
+	raw, err := s.Redis.Get(ctx, "idempotency:"+key).Bytes()
+	if err == redis.Nil {
+		// Expired between the two calls; try once more.
+		claimed, err = s.Redis.SetNX(ctx, "idempotency:"+key, b, ttl).Result()
+		return nil, claimed, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var existing model.IdempotencyRecord
+	if err := json.Unmarshal(raw, &existing); err != nil {
+		return nil, false, err
+	}
+	return &existing, false, nil
+}
+
+func (s *RedisIdempotencyStore) Complete(key string, rec *model.IdempotencyRecord, ttl time.Duration) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.Redis.Set(context.Background(), "idempotency:"+key, b, ttl).Err()
+}
+
+func (s *RedisIdempotencyStore) Release(key string) error {
+	return s.Redis.Del(context.Background(), "idempotency:"+key).Err()
+}
@@ -107,6 +107,12 @@ func (r *InMemoryUserRepo) VerifyUser(email string) error {
 	return nil
 }
 
+// ErrVersionConflict is returned by UpdateDelivery when the delivery was
+// changed since the caller read it.
+var ErrVersionConflict = errors.New("delivery was modified by someone else")
+
+// InMemoryDeliveryRepo hands out copies, so changes only take effect through
+// UpdateDelivery, which compares and swaps on Version.
 type InMemoryDeliveryRepo struct {
 	mu         sync.RWMutex
 	deliveries map[uint]*model.Delivery
@@ -120,12 +126,28 @@ func NewInMemoryDeliveryRepo() *InMemoryDeliveryRepo {
 	}
 }
 
+// cloneDelivery copies d including its slices and maps.
+func cloneDelivery(d *model.Delivery) *model.Delivery {
+	out := *d
+	if d.Tags != nil {
+		out.Tags = append([]string(nil), d.Tags...)
+	}
+	if d.CustomFields != nil {
+		out.CustomFields = make(map[string]string, len(d.CustomFields))
+		for k, v := range d.CustomFields {
+			out.CustomFields[k] = v
+		}
+	}
+	return &out
+}
+
 func (r *InMemoryDeliveryRepo) CreateDelivery(delivery *model.Delivery) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	delivery.ID = r.nextID
+	delivery.Version = 1
 	r.nextID++
-	r.deliveries[delivery.ID] = delivery
+	r.deliveries[delivery.ID] = cloneDelivery(delivery)
 	return nil
 }
 
@@ -136,7 +158,24 @@ func (r *InMemoryDeliveryRepo) GetDelivery(id uint) (*model.Delivery, error) {
 	if !exists {
 		return nil, errors.New("delivery not found")
 	}
-	return delivery, nil
+	return cloneDelivery(delivery), nil
+}
+
+// UpdateDelivery stores delivery if its Version is still the stored one and
+// advances the version on both.
+func (r *InMemoryDeliveryRepo) UpdateDelivery(delivery *model.Delivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, exists := r.deliveries[delivery.ID]
+	if !exists {
+		return errors.New("delivery not found")
+	}
+	if stored.Version != delivery.Version {
+		return ErrVersionConflict
+	}
+	delivery.Version++
+	r.deliveries[delivery.ID] = cloneDelivery(delivery)
+	return nil
 }
 
 func (r *InMemoryDeliveryRepo) ListDeliveries() ([]model.Delivery, error) {
@@ -144,7 +183,7 @@ func (r *InMemoryDeliveryRepo) ListDeliveries() ([]model.Delivery, error) {
 	defer r.mu.RUnlock()
 	list := make([]model.Delivery, 0, len(r.deliveries))
 	for _, d := range r.deliveries {
-		list = append(list, *d)
+		list = append(list, *cloneDelivery(d))
 	}
 	return list, nil
 }
@@ -197,12 +236,28 @@ func NewInMemoryDamageReportRepo() *InMemoryDamageReportRepo {
 	}
 }
 
+// cloneDamageReport copies rep including its attachments.
+func cloneDamageReport(rep *model.DamageReport) *model.DamageReport {
+	out := *rep
+	if rep.Attachments != nil {
+		out.Attachments = make([]model.DamageAttachment, len(rep.Attachments))
+		for i, a := range rep.Attachments {
+			if a.GPS != nil {
+				gps := *a.GPS
+				a.GPS = &gps
+			}
+			out.Attachments[i] = a
+		}
+	}
+	return &out
+}
+
 func (r *InMemoryDamageReportRepo) CreateDamageReport(report *model.DamageReport) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	report.ID = r.nextID
 	r.nextID++
-	r.reports = append(r.reports, report)
+	r.reports = append(r.reports, cloneDamageReport(report))
 	return nil
 }
 
@@ -212,8 +267,81 @@ func (r *InMemoryDamageReportRepo) ListDamageReports(deliveryID uint) []*model.D
 	var result []*model.DamageReport
 	for _, rep := range r.reports {
 		if rep.DeliveryID == deliveryID {
-			result = append(result, rep)
+			result = append(result, cloneDamageReport(rep))
 		}
 	}
 	return result
 }
+
+func (r *InMemoryDamageReportRepo) GetDamageReport(id uint) (*model.DamageReport, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, rep := range r.reports {
+		if rep.ID == id {
+			return cloneDamageReport(rep), nil
+		}
+	}
+	return nil, errors.New("damage report not found")
+}
+
+func (r *InMemoryDamageReportRepo) FindDamageReportsByFile(key string) []*model.DamageReport {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var result []*model.DamageReport
+	for _, rep := range r.reports {
+		if rep.HasAttachment(key) {
+			result = append(result, cloneDamageReport(rep))
+		}
+	}
+	return result
+}
+
+func (r *InMemoryDamageReportRepo) AddDamageAttachments(id uint, attachments ...model.DamageAttachment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rep := range r.reports {
+		if rep.ID == id {
+			added := cloneDamageReport(&model.DamageReport{Attachments: attachments})
+			rep.Attachments = append(rep.Attachments, added.Attachments...)
+			return nil
+		}
+	}
+	return errors.New("damage report not found")
+}
+
+func (r *InMemoryDamageReportRepo) SetClaimID(id, claimID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rep := range r.reports {
+		if rep.ID == id {
+			rep.ClaimID = claimID
+			return nil
+		}
+	}
+	return errors.New("damage report not found")
+}
+
+func (r *InMemoryDamageReportRepo) DeleteDamageReport(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, rep := range r.reports {
+		if rep.ID == id {
+			r.reports = append(r.reports[:i], r.reports[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("damage report not found")
+}
+
+func (r *InMemoryDamageReportRepo) MarkFileInfected(key string) []*model.DamageReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var marked []*model.DamageReport
+	for _, rep := range r.reports {
+		if rep.HasAttachment(key) {
+			rep.Infected = true
+			marked = append(marked, cloneDamageReport(rep))
+		}
+	}
+	return marked
+}
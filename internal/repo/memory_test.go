@@ -3,6 +3,7 @@ package repo
 import (
 	"deliverymanagement/internal/model"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -46,3 +47,137 @@ func TestInMemoryDeliveryRepo(t *testing.T) {
 	_, err = repo.GetDelivery(999)
 	assert.Error(t, err)
 }
+
+func TestInMemoryDeliveryRepo_VersionedCopies(t *testing.T) {
+	repo := NewInMemoryDeliveryRepo()
+	delivery := &model.Delivery{Status: "CREATED", Tags: []string{"vip"}}
+	assert.NoError(t, repo.CreateDelivery(delivery))
+	assert.Equal(t, 1, delivery.Version)
+
+	// Changing a copy does not change the stored delivery
+	a, _ := repo.GetDelivery(1)
+	a.Status = "ASSIGNED"
+	a.Tags[0] = "changed"
+	stored, _ := repo.GetDelivery(1)
+	assert.Equal(t, "CREATED", stored.Status)
+	assert.Equal(t, []string{"vip"}, stored.Tags)
+
+	// The first writer wins, the second one read an older version
+	b, _ := repo.GetDelivery(1)
+	assert.NoError(t, repo.UpdateDelivery(a))
+	assert.Equal(t, 2, a.Version)
+	b.Status = "CANCELLED"
+	assert.ErrorIs(t, repo.UpdateDelivery(b), ErrVersionConflict)
+	stored, _ = repo.GetDelivery(1)
+	assert.Equal(t, "ASSIGNED", stored.Status)
+
+	// Sequential updates through the same copy keep working
+	a.Status = "DELIVERED"
+	assert.NoError(t, repo.UpdateDelivery(a))
+	stored, _ = repo.GetDelivery(1)
+	assert.Equal(t, 3, stored.Version)
+}
+
+func TestInMemoryDamageClaimRepo_Versioned(t *testing.T) {
+	repo := NewInMemoryDamageClaimRepo()
+	assert.NoError(t, repo.CreateClaim(&model.DamageClaim{ReportID: 1, Status: model.ClaimApproved}))
+
+	// Two concurrent payouts read the same approved claim; only one lands
+	a, _ := repo.GetClaim(1)
+	b, _ := repo.GetClaim(1)
+	a.Status, a.PaymentReference = model.ClaimPaid, "TX-1"
+	assert.NoError(t, repo.UpdateClaim(a))
+	b.Status, b.PaymentReference = model.ClaimPaid, "TX-2"
+	assert.ErrorIs(t, repo.UpdateClaim(b), ErrClaimConflict)
+	stored, _ := repo.GetClaim(1)
+	assert.Equal(t, "TX-1", stored.PaymentReference)
+	assert.Equal(t, 2, stored.Version)
+}
+
+func TestInMemoryIdempotencyStore_Expiry(t *testing.T) {
+	s := NewInMemoryIdempotencyStore()
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	_, claimed, _ := s.Begin("k", &model.IdempotencyRecord{Fingerprint: "a"}, time.Hour)
+	assert.True(t, claimed)
+	s.Complete("k", &model.IdempotencyRecord{Fingerprint: "a", Done: true, Status: 201}, time.Hour)
+	existing, claimed, _ := s.Begin("k", &model.IdempotencyRecord{Fingerprint: "a"}, time.Hour)
+	assert.False(t, claimed)
+	assert.Equal(t, 201, existing.Status)
+
+	now = now.Add(time.Hour)
+	_, claimed, _ = s.Begin("k", &model.IdempotencyRecord{Fingerprint: "b"}, time.Hour)
+	assert.True(t, claimed)
+	s.Release("k")
+	_, claimed, _ = s.Begin("k", &model.IdempotencyRecord{Fingerprint: "c"}, time.Hour)
+	assert.True(t, claimed)
+}
+
+func TestInMemoryDamageReportRepo_FindByFile(t *testing.T) {
+	repo := NewInMemoryDamageReportRepo()
+	repo.CreateDamageReport(&model.DamageReport{DeliveryID: 7, PhotoPath: "a.jpg"})
+	repo.CreateDamageReport(&model.DamageReport{DeliveryID: 8})
+	repo.AddDamageAttachments(2, model.DamageAttachment{Path: "b.pdf"})
+
+	repo.AddDamageAttachments(2, model.DamageAttachment{Path: "a.jpg"})
+
+	found := repo.FindDamageReportsByFile("a.jpg")
+	if assert.Len(t, found, 2) {
+		assert.Equal(t, uint(7), found[0].DeliveryID)
+		assert.Equal(t, uint(8), found[1].DeliveryID)
+	}
+	found = repo.FindDamageReportsByFile("b.pdf")
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, uint(8), found[0].DeliveryID)
+	}
+	assert.Empty(t, repo.FindDamageReportsByFile("c.png"))
+}
+
+func TestInMemoryDamageReportRepo_MarkFileInfected(t *testing.T) {
+	repo := NewInMemoryDamageReportRepo()
+	repo.CreateDamageReport(&model.DamageReport{DeliveryID: 7, PhotoPath: "a.jpg"})
+	repo.CreateDamageReport(&model.DamageReport{DeliveryID: 8, PhotoPath: "b.jpg"})
+	repo.AddDamageAttachments(2, model.DamageAttachment{Path: "a.jpg"})
+
+	assert.Len(t, repo.MarkFileInfected("a.jpg"), 2)
+	assert.Empty(t, repo.MarkFileInfected("c.png"))
+	r, _ := repo.GetDamageReport(2)
+	assert.True(t, r.Infected)
+}
+
+func TestInMemoryDamageReportRepo_Copies(t *testing.T) {
+	repo := NewInMemoryDamageReportRepo()
+	report := &model.DamageReport{DeliveryID: 7, Attachments: []model.DamageAttachment{{Path: "a.jpg"}}}
+	repo.CreateDamageReport(report)
+	report.Attachments[0].Path = "changed.jpg"
+
+	got, _ := repo.GetDamageReport(report.ID)
+	got.Attachments[0].Path = "other.jpg"
+	got.ClaimID = 99
+	again, _ := repo.GetDamageReport(report.ID)
+	assert.Equal(t, "a.jpg", again.Attachments[0].Path)
+	assert.Zero(t, again.ClaimID)
+
+	assert.NoError(t, repo.SetClaimID(report.ID, 3))
+	assert.Error(t, repo.SetClaimID(42, 3))
+	again, _ = repo.GetDamageReport(report.ID)
+	assert.Equal(t, uint(3), again.ClaimID)
+}
+
+func TestInMemoryPickupPointRepo_CloseParcelOnce(t *testing.T) {
+	repo := NewInMemoryPickupPointRepo()
+	p := &model.PickupParcel{DeliveryID: 7, Status: model.PickupParcelStored}
+	assert.NoError(t, repo.CreateParcel(p))
+
+	// Callers hold copies; only the repository methods change the parcel
+	found, _ := repo.FindStoredParcel(7)
+	found.FailedPINAttempts = 99
+	n, _ := repo.RecordFailedPIN(p.ID)
+	assert.Equal(t, 1, n)
+
+	// A parcel expiring while it is collected ends up in exactly one state
+	assert.NoError(t, repo.ExpireParcel(p.ID))
+	assert.ErrorIs(t, repo.CollectParcel(p.ID, time.Now()), ErrParcelNotStored)
+	list, _ := repo.ListParcels()
+	assert.Equal(t, model.PickupParcelExpired, list[0].Status)
+}
@@ -0,0 +1,218 @@
+package repo
+
+import (
+	"deliverymanagement/internal/model"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoFreeCompartment = errors.New("no free compartment fits the parcel")
+	// ErrParcelNotStored is returned when a parcel was collected or expired
+	// meanwhile.
+	ErrParcelNotStored = errors.New("parcel is no longer waiting for collection")
+)
+
+type PickupPointRepository interface {
+	CreatePickupPoint(p *model.PickupPoint) error
+	GetPickupPoint(id uint) (*model.PickupPoint, error)
+	ListPickupPoints() ([]model.PickupPoint, error)
+	// AllocateCompartment reserves the smallest free compartment of a locker
+	// that fits the package and returns its code.
+	AllocateCompartment(pointID, deliveryID uint, length, width, height float64) (string, error)
+	ReleaseCompartment(pointID uint, code string) error
+
+	CreateParcel(p *model.PickupParcel) error
+	// FindStoredParcel returns the parcel of a delivery still waiting for collection.
+	FindStoredParcel(deliveryID uint) (*model.PickupParcel, error)
+	UpdateParcel(p *model.PickupParcel) error
+	// RecordFailedPIN counts a PIN attempt and returns the attempts so far.
+	// Callers count an attempt before checking the PIN.
+	RecordFailedPIN(id uint) (int, error)
+	// CollectParcel and ExpireParcel close a stored parcel; whichever comes
+	// first wins and the other gets ErrParcelNotStored.
+	CollectParcel(id uint, at time.Time) error
+	ExpireParcel(id uint) error
+	ListParcels() ([]model.PickupParcel, error)
+}
+
+type InMemoryPickupPointRepo struct {
+	mu      sync.RWMutex
+	points  map[uint]*model.PickupPoint
+	parcels []*model.PickupParcel
+	nextID  uint
+}
+
+func NewInMemoryPickupPointRepo() *InMemoryPickupPointRepo {
+	return &InMemoryPickupPointRepo{points: make(map[uint]*model.PickupPoint), nextID: 1}
+}
+
+func (r *InMemoryPickupPointRepo) CreatePickupPoint(p *model.PickupPoint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.points {
+		if existing.Code == p.Code {
+			return errors.New("pickup point code already exists")
+		}
+	}
+	p.ID = r.nextID
+	r.nextID++
+	r.points[p.ID] = p
+	return nil
+}
+
+func (r *InMemoryPickupPointRepo) GetPickupPoint(id uint) (*model.PickupPoint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.points[id]
+	if !ok {
+		return nil, errors.New("pickup point not found")
+	}
+	return p, nil
+}
+
+func (r *InMemoryPickupPointRepo) ListPickupPoints() ([]model.PickupPoint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]model.PickupPoint, 0, len(r.points))
+	for _, p := range r.points {
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (r *InMemoryPickupPointRepo) AllocateCompartment(pointID, deliveryID uint, length, width, height float64) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.points[pointID]
+	if !ok {
+		return "", errors.New("pickup point not found")
+	}
+	best := -1
+	for i, c := range p.Compartments {
+		if c.DeliveryID != 0 || !c.Fits(length, width, height) {
+			continue
+		}
+		if best < 0 || c.Volume() < p.Compartments[best].Volume() {
+			best = i
+		}
+	}
+	if best < 0 {
+		return "", ErrNoFreeCompartment
+	}
+	p.Compartments[best].DeliveryID = deliveryID
+	return p.Compartments[best].Code, nil
+}
+
+func (r *InMemoryPickupPointRepo) ReleaseCompartment(pointID uint, code string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.points[pointID]
+	if !ok {
+		return errors.New("pickup point not found")
+	}
+	for i := range p.Compartments {
+		if p.Compartments[i].Code == code {
+			p.Compartments[i].DeliveryID = 0
+			return nil
+		}
+	}
+	return errors.New("compartment not found")
+}
+
+func (r *InMemoryPickupPointRepo) CreateParcel(p *model.PickupParcel) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p.ID = uint(len(r.parcels) + 1)
+	stored := *p
+	r.parcels = append(r.parcels, &stored)
+	return nil
+}
+
+func (r *InMemoryPickupPointRepo) FindStoredParcel(deliveryID uint) (*model.PickupParcel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, p := range r.parcels {
+		if p.DeliveryID == deliveryID && p.Status == model.PickupParcelStored {
+			found := *p
+			return &found, nil
+		}
+	}
+	return nil, errors.New("parcel not found")
+}
+
+func (r *InMemoryPickupPointRepo) UpdateParcel(p *model.PickupParcel) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, existing := range r.parcels {
+		if existing.ID == p.ID {
+			stored := *p
+			r.parcels[i] = &stored
+			return nil
+		}
+	}
+	return errors.New("parcel not found")
+}
+
+// parcel returns the stored parcel with the ID; callers hold r.mu.
+func (r *InMemoryPickupPointRepo) parcel(id uint) (*model.PickupParcel, error) {
+	for _, p := range r.parcels {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return nil, errors.New("parcel not found")
+}
+
+func (r *InMemoryPickupPointRepo) RecordFailedPIN(id uint) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, err := r.parcel(id)
+	if err != nil {
+		return 0, err
+	}
+	p.FailedPINAttempts++
+	return p.FailedPINAttempts, nil
+}
+
+func (r *InMemoryPickupPointRepo) CollectParcel(id uint, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, err := r.parcel(id)
+	if err != nil {
+		return err
+	}
+	if p.Status != model.PickupParcelStored {
+		return ErrParcelNotStored
+	}
+	p.Status = model.PickupParcelCollected
+	p.CollectedAt = at
+	return nil
+}
+
+func (r *InMemoryPickupPointRepo) ExpireParcel(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, err := r.parcel(id)
+	if err != nil {
+		return err
+	}
+	if p.Status != model.PickupParcelStored {
+		return ErrParcelNotStored
+	}
+	p.Status = model.PickupParcelExpired
+	return nil
+}
+
+func (r *InMemoryPickupPointRepo) ListParcels() ([]model.PickupParcel, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]model.PickupParcel, 0, len(r.parcels))
+	for _, p := range r.parcels {
+		out = append(out, *p)
+	}
+	return out, nil
+}
@@ -19,6 +19,7 @@ type UserRepository interface {
 type DeliveryRepository interface {
 	CreateDelivery(delivery *model.Delivery) error
 	GetDelivery(id uint) (*model.Delivery, error)
+	UpdateDelivery(delivery *model.Delivery) error
 	ListDeliveries() ([]model.Delivery, error)
 }
 
@@ -30,6 +31,18 @@ type ScanEventRepository interface {
 type DamageReportRepository interface {
 	CreateDamageReport(report *model.DamageReport) error
 	ListDamageReports(deliveryID uint) []*model.DamageReport
+	GetDamageReport(id uint) (*model.DamageReport, error)
+	AddDamageAttachments(id uint, attachments ...model.DamageAttachment) error
+	// SetClaimID links the report to the damage claim opened for it.
+	SetClaimID(id, claimID uint) error
+	// DeleteDamageReport removes a report whose claim could not be opened.
+	DeleteDamageReport(id uint) error
+	// FindDamageReportsByFile returns every report holding the file key;
+	// identical uploads share one key.
+	FindDamageReportsByFile(key string) []*model.DamageReport
+	// MarkFileInfected flags every report holding the file after a malware
+	// finding and returns them.
+	MarkFileInfected(key string) []*model.DamageReport
 }
 
 type RoleRepository interface {
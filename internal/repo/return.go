@@ -0,0 +1,69 @@
+package repo
+
+import (
+	"deliverymanagement/internal/model"
+	"errors"
+	"sync"
+)
+
+type ReturnRepository interface {
+	CreateReturn(r *model.ReturnRequest) error
+	GetReturn(id uint) (*model.ReturnRequest, error)
+	FindReturnByOriginal(deliveryID uint) (*model.ReturnRequest, error)
+	ListReturns() ([]model.ReturnRequest, error)
+}
+
+type InMemoryReturnRepo struct {
+	mu      sync.RWMutex
+	returns []*model.ReturnRequest
+}
+
+func NewInMemoryReturnRepo() *InMemoryReturnRepo {
+	return &InMemoryReturnRepo{}
+}
+
+// CreateReturn allows at most one return per original delivery.
+func (r *InMemoryReturnRepo) CreateReturn(ret *model.ReturnRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.returns {
+		if existing.OriginalDeliveryID == ret.OriginalDeliveryID {
+			return errors.New("return already exists for delivery")
+		}
+	}
+	ret.ID = uint(len(r.returns) + 1)
+	r.returns = append(r.returns, ret)
+	return nil
+}
+
+func (r *InMemoryReturnRepo) GetReturn(id uint) (*model.ReturnRequest, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, ret := range r.returns {
+		if ret.ID == id {
+			return ret, nil
+		}
+	}
+	return nil, errors.New("return not found")
+}
+
+func (r *InMemoryReturnRepo) FindReturnByOriginal(deliveryID uint) (*model.ReturnRequest, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, ret := range r.returns {
+		if ret.OriginalDeliveryID == deliveryID {
+			return ret, nil
+		}
+	}
+	return nil, errors.New("return not found")
+}
+
+func (r *InMemoryReturnRepo) ListReturns() ([]model.ReturnRequest, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]model.ReturnRequest, 0, len(r.returns))
+	for _, ret := range r.returns {
+		out = append(out, *ret)
+	}
+	return out, nil
+}
@@ -0,0 +1,39 @@
+package repo
+
+import (
+	"errors"
+	"sync"
+)
+
+// StorageQuotaRepository keeps per-client upload limits in bytes.
+type StorageQuotaRepository interface {
+	SetQuota(clientID uint, bytes int64) error
+	// GetQuota returns the client's limit, or false when none is set.
+	GetQuota(clientID uint) (int64, bool)
+}
+
+type InMemoryStorageQuotaRepo struct {
+	mu     sync.RWMutex
+	quotas map[uint]int64
+}
+
+func NewInMemoryStorageQuotaRepo() *InMemoryStorageQuotaRepo {
+	return &InMemoryStorageQuotaRepo{quotas: make(map[uint]int64)}
+}
+
+func (r *InMemoryStorageQuotaRepo) SetQuota(clientID uint, bytes int64) error {
+	if bytes < 0 {
+		return errors.New("quota must not be negative")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.quotas[clientID] = bytes
+	return nil
+}
+
+func (r *InMemoryStorageQuotaRepo) GetQuota(clientID uint) (int64, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	q, ok := r.quotas[clientID]
+	return q, ok
+}
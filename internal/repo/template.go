@@ -0,0 +1,65 @@
+package repo
+
+import (
+	"deliverymanagement/internal/model"
+	"errors"
+	"sort"
+	"sync"
+)
+
+type DeliveryTemplateRepository interface {
+	CreateTemplate(t *model.DeliveryTemplate) error
+	GetTemplate(id uint) (*model.DeliveryTemplate, error)
+	ListTemplates() ([]model.DeliveryTemplate, error)
+	UpdateTemplate(t *model.DeliveryTemplate) error
+}
+
+type InMemoryDeliveryTemplateRepo struct {
+	mu        sync.RWMutex
+	templates map[uint]*model.DeliveryTemplate
+	nextID    uint
+}
+
+func NewInMemoryDeliveryTemplateRepo() *InMemoryDeliveryTemplateRepo {
+	return &InMemoryDeliveryTemplateRepo{templates: make(map[uint]*model.DeliveryTemplate), nextID: 1}
+}
+
+func (r *InMemoryDeliveryTemplateRepo) CreateTemplate(t *model.DeliveryTemplate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t.ID = r.nextID
+	r.nextID++
+	r.templates[t.ID] = t
+	return nil
+}
+
+func (r *InMemoryDeliveryTemplateRepo) GetTemplate(id uint) (*model.DeliveryTemplate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.templates[id]
+	if !ok {
+		return nil, errors.New("template not found")
+	}
+	return t, nil
+}
+
+func (r *InMemoryDeliveryTemplateRepo) ListTemplates() ([]model.DeliveryTemplate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]model.DeliveryTemplate, 0, len(r.templates))
+	for _, t := range r.templates {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (r *InMemoryDeliveryTemplateRepo) UpdateTemplate(t *model.DeliveryTemplate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.templates[t.ID]; !ok {
+		return errors.New("template not found")
+	}
+	r.templates[t.ID] = t
+	return nil
+}
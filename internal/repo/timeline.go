@@ -0,0 +1,40 @@
+package repo
+
+import (
+	"deliverymanagement/internal/model"
+	"sync"
+)
+
+type TimelineRepository interface {
+	AddEvent(e *model.TimelineEvent) error
+	ListEvents(deliveryID uint) ([]model.TimelineEvent, error)
+}
+
+type InMemoryTimelineRepo struct {
+	mu     sync.RWMutex
+	events map[uint][]*model.TimelineEvent // delivery_id -> events in insertion order
+	nextID uint
+}
+
+func NewInMemoryTimelineRepo() *InMemoryTimelineRepo {
+	return &InMemoryTimelineRepo{events: make(map[uint][]*model.TimelineEvent), nextID: 1}
+}
+
+func (r *InMemoryTimelineRepo) AddEvent(e *model.TimelineEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.ID = r.nextID
+	r.nextID++
+	r.events[e.DeliveryID] = append(r.events[e.DeliveryID], e)
+	return nil
+}
+
+func (r *InMemoryTimelineRepo) ListEvents(deliveryID uint) ([]model.TimelineEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]model.TimelineEvent, 0, len(r.events[deliveryID]))
+	for _, e := range r.events[deliveryID] {
+		out = append(out, *e)
+	}
+	return out, nil
+}
@@ -0,0 +1,135 @@
+package repo
+
+import (
+	"deliverymanagement/internal/model"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrRefreshTokenUsed = errors.New("refresh token already used")
+
+// TokenRepository keeps refresh tokens and remembers the access tokens
+// issued with them, so both can be revoked before they expire.
+type TokenRepository interface {
+	CreateRefreshToken(t *model.RefreshToken) error
+	GetRefreshToken(hash string) (*model.RefreshToken, error)
+	// UseRefreshToken marks the token as rotated into replacedBy. It fails
+	// with ErrRefreshTokenUsed when the token was used before, so two
+	// concurrent refreshes cannot both succeed.
+	UseRefreshToken(hash, replacedBy string, at time.Time) error
+	// RecordAccessToken remembers an issued access token until it expires.
+	RecordAccessToken(jti string, userID uint, familyID string, expiresAt time.Time) error
+	// RevokeFamily revokes the family's refresh tokens and denies its
+	// access tokens.
+	RevokeFamily(familyID string, at time.Time) error
+	// RevokeUser revokes every refresh and access token of the user.
+	RevokeUser(userID uint, at time.Time) error
+	// IsAccessTokenRevoked reports whether the jti is on the denylist.
+	IsAccessTokenRevoked(jti string) bool
+}
+
+type accessToken struct {
+	userID    uint
+	familyID  string
+	expiresAt time.Time
+	revoked   bool
+}
+
+type InMemoryTokenRepo struct {
+	mu      sync.RWMutex
+	refresh map[string]model.RefreshToken
+	access  map[string]accessToken // by jti
+}
+
+func NewInMemoryTokenRepo() *InMemoryTokenRepo {
+	return &InMemoryTokenRepo{
+		refresh: make(map[string]model.RefreshToken),
+		access:  make(map[string]accessToken),
+	}
+}
+
+func (r *InMemoryTokenRepo) CreateRefreshToken(t *model.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.refresh[t.Hash]; exists {
+		return errors.New("refresh token already exists")
+	}
+	r.refresh[t.Hash] = *t
+	return nil
+}
+
+func (r *InMemoryTokenRepo) GetRefreshToken(hash string) (*model.RefreshToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.refresh[hash]
+	if !ok {
+		return nil, errors.New("refresh token not found")
+	}
+	return &t, nil
+}
+
+func (r *InMemoryTokenRepo) UseRefreshToken(hash, replacedBy string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.refresh[hash]
+	if !ok {
+		return errors.New("refresh token not found")
+	}
+	if !t.UsedAt.IsZero() {
+		return ErrRefreshTokenUsed
+	}
+	t.UsedAt, t.ReplacedBy = at, replacedBy
+	r.refresh[hash] = t
+	return nil
+}
+
+func (r *InMemoryTokenRepo) RecordAccessToken(jti string, userID uint, familyID string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Expired tokens are refused anyway, so they are dropped here.
+	now := time.Now()
+	for id, a := range r.access {
+		if now.After(a.expiresAt) {
+			delete(r.access, id)
+		}
+	}
+	r.access[jti] = accessToken{userID: userID, familyID: familyID, expiresAt: expiresAt}
+	return nil
+}
+
+func (r *InMemoryTokenRepo) RevokeFamily(familyID string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.revoke(func(userID uint, family string) bool { return family == familyID }, at)
+	return nil
+}
+
+func (r *InMemoryTokenRepo) RevokeUser(userID uint, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.revoke(func(user uint, family string) bool { return user == userID }, at)
+	return nil
+}
+
+// revoke revokes the matching tokens; the caller holds the lock.
+func (r *InMemoryTokenRepo) revoke(match func(userID uint, familyID string) bool, at time.Time) {
+	for hash, t := range r.refresh {
+		if match(t.UserID, t.FamilyID) && t.RevokedAt.IsZero() {
+			t.RevokedAt = at
+			r.refresh[hash] = t
+		}
+	}
+	for jti, a := range r.access {
+		if match(a.userID, a.familyID) {
+			a.revoked = true
+			r.access[jti] = a
+		}
+	}
+}
+
+func (r *InMemoryTokenRepo) IsAccessTokenRevoked(jti string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.access[jti].revoked
+}
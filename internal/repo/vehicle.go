@@ -0,0 +1,159 @@
+package repo
+
+import (
+	"deliverymanagement/internal/model"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+type VehicleRepository interface {
+	CreateVehicle(v *model.Vehicle) error
+	GetVehicle(id uint) (*model.Vehicle, error)
+	ListVehicles() ([]model.Vehicle, error)
+	UpdateVehicle(v *model.Vehicle) error
+	// CreateAssignment rejects shifts that overlap another shift of the same
+	// vehicle or the same courier.
+	CreateAssignment(a *model.VehicleAssignment) error
+	ListAssignments(vehicleID uint) ([]model.VehicleAssignment, error)
+	// ActiveAssignment returns the courier's shift running at t.
+	ActiveAssignment(courierID uint, t time.Time) (*model.VehicleAssignment, error)
+	CreateManifest(m *model.VehicleManifest) error
+	ListManifests(vehicleID uint) ([]model.VehicleManifest, error)
+}
+
+type InMemoryVehicleRepo struct {
+	mu          sync.RWMutex
+	vehicles    map[uint]*model.Vehicle
+	assignments []model.VehicleAssignment
+	manifests   []model.VehicleManifest
+	nextID      uint
+}
+
+func NewInMemoryVehicleRepo() *InMemoryVehicleRepo {
+	return &InMemoryVehicleRepo{vehicles: make(map[uint]*model.Vehicle), nextID: 1}
+}
+
+func (r *InMemoryVehicleRepo) CreateVehicle(v *model.Vehicle) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.vehicles {
+		if existing.Plate == v.Plate {
+			return errors.New("vehicle with this plate already exists")
+		}
+	}
+	v.ID = r.nextID
+	r.nextID++
+	r.vehicles[v.ID] = v
+	return nil
+}
+
+func (r *InMemoryVehicleRepo) GetVehicle(id uint) (*model.Vehicle, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	v, ok := r.vehicles[id]
+	if !ok {
+		return nil, errors.New("vehicle not found")
+	}
+	return v, nil
+}
+
+func (r *InMemoryVehicleRepo) ListVehicles() ([]model.Vehicle, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]model.Vehicle, 0, len(r.vehicles))
+	for _, v := range r.vehicles {
+		out = append(out, *v)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (r *InMemoryVehicleRepo) UpdateVehicle(v *model.Vehicle) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.vehicles[v.ID]; !ok {
+		return errors.New("vehicle not found")
+	}
+	for _, existing := range r.vehicles {
+		if existing.ID != v.ID && existing.Plate == v.Plate {
+			return errors.New("vehicle with this plate already exists")
+		}
+	}
+	r.vehicles[v.ID] = v
+	return nil
+}
+
+func (r *InMemoryVehicleRepo) CreateAssignment(a *model.VehicleAssignment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.vehicles[a.VehicleID]; !ok {
+		return errors.New("vehicle not found")
+	}
+	for _, existing := range r.assignments {
+		if !existing.Overlaps(*a) {
+			continue
+		}
+		if existing.VehicleID == a.VehicleID {
+			return errors.New("vehicle is already assigned for this shift")
+		}
+		if existing.CourierID == a.CourierID {
+			return errors.New("courier already has a vehicle for this shift")
+		}
+	}
+	a.ID = uint(len(r.assignments) + 1)
+	r.assignments = append(r.assignments, *a)
+	return nil
+}
+
+func (r *InMemoryVehicleRepo) ListAssignments(vehicleID uint) ([]model.VehicleAssignment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := []model.VehicleAssignment{}
+	for _, a := range r.assignments {
+		if a.VehicleID == vehicleID {
+			out = append(out, a)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartsAt.Before(out[j].StartsAt) })
+	return out, nil
+}
+
+func (r *InMemoryVehicleRepo) ActiveAssignment(courierID uint, t time.Time) (*model.VehicleAssignment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, a := range r.assignments {
+		if a.CourierID == courierID && a.Covers(t) {
+			found := a
+			return &found, nil
+		}
+	}
+	return nil, errors.New("no vehicle assignment")
+}
+
+func (r *InMemoryVehicleRepo) CreateManifest(m *model.VehicleManifest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.vehicles[m.VehicleID]; !ok {
+		return errors.New("vehicle not found")
+	}
+	m.ID = uint(len(r.manifests) + 1)
+	stored := *m
+	stored.DeliveryIDs = append([]uint(nil), m.DeliveryIDs...)
+	r.manifests = append(r.manifests, stored)
+	return nil
+}
+
+func (r *InMemoryVehicleRepo) ListManifests(vehicleID uint) ([]model.VehicleManifest, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := []model.VehicleManifest{}
+	for _, m := range r.manifests {
+		if m.VehicleID == vehicleID {
+			m.DeliveryIDs = append([]uint(nil), m.DeliveryIDs...)
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,77 @@
+package repo
+
+import (
+	"deliverymanagement/internal/model"
+	"errors"
+	"sort"
+	"sync"
+)
+
+type ZoneRepository interface {
+	CreateZone(zone *model.Zone) error
+	GetZone(id uint) (*model.Zone, error)
+	ListZones() ([]model.Zone, error)
+	UpdateZone(zone *model.Zone) error
+	DeleteZone(id uint) error
+}
+
+type InMemoryZoneRepo struct {
+	mu     sync.RWMutex
+	zones  map[uint]*model.Zone
+	nextID uint
+}
+
+func NewInMemoryZoneRepo() *InMemoryZoneRepo {
+	return &InMemoryZoneRepo{zones: make(map[uint]*model.Zone), nextID: 1}
+}
+
+func (r *InMemoryZoneRepo) CreateZone(zone *model.Zone) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	zone.ID = r.nextID
+	r.nextID++
+	r.zones[zone.ID] = zone
+	return nil
+}
+
+func (r *InMemoryZoneRepo) GetZone(id uint) (*model.Zone, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	zone, ok := r.zones[id]
+	if !ok {
+		return nil, errors.New("zone not found")
+	}
+	return zone, nil
+}
+
+// ListZones returns zones ordered by ID so overlapping zones resolve deterministically.
+func (r *InMemoryZoneRepo) ListZones() ([]model.Zone, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]model.Zone, 0, len(r.zones))
+	for _, z := range r.zones {
+		out = append(out, *z)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (r *InMemoryZoneRepo) UpdateZone(zone *model.Zone) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.zones[zone.ID]; !ok {
+		return errors.New("zone not found")
+	}
+	r.zones[zone.ID] = zone
+	return nil
+}
+
+func (r *InMemoryZoneRepo) DeleteZone(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.zones[id]; !ok {
+		return errors.New("zone not found")
+	}
+	delete(r.zones, id)
+	return nil
+}
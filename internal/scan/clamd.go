@@ -0,0 +1,92 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamdChunk is the size of the INSTREAM chunks sent to clamd; it must stay
+// below clamd's StreamMaxLength.
+const clamdChunk = 64 * 1024
+
+// Clamd scans through a ClamAV daemon listening on TCP, using the INSTREAM
+// command: the content is streamed as length-prefixed chunks and clamd
+// answers "stream: OK" or "stream: <signature> FOUND".
+type Clamd struct {
+	Addr string // host:port, usually port 3310
+	// Timeout bounds one scan when the context has no deadline; one
+	// minute when zero.
+	Timeout time.Duration
+}
+
+func (s *Clamd) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return Result{}, fmt.Errorf("clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return Result{}, fmt.Errorf("clamd: %w", err)
+	}
+	buf := make([]byte, clamdChunk)
+	var size [4]byte
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size[:], uint32(n))
+			if _, werr := conn.Write(append(size[:], buf[:n]...)); werr != nil {
+				return Result{}, fmt.Errorf("clamd: %w", werr)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	binary.BigEndian.PutUint32(size[:], 0)
+	if _, err := conn.Write(size[:]); err != nil {
+		return Result{}, fmt.Errorf("clamd: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil && !(err == io.EOF && len(reply) > 0) {
+		return Result{}, fmt.Errorf("clamd: %w", err)
+	}
+	return parseClamdReply(string(bytes.TrimRight(reply, "\x00\n")))
+}
+
+// parseClamdReply reads "stream: OK", "stream: <sig> FOUND" or
+// "<message> ERROR".
+func parseClamdReply(reply string) (Result, error) {
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	}
+	return Result{}, fmt.Errorf("clamd: %s", reply)
+}
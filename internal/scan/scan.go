@@ -0,0 +1,55 @@
+// Package scan checks uploaded files for malware. Handlers only see the
+// Scanner interface; the backend is picked at startup.
+package scan
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// Result is the verdict on one file.
+type Result struct {
+	Infected bool
+	// Signature names what was found, e.g. "Eicar-Test-Signature".
+	Signature string
+}
+
+// Scanner inspects content. An error means no verdict was reached; the
+// caller must not treat the file as clean.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// EICAR is the standard anti-virus test file, which every scanner reports
+// as infected.
+const EICAR = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// Fake stands in for a real scanner in tests and local development. It
+// reports content containing the EICAR string, or any of Signatures, as
+// infected.
+type Fake struct {
+	// Signatures maps byte patterns to the signature name reported.
+	Signatures map[string]string
+	// Err, when set, is returned instead of a verdict.
+	Err error
+}
+
+func (f *Fake) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	if f.Err != nil {
+		return Result{}, f.Err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Result{}, err
+	}
+	if bytes.Contains(data, []byte(EICAR)) {
+		return Result{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+	}
+	for pattern, name := range f.Signatures {
+		if bytes.Contains(data, []byte(pattern)) {
+			return Result{Infected: true, Signature: name}, nil
+		}
+	}
+	return Result{}, nil
+}
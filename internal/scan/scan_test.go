@@ -0,0 +1,103 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClamd speaks enough of the clamd protocol for INSTREAM and answers
+// FOUND for content holding the EICAR string.
+func fakeClamd(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen:", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				cmd, err := r.ReadString(0)
+				if err != nil || cmd != "zINSTREAM\x00" {
+					conn.Write([]byte("UNKNOWN COMMAND ERROR\x00"))
+					return
+				}
+				var data bytes.Buffer
+				for {
+					var size uint32
+					if binary.Read(r, binary.BigEndian, &size) != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					io.CopyN(&data, r, int64(size))
+				}
+				if bytes.Contains(data.Bytes(), []byte(EICAR)) {
+					conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+					return
+				}
+				conn.Write([]byte("stream: OK\x00"))
+			}(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestClamd(t *testing.T) {
+	s := &Clamd{Addr: fakeClamd(t)}
+	ctx := context.Background()
+
+	res, err := s.Scan(ctx, strings.NewReader("harmless"))
+	assert.NoError(t, err)
+	assert.False(t, res.Infected)
+
+	// Spans several chunks, with the signature at the end.
+	big := strings.Repeat("x", 3*clamdChunk+10) + EICAR
+	res, err = s.Scan(ctx, strings.NewReader(big))
+	assert.NoError(t, err)
+	assert.True(t, res.Infected)
+	assert.Equal(t, "Eicar-Test-Signature", res.Signature)
+
+	_, err = (&Clamd{Addr: "127.0.0.1:1"}).Scan(ctx, strings.NewReader("x"))
+	assert.Error(t, err)
+}
+
+func TestParseClamdReply(t *testing.T) {
+	res, err := parseClamdReply("stream: OK")
+	assert.NoError(t, err)
+	assert.False(t, res.Infected)
+	res, err = parseClamdReply("stream: Win.Test.EICAR_HDB-1 FOUND")
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Infected: true, Signature: "Win.Test.EICAR_HDB-1"}, res)
+	_, err = parseClamdReply("INSTREAM size limit exceeded. ERROR")
+	assert.Error(t, err)
+}
+
+func TestFake(t *testing.T) {
+	f := &Fake{Signatures: map[string]string{"evil": "Test.Evil"}}
+	ctx := context.Background()
+	res, _ := f.Scan(ctx, strings.NewReader("fine"))
+	assert.False(t, res.Infected)
+	res, _ = f.Scan(ctx, strings.NewReader("pre"+EICAR))
+	assert.True(t, res.Infected)
+	res, _ = f.Scan(ctx, strings.NewReader("so evil"))
+	assert.Equal(t, "Test.Evil", res.Signature)
+	f.Err = errors.New("down")
+	_, err := f.Scan(ctx, strings.NewReader("fine"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,214 @@
+// Package serviceability decides whether a shipment between two addresses can
+// be booked, which service levels apply and when it can arrive at the earliest.
+package serviceability
+
+import (
+	"fmt"
+	"time"
+
+	"deliverymanagement/internal/geo"
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+)
+
+// Level describes a service level offered to clients.
+type Level struct {
+	Code        string
+	TransitDays int    // working days between dispatch and delivery
+	Cutoff      string // overrides the hub cut-off when earlier, "" keeps it
+	SameHubOnly bool   // origin and destination must belong to the same hub
+}
+
+// Levels is the service level catalog, fastest last.
+var Levels = []Level{
+	{Code: "STANDARD", TransitDays: 2},
+	{Code: "EXPRESS", TransitDays: 1},
+	{Code: "SAME_DAY", TransitDays: 0, Cutoff: "12:00", SameHubOnly: true},
+}
+
+const (
+	ReasonUnresolvedAddress = "address_unresolved"
+	ReasonOriginNotCovered  = "origin_not_covered"
+	ReasonDestNotCovered    = "destination_not_covered"
+	ReasonNoServiceLevel    = "no_service_level"
+)
+
+// Option is one bookable service level with its dates.
+type Option struct {
+	Level            string    `json:"service_level"`
+	Cutoff           time.Time `json:"cutoff"`            // book before this to dispatch on DispatchDate
+	DispatchDate     string    `json:"dispatch_date"`     // YYYY-MM-DD at the origin hub
+	EarliestDelivery string    `json:"earliest_delivery"` // YYYY-MM-DD at the destination hub
+}
+
+type Result struct {
+	Serviceable       bool     `json:"serviceable"`
+	Reason            string   `json:"reason,omitempty"`
+	OriginZoneID      uint     `json:"origin_zone_id,omitempty"`
+	DestinationZoneID uint     `json:"destination_zone_id,omitempty"`
+	Options           []Option `json:"service_levels"`
+	EarliestDelivery  string   `json:"earliest_delivery,omitempty"`
+}
+
+// Option returns the option for the given level code, if offered.
+func (r Result) Option(level string) (Option, bool) {
+	for _, o := range r.Options {
+		if o.Level == level {
+			return o, true
+		}
+	}
+	return Option{}, false
+}
+
+type Checker struct {
+	Zones repo.ZoneRepository
+	Hubs  repo.HubRepository // optional; hubs without a record use the default calendar
+	Now   func() time.Time   // defaults to time.Now
+}
+
+// Check evaluates already resolved (normalized and geocoded) addresses.
+func (c *Checker) Check(origin, dest model.Address) Result {
+	if !origin.Geocoded || !dest.Geocoded {
+		return Result{Reason: ReasonUnresolvedAddress}
+	}
+	zones, _ := c.Zones.ListZones()
+	oz := geo.FindZone(zones, geo.Point{Lat: origin.Lat, Lng: origin.Lng})
+	if oz == nil {
+		return Result{Reason: ReasonOriginNotCovered}
+	}
+	dz := geo.FindZone(zones, geo.Point{Lat: dest.Lat, Lng: dest.Lng})
+	if dz == nil {
+		return Result{Reason: ReasonDestNotCovered, OriginZoneID: oz.ID}
+	}
+	res := Result{OriginZoneID: oz.ID, DestinationZoneID: dz.ID}
+	originCal := c.calendar(oz.Hub)
+	destCal := c.calendar(dz.Hub)
+	now := time.Now()
+	if c.Now != nil {
+		now = c.Now()
+	}
+	offered := dz.ServiceLevels
+	if len(offered) == 0 {
+		offered = []string{"STANDARD"}
+	}
+	for _, lvl := range Levels {
+		if !contains(offered, lvl.Code) || (lvl.SameHubOnly && oz.Hub != dz.Hub) {
+			continue
+		}
+		cutoffClock := originCal.cutoff
+		if lvl.Cutoff != "" && lvl.Cutoff < cutoffClock {
+			cutoffClock = lvl.Cutoff
+		}
+		dispatch, cutoff := originCal.nextDispatch(now, cutoffClock)
+		arrival := destCal.addWorkingDays(dispatch, lvl.TransitDays)
+		opt := Option{
+			Level:            lvl.Code,
+			Cutoff:           cutoff,
+			DispatchDate:     dispatch.Format(dateLayout),
+			EarliestDelivery: arrival.Format(dateLayout),
+		}
+		res.Options = append(res.Options, opt)
+		if res.EarliestDelivery == "" || opt.EarliestDelivery < res.EarliestDelivery {
+			res.EarliestDelivery = opt.EarliestDelivery
+		}
+	}
+	if len(res.Options) == 0 {
+		res.Reason = ReasonNoServiceLevel
+		return res
+	}
+	res.Serviceable = true
+	return res
+}
+
+// IsOpen reports whether the hub delivers on the given date. It is used to
+// validate requested delivery dates.
+func (c *Checker) IsOpen(hubCode string, day time.Time) bool {
+	return c.calendar(hubCode).isWorkingDay(day)
+}
+
+const dateLayout = "2006-01-02"
+
+type calendar struct {
+	loc      *time.Location
+	days     map[time.Weekday]bool
+	holidays map[string]bool
+	cutoff   string
+}
+
+func (c *Checker) calendar(hubCode string) calendar {
+	cal := calendar{
+		loc:      time.UTC,
+		days:     map[time.Weekday]bool{time.Monday: true, time.Tuesday: true, time.Wednesday: true, time.Thursday: true, time.Friday: true},
+		holidays: map[string]bool{},
+		cutoff:   "17:00",
+	}
+	if c.Hubs == nil {
+		return cal
+	}
+	hub, err := c.Hubs.GetHub(hubCode)
+	if err != nil {
+		return cal
+	}
+	if loc, err := time.LoadLocation(hub.Timezone); err == nil && hub.Timezone != "" {
+		cal.loc = loc
+	}
+	if len(hub.WorkingDays) > 0 {
+		cal.days = map[time.Weekday]bool{}
+		for _, d := range hub.WorkingDays {
+			cal.days[d] = true
+		}
+	}
+	for _, h := range hub.Holidays {
+		cal.holidays[h] = true
+	}
+	if hub.Cutoff != "" {
+		cal.cutoff = hub.Cutoff
+	}
+	return cal
+}
+
+func (cal calendar) isWorkingDay(t time.Time) bool {
+	t = t.In(cal.loc)
+	return cal.days[t.Weekday()] && !cal.holidays[t.Format(dateLayout)]
+}
+
+// nextDispatch returns the first working day whose cut-off is still ahead of now.
+func (cal calendar) nextDispatch(now time.Time, clock string) (day, cutoff time.Time) {
+	var hh, mm int
+	fmt.Sscanf(clock, "%d:%d", &hh, &mm)
+	local := now.In(cal.loc)
+	day = time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, cal.loc)
+	for i := 0; i < 366; i++ {
+		cutoff = day.Add(time.Duration(hh)*time.Hour + time.Duration(mm)*time.Minute)
+		if cal.isWorkingDay(day) && now.Before(cutoff) {
+			return day, cutoff
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, cutoff
+}
+
+// addWorkingDays moves forward n working days; with n == 0 it returns the
+// first working day on or after from.
+func (cal calendar) addWorkingDays(from time.Time, n int) time.Time {
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, cal.loc)
+	for i := 0; i < 366 && !cal.isWorkingDay(day); i++ {
+		day = day.AddDate(0, 0, 1)
+	}
+	for i := 0; n > 0 && i < 366; i++ {
+		day = day.AddDate(0, 0, 1)
+		if cal.isWorkingDay(day) {
+			n--
+		}
+	}
+	return day
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package serviceability
+
+import (
+	"testing"
+	"time"
+
+	"deliverymanagement/internal/model"
+	"deliverymanagement/internal/repo"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func square(minLng, minLat, maxLng, maxLat float64) model.Polygon {
+	return model.Polygon{{{minLng, minLat}, {maxLng, minLat}, {maxLng, maxLat}, {minLng, maxLat}, {minLng, minLat}}}
+}
+
+func setupChecker(now time.Time) *Checker {
+	zones := repo.NewInMemoryZoneRepo()
+	zones.CreateZone(&model.Zone{Name: "Almaty", Hub: "ALA", ServiceLevels: []string{"STANDARD", "EXPRESS", "SAME_DAY"}, Polygons: []model.Polygon{square(76, 43, 77, 44)}})
+	zones.CreateZone(&model.Zone{Name: "Astana", Hub: "AST", Polygons: []model.Polygon{square(71, 51, 72, 52)}})
+	hubs := repo.NewInMemoryHubRepo()
+	hubs.SaveHub(&model.Hub{Code: "ALA", Cutoff: "15:00", Holidays: []string{"2026-10-19"}})
+	return &Checker{Zones: zones, Hubs: hubs, Now: func() time.Time { return now }}
+}
+
+var (
+	almaty  = model.Address{Lat: 43.2, Lng: 76.9, Geocoded: true}
+	astana  = model.Address{Lat: 51.1, Lng: 71.4, Geocoded: true}
+	nowhere = model.Address{Lat: 10, Lng: 10, Geocoded: true}
+)
+
+func TestCheckServiceLevelsAndDates(t *testing.T) {
+	// Friday morning, Monday is a holiday at ALA
+	c := setupChecker(time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC))
+
+	res := c.Check(almaty, almaty)
+	assert.True(t, res.Serviceable)
+	assert.Len(t, res.Options, 3)
+	sameDay, _ := res.Option("SAME_DAY")
+	assert.Equal(t, "2026-10-16", sameDay.EarliestDelivery)
+	assert.Equal(t, time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC), sameDay.Cutoff)
+	express, _ := res.Option("EXPRESS")
+	assert.Equal(t, "2026-10-20", express.EarliestDelivery)
+	standard, _ := res.Option("STANDARD")
+	assert.Equal(t, "2026-10-21", standard.EarliestDelivery)
+	assert.Equal(t, "2026-10-16", res.EarliestDelivery)
+
+	// Cross-hub: only STANDARD, destination calendar has no holiday
+	res = c.Check(almaty, astana)
+	assert.True(t, res.Serviceable)
+	assert.Len(t, res.Options, 1)
+	assert.Equal(t, "2026-10-20", res.EarliestDelivery)
+}
+
+func TestCheckAfterCutoff(t *testing.T) {
+	c := setupChecker(time.Date(2026, 10, 16, 13, 0, 0, 0, time.UTC))
+	res := c.Check(almaty, almaty)
+	sameDay, _ := res.Option("SAME_DAY")
+	assert.Equal(t, "2026-10-20", sameDay.DispatchDate)
+	express, _ := res.Option("EXPRESS")
+	assert.Equal(t, "2026-10-16", express.DispatchDate)
+}
+
+func TestCheckNotServiceable(t *testing.T) {
+	c := setupChecker(time.Now())
+	assert.Equal(t, ReasonDestNotCovered, c.Check(almaty, nowhere).Reason)
+	assert.Equal(t, ReasonOriginNotCovered, c.Check(nowhere, almaty).Reason)
+	assert.Equal(t, ReasonUnresolvedAddress, c.Check(almaty, model.Address{}).Reason)
+	assert.False(t, c.Check(almaty, nowhere).Serviceable)
+}
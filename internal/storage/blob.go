@@ -0,0 +1,69 @@
+// Package storage keeps uploaded files. Handlers only see the BlobStore
+// interface; the backend is picked at startup.
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// BlobInfo describes a stored blob.
+type BlobInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// BlobStore stores blobs under flat keys such as "<sha256>.jpg".
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns the blob's content; the caller closes it.
+	Get(ctx context.Context, key string) (io.ReadSeekCloser, BlobInfo, error)
+	Stat(ctx context.Context, key string) (BlobInfo, error)
+	Delete(ctx context.Context, key string) error
+	// List returns the blobs whose key starts with prefix.
+	List(ctx context.Context, prefix string) ([]BlobInfo, error)
+}
+
+// ContentKey is the content-addressed key for data: its SHA-256 followed
+// by ext.
+func ContentKey(data []byte, ext string) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]) + ext
+}
+
+// PutContent stores data under its content key, so identical uploads share
+// one blob; created reports whether the blob is new. An existing blob is
+// written again, which makes it fresh for the janitor's orphan grace.
+func PutContent(ctx context.Context, s BlobStore, data []byte, ext, contentType string) (key string, created bool, err error) {
+	key = ContentKey(data, ext)
+	if _, err := s.Stat(ctx, key); errors.Is(err, ErrNotFound) {
+		created = true
+	} else if err != nil {
+		return "", false, err
+	}
+	if err := s.Put(ctx, key, data, contentType); err != nil {
+		return "", false, err
+	}
+	return key, created, nil
+}
+
+// validKey keeps keys to a single path segment, so they cannot escape the
+// store's directory or bucket.
+func validKey(key string) error {
+	if key == "" || key == "." || key == ".." || strings.HasPrefix(key, ".") || strings.ContainsAny(key, `/\`) {
+		return ErrInvalidKey
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LocalStore keeps blobs as files in one directory. The content type is
+// derived from the key's extension.
+type LocalStore struct {
+	Dir string
+}
+
+// NewLocalStore creates dir if needed.
+func NewLocalStore(dir string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{Dir: dir}, nil
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	if err := validKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Dir, key), nil
+}
+
+// Put writes to a temporary file first, so readers never see a partial blob.
+func (s *LocalStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.Dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadSeekCloser, BlobInfo, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, BlobInfo{}, notFound(err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, BlobInfo{}, err
+	}
+	return f, fileInfo(key, st), nil
+}
+
+func (s *LocalStore) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		return BlobInfo{}, notFound(err)
+	}
+	return fileInfo(key, st), nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	return notFound(os.Remove(path))
+}
+
+func (s *LocalStore) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []BlobInfo
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || validKey(name) != nil || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		st, err := e.Info()
+		if err != nil {
+			continue // removed meanwhile
+		}
+		out = append(out, fileInfo(name, st))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+func fileInfo(key string, st fs.FileInfo) BlobInfo {
+	return BlobInfo{
+		Key:         key,
+		Size:        st.Size(),
+		ContentType: mime.TypeByExtension(filepath.Ext(key)),
+		ModTime:     st.ModTime(),
+	}
+}
+
+func notFound(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
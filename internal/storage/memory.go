@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps blobs in memory, for tests and single-instance demos.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	blobs map[string]memoryBlob
+}
+
+type memoryBlob struct {
+	data []byte
+	info BlobInfo
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{blobs: make(map[string]memoryBlob)}
+}
+
+func (s *MemoryStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[key] = memoryBlob{
+		data: append([]byte(nil), data...),
+		info: BlobInfo{Key: key, Size: int64(len(data)), ContentType: contentType, ModTime: time.Now()},
+	}
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (io.ReadSeekCloser, BlobInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.blobs[key]
+	if !ok {
+		return nil, BlobInfo{}, ErrNotFound
+	}
+	return nopCloser{bytes.NewReader(b.data)}, b.info, nil
+}
+
+func (s *MemoryStore) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.blobs[key]
+	if !ok {
+		return BlobInfo{}, ErrNotFound
+	}
+	return b.info, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.blobs[key]; !ok {
+		return ErrNotFound
+	}
+	delete(s.blobs, key)
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []BlobInfo
+	for key, b := range s.blobs {
+		if strings.HasPrefix(key, prefix) {
+			out = append(out, b.info)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+// nopCloser turns an in-memory reader into an io.ReadSeekCloser.
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error { return nil }
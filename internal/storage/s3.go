@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config points an S3Store at a bucket on AWS S3 or any S3-compatible
+// service such as MinIO. Requests use path-style URLs:
+// <Endpoint>/<Bucket>/<key>.
+type S3Config struct {
+	Endpoint  string // e.g. https://s3.eu-central-1.amazonaws.com
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3Store keeps blobs as objects in an S3 bucket, signing requests with
+// AWS Signature Version 4.
+type S3Store struct {
+	cfg    S3Config
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewS3Store(cfg S3Config) *S3Store {
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	return &S3Store{cfg: cfg, client: &http.Client{Timeout: 30 * time.Second}, now: time.Now}
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodPut, key, nil, data, func(h http.Header) {
+		if contentType != "" {
+			h.Set("Content-Type", contentType)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get reads the whole object, so the result can seek; blobs are small.
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadSeekCloser, BlobInfo, error) {
+	if err := validKey(key); err != nil {
+		return nil, BlobInfo{}, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	info := objectInfo(key, resp.Header)
+	info.Size = int64(len(data))
+	return nopCloser{bytes.NewReader(data)}, info, nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	if err := validKey(key); err != nil {
+		return BlobInfo{}, err
+	}
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	resp.Body.Close()
+	return objectInfo(key, resp.Header), nil
+}
+
+// Delete reports ErrNotFound like the other stores, which costs a HEAD
+// request because S3 deletes missing objects without complaint.
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if _, err := s.Stat(ctx, key); err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	var out []BlobInfo
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", q, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range page.Contents {
+			out = append(out, BlobInfo{Key: o.Key, Size: o.Size, ModTime: o.LastModified})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return out, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// do sends a signed request for key, or for the bucket when key is empty.
+// A 404 becomes ErrNotFound and any other non-2xx status an error.
+func (s *S3Store) do(ctx context.Context, method, key string, query url.Values, body []byte, setHeaders func(http.Header)) (*http.Response, error) {
+	u := s.cfg.Endpoint + "/" + url.PathEscape(s.cfg.Bucket)
+	if key != "" {
+		u += "/" + url.PathEscape(key)
+	}
+	if len(query) > 0 {
+		u += "?" + canonicalQuery(query)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if setHeaders != nil {
+		setHeaders(req.Header)
+	}
+	s.sign(req, body)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s: %s: %s", method, key, resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp, nil
+}
+
+// sign adds the AWS Signature Version 4 headers. Every header already set
+// on the request is signed, together with host, x-amz-date and
+// x-amz-content-sha256.
+func (s *S3Store) sign(req *http.Request, body []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	payload := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payload[:]))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payload[:]),
+	}, "\n")
+	scope := now.Format("20060102") + "/" + s.cfg.Region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), now.Format("20060102"))
+	for _, part := range []string{s.cfg.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+// canonicalQuery encodes the query sorted by name, spaces as %20.
+func canonicalQuery(q url.Values) string {
+	return strings.ReplaceAll(q.Encode(), "+", "%20")
+}
+
+func objectInfo(key string, h http.Header) BlobInfo {
+	size, _ := strconv.ParseInt(h.Get("Content-Length"), 10, 64)
+	modTime, _ := http.ParseTime(h.Get("Last-Modified"))
+	return BlobInfo{Key: key, Size: size, ContentType: h.Get("Content-Type"), ModTime: modTime}
+}